@@ -162,5 +162,6 @@ func telegram(conf config.Config, store config.Saver) func(cmd *cobra.Command, a
 			os.Exit(1)
 		}
 		fmt.Println("4. Open a conversation with the bot in Telegram and type /subscribe. You can find the bot by looking up the username.")
+		fmt.Println("5. To manage the items through the bot, add the ID of the chat, which the bot tells when it refuses a command, to telegram_chats in the config.")
 	}
 }
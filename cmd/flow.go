@@ -0,0 +1,505 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/hooks"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/mediaserver"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/sirupsen/logrus"
+)
+
+// newDispatcher backs the hooks of every flow with the scrapers, the extractor and the download queue
+func newDispatcher(c config.Config, repo *storage.MediaRepository, queue *download.Queue, notifier notifications.Notifier, runHooks hookRunner, blocklist *magnet.Blocklist) *state.Dispatcher {
+	d := state.NewDispatcher()
+
+	profiles, err := qualityProfiles(c)
+	if err != nil {
+		logrus.Fatalf("invalid quality profiles: %s", err)
+	}
+
+	d.OnScrape(scrape(scraper(c)))
+	d.AfterScrape(processMagnets(profiles, rejectFilters(c, repo, blocklist)...))
+	d.AfterScrape(storeMagnets(repo))
+
+	extract := extractFiles(c, repo, extractor(c, repo))
+	d.OnExtract(extract)
+	d.OnDownload(downloadFiles(repo, queue, notifier, runHooks, extract))
+	if rename := newRenamer(c); rename != nil {
+		d.OnDownload(renameDownloads(repo, rename))
+	}
+	if fetcher := subtitleFetcher(c); fetcher != nil {
+		d.OnDownload(fetchSubtitles(repo, fetcher))
+	}
+	d.OnDownload(downloadedHooks(repo, runHooks))
+	if servers := mediaServers(c); len(servers) > 0 {
+		d.OnDownload(refreshLibraries(repo, servers))
+	}
+
+	return &d
+}
+
+func scrape(s magnet.Scraper) func(item media.SearchItem) state.ScrapeResult {
+	return func(item media.SearchItem) state.ScrapeResult {
+		logrus.Debugf("scraping %q with %T", item.Term, s)
+		magnets, err := s.Scrape(item)
+		if err != nil {
+			return state.ScrapeResult{Error: fmt.Errorf("could not scrape %q: %s", item.Term, err)}
+		}
+
+		logrus.Debugf("scraped %q", item.Term)
+		if item.Type == media.TypeSeason {
+			return splitSeason(item, magnets)
+		}
+		return state.ScrapeResult{Value: magnets}
+	}
+}
+
+// splitSeason keeps only the season packs, or splits the season into its episodes when
+// there are no packs. The episodes are the wanted ones, or the ones which were released.
+func splitSeason(item media.SearchItem, magnets []storage.Magnet) state.ScrapeResult {
+	packs, released := magnet.SeasonPacks(item, magnets)
+	if len(packs) > 0 {
+		return state.ScrapeResult{Value: packs}
+	}
+
+	episodes := item.Episodes
+	if len(episodes) == 0 {
+		episodes = released
+	}
+
+	var split []media.SearchItem
+	for _, e := range episodes {
+		split = append(split, item.EpisodeItem(e))
+	}
+
+	logrus.Infof("no season packs found for %q, splitting into episodes %v", item.Term, episodes)
+	return state.ScrapeResult{Split: split}
+}
+
+// processMagnets drops the magnets rejected by the filters, ex. the blocked or the ones
+// with an unexpected size, and then filters and sorts the rest by the quality profile of their item
+func processMagnets(profiles magnet.Profiles, filters ...magnet.ProcessFunc) func([]storage.Magnet) []storage.Magnet {
+	return func(magnets []storage.Magnet) []storage.Magnet {
+		if len(magnets) == 0 {
+			return magnets
+		}
+
+		item := magnets[0].Item
+		for _, filter := range filters {
+			if filter != nil {
+				magnets = filter(magnets)
+			}
+		}
+
+		processed, err := profiles.For(item).Process(magnets)
+		if err != nil {
+			logrus.Errorf("could not process magnets of %q: %s", item.Term, err)
+			return nil
+		}
+
+		return processed
+	}
+}
+
+// rejectFilters returns the filters which reject the blocked magnets, and the ones with an unexpected size
+func rejectFilters(c config.Config, repo *storage.MediaRepository, blocklist *magnet.Blocklist) []magnet.ProcessFunc {
+	sanity, err := sizeSanity(c, rejectMagnet(repo))
+	if err != nil {
+		logrus.Fatalf("invalid size sanity bounds: %s", err)
+	}
+
+	return []magnet.ProcessFunc{blocklist.Filter(rejectMagnet(repo)), sanity}
+}
+
+// rejectMagnet logs and stores the rejected magnet, so it is shown among the candidates of the item
+func rejectMagnet(repo *storage.MediaRepository) magnet.RejectFunc {
+	return func(m storage.Magnet, reason string) {
+		logrus.Infof("rejected magnet %s for %q: %s", m.Location, m.Item.Term, reason)
+
+		m.RejectedReason = reason
+		if err := repo.AddTorrent(m); err != nil {
+			logrus.Errorf("could not store rejected magnet %s: %s", m.Location, err)
+		}
+	}
+}
+
+// storeMagnets rates the sorted magnets, so the best one can be picked after a restart
+func storeMagnets(repo *storage.MediaRepository) func([]storage.Magnet) []storage.Magnet {
+	return func(magnets []storage.Magnet) []storage.Magnet {
+		for rating := range magnets {
+			magnets[rating].Rating = rating
+			if err := repo.AddTorrent(magnets[rating]); err != nil {
+				logrus.Errorf("could not add magnet %s: %s", magnets[rating].Location, err)
+			}
+		}
+
+		if len(magnets) == 0 {
+			return magnets
+		}
+
+		if err := repo.Status(magnets[0].Item.Term, storage.StatusScraped); err != nil {
+			logrus.Errorf("error while updating status in database: %s", err)
+		}
+
+		return magnets
+	}
+}
+
+// extractFiles extracts the files of the best rated magnet and stores where they will be downloaded.
+// Magnets which turn out to be unusable are marked as bad, and the next rated one is tried.
+func extractFiles(c config.Config, repo *storage.MediaRepository, extractor magnet.Extractor) func([]storage.Magnet) state.ExtractResult {
+	return func(magnets []storage.Magnet) state.ExtractResult {
+		if len(magnets) == 0 {
+			return state.ExtractResult{Error: fmt.Errorf("no magnets to extract")}
+		}
+
+		item := magnets[0].Item
+		logrus.Debugf("extracting %q", item.Term)
+		if err := repo.Status(item.Term, storage.StatusExtracting); err != nil {
+			logrus.Errorf("could not update status before extracting: %s", err)
+		}
+
+		candidates := make(map[string]storage.Magnet)
+		for _, m := range magnets {
+			candidates[m.Location] = m
+		}
+
+		for {
+			// Magnets which failed in previous attempts are only known to the database
+			loc, err := repo.GetAvailableMagnet(item.Term)
+			if err == sql.ErrNoRows {
+				return state.ExtractResult{Error: fmt.Errorf("no usable magnets left for %q", item.Term)}
+			}
+			if err != nil {
+				return state.ExtractResult{Error: fmt.Errorf("could not get next magnet for %q: %s", item.Term, err)}
+			}
+
+			if _, ok := candidates[loc]; !ok {
+				stored, err := repo.Torrents(item.Term)
+				if err != nil {
+					return state.ExtractResult{Error: fmt.Errorf("could not load magnets of %q: %s", item.Term, err)}
+				}
+				for _, m := range stored {
+					candidates[m.Location] = m
+				}
+			}
+			m, ok := candidates[loc]
+			if !ok {
+				m = storage.Magnet{Location: loc}
+			}
+			m.Item = item
+
+			if err := repo.TryMagnet(item.Term, m.Location); err != nil {
+				logrus.Errorf("could not mark magnet %s as tried: %s", m.Location, err)
+			}
+
+			urls, err := extractor.Extract(m)
+			if magnet.IsBadMagnet(err) {
+				logrus.Warnf("magnet %s for %q is unusable, trying the next one: %s", m.Location, item.Term, err)
+				if err := repo.MarkMagnetBad(item.Term, m.Location, err.Error()); err != nil {
+					return state.ExtractResult{Error: fmt.Errorf("could not mark magnet %s as bad: %s", m.Location, err)}
+				}
+				continue
+			}
+			if err != nil {
+				return state.ExtractResult{Error: fmt.Errorf("could not extract link %s: %s", m.Location, err)}
+			}
+
+			downloaded, err := repo.DownloadedEpisodes(item)
+			if err != nil {
+				return state.ExtractResult{Error: fmt.Errorf("could not get downloaded episodes of %q: %s", item.Term, err)}
+			}
+
+			var downloads []storage.Download
+			for _, dl := range downloadsOf(c, m, urls) {
+				if len(dl.Episodes) > 0 && allDownloaded(downloaded, dl.Episodes) {
+					logrus.Infof("skipping %s of %q, the episodes were already downloaded", dl.Remote, item.Term)
+					continue
+				}
+
+				if err := repo.AddDownload(dl); err != nil {
+					return state.ExtractResult{Error: fmt.Errorf("could not add download for %q: %s", dl.Item.Term, err)}
+				}
+				downloads = append(downloads, dl)
+			}
+
+			return state.ExtractResult{Value: downloads}
+		}
+	}
+}
+
+// allDownloaded returns true if every episode was downloaded already
+func allDownloaded(downloaded map[int]bool, episodes []int) bool {
+	for _, e := range episodes {
+		if !downloaded[e] {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadsOf returns the downloads of the files extracted from the magnet. Files of TV shows are
+// matched to their episodes and named after them, while other files keep their names. Subtitles
+// are stored next to their video, and are left out if it can't be found.
+func downloadsOf(c config.Config, m storage.Magnet, urls []string) []storage.Download {
+	item := m.Item
+	base := c.MoviesPath
+	if item.Type == media.TypeEpisode || item.Type == media.TypeSeason {
+		base = c.TVShowsPath
+	}
+
+	var videos, subs []string
+	for _, url := range urls {
+		if subtitles.IsSubtitle(url) {
+			subs = append(subs, url)
+		} else {
+			videos = append(videos, url)
+		}
+	}
+
+	// Subtitles are matched to the episodes by the same offset as the videos
+	offset := magnet.AbsoluteOffset(item, videos)
+	episodes := make(map[string]magnet.EpisodeFile)
+	for _, f := range magnet.MatchEpisodes(item, videos) {
+		episodes[f.Path] = f
+	}
+
+	var downloads []storage.Download
+	for _, url := range videos {
+		dl := storage.Download{
+			Remote: url,
+			Local:  item.Path(base, url),
+			Item:   item,
+			Magnet: m.Location,
+		}
+		if f, ok := episodes[url]; ok {
+			dl.Local = item.EpisodePath(base, url, f.Episode, f.EpisodeEnd)
+			for e := f.Episode; e <= f.EpisodeEnd; e++ {
+				dl.Episodes = append(dl.Episodes, e)
+			}
+		}
+		downloads = append(downloads, dl)
+	}
+
+	videoDownloads := downloads
+	for _, url := range subs {
+		video, ok := subtitleVideo(item, url, offset, videoDownloads)
+		if !ok {
+			logrus.Debugf("skipping %s of %q without a matching video", url, item.Term)
+			continue
+		}
+
+		downloads = append(downloads, storage.Download{
+			Remote:   url,
+			Local:    subtitles.Path(video.Local, subtitles.Language(url)),
+			Item:     item,
+			Magnet:   m.Location,
+			Episodes: video.Episodes,
+		})
+	}
+
+	return downloads
+}
+
+// subtitleVideo returns the download of the video which the subtitles belong to, where offset
+// is the one of the absolute episode numbers of the videos
+func subtitleVideo(item media.SearchItem, url string, offset int, videos []storage.Download) (storage.Download, bool) {
+	if item.Type != media.TypeSeason {
+		if len(videos) == 0 {
+			return storage.Download{}, false
+		}
+		return videos[0], true
+	}
+
+	f, ok := magnet.FileEpisode(item, url, offset)
+	if !ok {
+		return storage.Download{}, false
+	}
+	for _, v := range videos {
+		if len(v.Episodes) > 0 && v.Episodes[0] == f.Episode {
+			return v, true
+		}
+	}
+	return storage.Download{}, false
+}
+
+// downloadedFiles returns the item of the downloads, along with the magnet its files were downloaded
+// from and the files themselves. The magnet may be another one than the extracted one.
+func downloadedFiles(repo *storage.MediaRepository, downloads []storage.Download) (media.SearchItem, storage.Magnet, []storage.Download, error) {
+	item := downloads[0].Item
+	grabbed, err := repo.GrabbedMagnet(item.Term)
+	if err != nil {
+		return item, grabbed, nil, fmt.Errorf("could not get the downloaded magnet: %s", err)
+	}
+	grabbed.Item = item
+
+	files, err := repo.Files(item.Term, grabbed.Location)
+	if err != nil {
+		return item, grabbed, nil, fmt.Errorf("could not get the downloaded files: %s", err)
+	}
+	return item, grabbed, files, nil
+}
+
+// fetchSubtitles fetches the subtitles which weren't in the torrent for each downloaded video of the item.
+// Subtitles which can't be fetched don't fail the download.
+func fetchSubtitles(repo *storage.MediaRepository, fetcher *subtitles.Fetcher) func([]storage.Download) state.DownloadResult {
+	return func(downloads []storage.Download) state.DownloadResult {
+		if len(downloads) == 0 {
+			return state.DownloadResult{}
+		}
+
+		item, _, files, err := downloadedFiles(repo, downloads)
+		if err != nil {
+			logrus.Errorf("could not fetch the subtitles of %q: %s", item.Term, err)
+			return state.DownloadResult{}
+		}
+
+		for _, f := range files {
+			if subtitles.IsSubtitle(f.Local) {
+				continue
+			}
+
+			episode := 0
+			if len(f.Episodes) > 0 {
+				episode = f.Episodes[0]
+			}
+			if err := fetcher.Fetch(item, episode, f.Local); err != nil {
+				logrus.Warnf("could not fetch subtitles of %s: %s", f.Local, err)
+			}
+		}
+
+		return state.DownloadResult{}
+	}
+}
+
+// refreshLibraries makes the media servers scan the folders of the downloaded files of the item,
+// once they are renamed and have their subtitles
+func refreshLibraries(repo *storage.MediaRepository, servers []mediaserver.Server) func([]storage.Download) state.DownloadResult {
+	return func(downloads []storage.Download) state.DownloadResult {
+		if len(downloads) == 0 {
+			return state.DownloadResult{}
+		}
+
+		item, _, files, err := downloadedFiles(repo, downloads)
+		if err != nil {
+			logrus.Errorf("could not refresh the libraries of %q: %s", item.Term, err)
+			return state.DownloadResult{}
+		}
+
+		refreshFolders(servers, files)
+		return state.DownloadResult{}
+	}
+}
+
+// refreshFolders makes the media servers scan the folders of the downloaded files.
+// Servers which can't be reached don't fail the download.
+func refreshFolders(servers []mediaserver.Server, files []storage.Download) {
+	locations := make([]string, 0, len(files))
+	for _, f := range files {
+		locations = append(locations, f.Local)
+	}
+
+	for _, folder := range mediaserver.Folders(locations) {
+		for _, s := range servers {
+			if err := s.Refresh(folder); err != nil {
+				logrus.Warnf("could not refresh %s with %T: %s", folder, s, err)
+				continue
+			}
+			logrus.Debugf("refreshed %s with %T", folder, s)
+		}
+	}
+}
+
+// downloadFiles downloads all files of an item through the queue, and blocks until they are finished.
+// If the files cannot be downloaded because of their magnet, the next rated magnet is extracted instead.
+func downloadFiles(repo *storage.MediaRepository, queue *download.Queue, notifier notifications.Notifier, runHooks hookRunner,
+	extract func([]storage.Magnet) state.ExtractResult) func([]storage.Download) state.DownloadResult {
+	return func(downloads []storage.Download) state.DownloadResult {
+		if len(downloads) == 0 {
+			return state.DownloadResult{}
+		}
+
+		item := downloads[0].Item
+		if err := notifier.OnQueued(item); err != nil {
+			logrus.Warnf("could not notify about queued %q: %s", item.Term, err)
+		}
+		runHooks(hooks.EventQueued, queuedData(repo, item))
+
+		for {
+			err := downloadAll(queue, downloads)
+			if err == nil {
+				break
+			}
+
+			bad, ok := err.(badMagnetDownload)
+			if !ok {
+				return state.DownloadResult{Error: err}
+			}
+
+			logrus.Warnf("magnet %s for %q is unusable, extracting the next one: %s", bad.magnet, item.Term, bad.err)
+			if err := repo.MarkMagnetBad(item.Term, bad.magnet, bad.err.Error()); err != nil {
+				logrus.Errorf("could not mark magnet %s as bad: %s", bad.magnet, err)
+			}
+			if err := repo.RemoveDownloads(item.Term, bad.magnet); err != nil {
+				logrus.Errorf("could not remove downloads of magnet %s: %s", bad.magnet, err)
+			}
+
+			result := extract([]storage.Magnet{{Item: item}})
+			if result.Error != nil {
+				return state.DownloadResult{Error: result.Error}
+			}
+			downloads = result.Value
+		}
+
+		logrus.Debugf("Downloaded %q", item.Term)
+		if err := notifier.OnFinish(item); err != nil {
+			logrus.Warnf("could not notify about downloaded %q: %s", item.Term, err)
+		}
+
+		return state.DownloadResult{Value: []media.SearchItem{item}}
+	}
+}
+
+// badMagnetDownload is returned when a file could not be downloaded because of its magnet
+type badMagnetDownload struct {
+	magnet string
+	err    error
+}
+
+func (e badMagnetDownload) Error() string {
+	return e.err.Error()
+}
+
+// downloadAll downloads the files concurrently, and returns the first error which occurred
+func downloadAll(queue *download.Queue, downloads []storage.Download) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(downloads))
+	for _, dl := range downloads {
+		wg.Add(1)
+		go func(dl storage.Download) {
+			defer wg.Done()
+			logrus.Debugf("queueing download for %q", dl.Remote)
+			info, err := queue.Download(dl)
+			if err != nil && info != nil && magnet.IsBadMagnet(info.Error) {
+				err = badMagnetDownload{magnet: dl.Magnet, err: info.Error}
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(dl)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
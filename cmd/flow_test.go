@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/hooks"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRepo returns a repository on a new database, which is removed by the returned func
+func testRepo(t *testing.T) (*sql.DB, *storage.MediaRepository, func()) {
+	db, cleanup := storagetest.NewDatabase(t)
+	return db, storage.NewMediaRepository(db), cleanup
+}
+
+// storeItem stores the item along with its magnets, rated in the given order
+func storeItem(t *testing.T, repo *storage.MediaRepository, item media.SearchItem, locations ...string) []storage.Magnet {
+	if err := repo.StoreItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	var magnets []storage.Magnet
+	for i, loc := range locations {
+		m := storage.Magnet{Location: loc, Item: item, Quality: storage.QualityFHD, Rating: i + 1}
+		if err := repo.AddTorrent(m); err != nil {
+			t.Fatal(err)
+		}
+		magnets = append(magnets, m)
+	}
+	return magnets
+}
+
+// fakeExtractor returns the files, or the error, of each magnet
+type fakeExtractor struct {
+	files map[string][]string
+	errs  map[string]error
+
+	mu        sync.Mutex
+	extracted []string
+}
+
+func (e *fakeExtractor) Extract(m storage.Magnet) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.extracted = append(e.extracted, m.Location)
+	return e.files[m.Location], e.errs[m.Location]
+}
+
+// fakeGetter finishes every download at once, failing the ones which have an error
+type fakeGetter struct {
+	errs map[string]error
+	// write stores the file of a successful download, if it is set
+	write func(url, destination string)
+
+	mu           sync.Mutex
+	got          []string
+	destinations []string
+}
+
+func (g *fakeGetter) Get(item media.SearchItem, url string, destination string) (download.Informer, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.got = append(g.got, url)
+	g.destinations = append(g.destinations, destination)
+	if g.write != nil && g.errs[url] == nil {
+		g.write(url, destination)
+	}
+	return finished{&download.Info{Item: item, Url: url, Filepath: destination, IsDone: true, Error: g.errs[url]}}, nil
+}
+
+type finished struct {
+	info *download.Info
+}
+
+func (f finished) Info() *download.Info {
+	return f.info
+}
+
+func (g *fakeGetter) urls() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.got...)
+}
+
+func triedMagnets(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query("SELECT url FROM torrents WHERE tried_at IS NOT NULL ORDER BY url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+func failedMagnets(t *testing.T, repo *storage.MediaRepository, title string) []string {
+	torrents, err := repo.Torrents(title)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var urls []string
+	for _, m := range torrents {
+		if m.FailedReason != "" {
+			urls = append(urls, m.Location)
+		}
+	}
+	return urls
+}
+
+func remotes(downloads []storage.Download) []string {
+	var urls []string
+	for _, dl := range downloads {
+		urls = append(urls, dl.Remote)
+	}
+	return urls
+}
+
+func TestExtractFiles(t *testing.T) {
+	bad := &magnet.BadMagnetError{Reason: "no video files"}
+
+	testCases := []struct {
+		name      string
+		files     map[string][]string
+		errs      map[string]error
+		extracted []string
+		failed    []string
+		downloads []string
+		err       bool
+	}{
+		{
+			name:      "best rated",
+			files:     map[string][]string{"magnet-1": {"movie-1.mkv"}, "magnet-2": {"movie-2.mkv"}},
+			extracted: []string{"magnet-1"},
+			downloads: []string{"movie-1.mkv"},
+		},
+		{
+			name:      "next rated after a bad magnet",
+			files:     map[string][]string{"magnet-2": {"movie-2.mkv"}},
+			errs:      map[string]error{"magnet-1": bad},
+			extracted: []string{"magnet-1", "magnet-2"},
+			failed:    []string{"magnet-1"},
+			downloads: []string{"movie-2.mkv"},
+		},
+		{
+			name:      "no magnets left",
+			errs:      map[string]error{"magnet-1": bad, "magnet-2": bad, "magnet-3": bad},
+			extracted: []string{"magnet-1", "magnet-2", "magnet-3"},
+			failed:    []string{"magnet-1", "magnet-2", "magnet-3"},
+			err:       true,
+		},
+		{
+			name:      "other errors keep the magnet",
+			errs:      map[string]error{"magnet-1": assert.AnError},
+			extracted: []string{"magnet-1"},
+			err:       true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, repo, cleanup := testRepo(t)
+			defer cleanup()
+
+			item := media.NewMovie("Movie", 2019, "tt0123")
+			magnets := storeItem(t, repo, item, "magnet-1", "magnet-2", "magnet-3")
+
+			extractor := &fakeExtractor{files: tt.files, errs: tt.errs}
+			result := extractFiles(config.Config{MoviesPath: "/movies"}, repo, extractor)(magnets)
+
+			assert.Equal(t, tt.err, result.Error != nil, "unexpected error: %v", result.Error)
+			assert.Equal(t, tt.extracted, extractor.extracted)
+			assert.Equal(t, tt.extracted, triedMagnets(t, db))
+			assert.Equal(t, tt.failed, failedMagnets(t, repo, item.Term))
+			assert.Equal(t, tt.downloads, remotes(result.Value))
+
+			stored, err := repo.Downloads(item.Term)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.downloads, remotes(stored))
+		})
+	}
+}
+
+func TestDownloadFiles(t *testing.T) {
+	bad := &magnet.BadMagnetError{Reason: "torrent has no peers"}
+
+	testCases := []struct {
+		name       string
+		errs       map[string]error
+		got        []string
+		failed     []string
+		downloaded []string
+		err        bool
+	}{
+		{
+			name:       "downloaded",
+			got:        []string{"movie-1.mkv"},
+			downloaded: []string{"movie-1.mkv"},
+		},
+		{
+			name:       "extracts the next magnet after a bad download",
+			errs:       map[string]error{"movie-1.mkv": bad},
+			got:        []string{"movie-1.mkv", "movie-2.mkv"},
+			failed:     []string{"magnet-1"},
+			downloaded: []string{"movie-2.mkv"},
+		},
+		{
+			name:   "no magnets left",
+			errs:   map[string]error{"movie-1.mkv": bad, "movie-2.mkv": bad},
+			got:    []string{"movie-1.mkv", "movie-2.mkv"},
+			failed: []string{"magnet-1", "magnet-2"},
+			err:    true,
+		},
+		{
+			name: "other errors keep the magnet",
+			errs: map[string]error{"movie-1.mkv": assert.AnError},
+			got:  []string{"movie-1.mkv"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, cleanup := testRepo(t)
+			defer cleanup()
+
+			item := media.NewMovie("Movie", 2019, "tt0123")
+			magnets := storeItem(t, repo, item, "magnet-1", "magnet-2")
+
+			conf := config.Config{MoviesPath: "/movies"}
+			extractor := &fakeExtractor{files: map[string][]string{"magnet-1": {"movie-1.mkv"}, "magnet-2": {"movie-2.mkv"}}}
+			extract := extractFiles(conf, repo, extractor)
+
+			schedule, err := download.NewSchedule(nil)
+			assert.NoError(t, err)
+			getter := &fakeGetter{errs: tt.errs}
+			queue := download.NewQueue(repo, getter, 1, schedule)
+			noHooks := func(event hooks.Event, data hooks.Data) {}
+
+			downloads := extract(magnets[:1]).Value
+			result := downloadFiles(repo, queue, notifications.NewFanout(), noHooks, extract)(downloads)
+
+			assert.Equal(t, tt.err, result.Error != nil, "unexpected error: %v", result.Error)
+			assert.Equal(t, tt.got, getter.urls())
+			assert.Equal(t, tt.failed, failedMagnets(t, repo, item.Term))
+			if !tt.err {
+				assert.Equal(t, []media.SearchItem{item}, result.Value)
+			}
+
+			// The downloads of a bad magnet are forgotten
+			for _, m := range tt.failed {
+				files, err := repo.Files(item.Term, m)
+				assert.NoError(t, err)
+				assert.Empty(t, files)
+			}
+			pending, err := repo.Downloads(item.Term)
+			assert.NoError(t, err)
+			for _, dl := range pending {
+				assert.NotContains(t, tt.failed, dl.Magnet)
+			}
+
+			var downloaded []string
+			for _, m := range magnets {
+				files, err := repo.Files(item.Term, m.Location)
+				assert.NoError(t, err)
+				downloaded = append(downloaded, remotes(files)...)
+			}
+			assert.Equal(t, tt.downloaded, downloaded)
+		})
+	}
+}
+
+func TestExtractFiles_SharedMagnet(t *testing.T) {
+	_, repo, cleanup := testRepo(t)
+	defer cleanup()
+
+	// Both episodes are in the same season pack
+	first, second := media.NewEpisode("Show", 1, 1, "tt0123"), media.NewEpisode("Show", 1, 2, "tt0123")
+	storeItem(t, repo, first, "magnet-pack")
+	magnets := storeItem(t, repo, second, "magnet-pack", "magnet-2")
+
+	assert.NoError(t, repo.MarkMagnetBad(first.Term, "magnet-pack", "no peers"))
+	assert.Equal(t, []string{"magnet-pack"}, failedMagnets(t, repo, first.Term))
+	assert.Empty(t, failedMagnets(t, repo, second.Term))
+
+	extractor := &fakeExtractor{files: map[string][]string{"magnet-pack": {"Show.S01/Show.S01E02.mkv"}}}
+	result := extractFiles(config.Config{TVShowsPath: "/tv"}, repo, extractor)(magnets)
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, []string{"magnet-pack"}, extractor.extracted)
+	assert.Equal(t, []string{"Show.S01/Show.S01E02.mkv"}, remotes(result.Value))
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/hooks"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/sirupsen/logrus"
+)
+
+// hookRunner runs the hooks of the event
+type hookRunner func(event hooks.Event, data hooks.Data)
+
+// newHookRunner returns the function which runs the configured hooks, stores their results and
+// notifies about the ones which failed
+func newHookRunner(c config.Config, repo *storage.MediaRepository, notifier notifications.Notifier) hookRunner {
+	hs, err := hooks.NewHooks(hookConfigs(c.Hooks))
+	if err != nil {
+		logrus.Fatalf("invalid hooks: %s", err)
+	}
+
+	return func(event hooks.Event, data hooks.Data) {
+		for _, run := range hs.Run(event, data) {
+			if err := repo.AddHookRun(run); err != nil {
+				logrus.Errorf("could not store the result of hook %q: %s", run.Hook, err)
+			}
+
+			if run.Error == "" {
+				logrus.Debugf("hook %q ran on %s of %q", run.Hook, event, data.Item.Term)
+				continue
+			}
+
+			logrus.Warnf("hook %q failed on %s of %q: %s", run.Hook, event, data.Item.Term, run.Error)
+			if err := notifier.OnHookFailed(data.Item, run.Hook, run.Error); err != nil {
+				logrus.Warnf("could not notify about the failed hook %q: %s", run.Hook, err)
+			}
+		}
+	}
+}
+
+// queuedData describes the item whose files were queued, along with the magnet they come from
+func queuedData(repo *storage.MediaRepository, item media.SearchItem) hooks.Data {
+	data := hooks.Data{Item: item}
+	if grabbed, err := repo.GrabbedMagnet(item.Term); err == nil {
+		data.Size = int64(grabbed.Size)
+		data.Quality = grabbed.Quality
+	}
+	return data
+}
+
+// downloadedHooks runs the hooks of every downloaded file of the item, once it is renamed
+func downloadedHooks(repo *storage.MediaRepository, runHooks hookRunner) func([]storage.Download) state.DownloadResult {
+	return func(downloads []storage.Download) state.DownloadResult {
+		if len(downloads) == 0 {
+			return state.DownloadResult{}
+		}
+
+		item, grabbed, files, err := downloadedFiles(repo, downloads)
+		if err != nil {
+			logrus.Errorf("could not run the hooks of %q: %s", item.Term, err)
+			return state.DownloadResult{}
+		}
+
+		runFileHooks(runHooks, grabbed, files)
+		return state.DownloadResult{}
+	}
+}
+
+// runFileHooks runs the hooks of the downloaded videos of the magnet, one file at a time
+func runFileHooks(runHooks hookRunner, m storage.Magnet, files []storage.Download) {
+	for _, f := range files {
+		if subtitles.IsSubtitle(f.Local) {
+			continue
+		}
+
+		data := hooks.Data{Item: m.Item, File: f.Local, Quality: m.Quality}
+		if info, err := os.Stat(f.Local); err == nil {
+			data.Size = info.Size()
+		}
+		runHooks(hooks.EventDownloaded, data)
+	}
+}
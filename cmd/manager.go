@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// manager carries out the commands of the Telegram chats through the runner and the download queue
+type manager struct {
+	repo   *storage.MediaRepository
+	runner *state.Runner
+	queue  *download.Queue
+	scrape func(item media.SearchItem) ([]storage.Magnet, error)
+}
+
+func newManager(c config.Config, repo *storage.MediaRepository, runner *state.Runner, queue *download.Queue, blocklist *magnet.Blocklist) *manager {
+	profiles, err := qualityProfiles(c)
+	if err != nil {
+		logrus.Fatalf("invalid quality profiles: %s", err)
+	}
+
+	// The magnets of a search are only stored once one of them is picked
+	skip := func(m storage.Magnet, reason string) {
+		logrus.Debugf("skipped magnet %s for %q: %s", m.Location, m.Item.Term, reason)
+	}
+	sanity, err := sizeSanity(c, skip)
+	if err != nil {
+		logrus.Fatalf("invalid size sanity bounds: %s", err)
+	}
+	process := processMagnets(profiles, blocklist.Filter(skip), sanity)
+
+	s := scraper(c)
+	return &manager{
+		repo:   repo,
+		runner: runner,
+		queue:  queue,
+		scrape: func(item media.SearchItem) ([]storage.Magnet, error) {
+			magnets, err := s.Scrape(item)
+			if err != nil {
+				return nil, fmt.Errorf("could not scrape %q: %s", item.Term, err)
+			}
+			if item.Type == media.TypeSeason {
+				magnets, _ = magnet.SeasonPacks(item, magnets)
+			}
+			for i := range magnets {
+				magnets[i].Item = item
+			}
+			return process(magnets), nil
+		},
+	}
+}
+
+func (m *manager) Add(item media.SearchItem) error {
+	return m.runner.Add(item)
+}
+
+// Search returns the usable magnets which were stored for the item, or scrapes it if there are none
+func (m *manager) Search(item media.SearchItem) ([]storage.Magnet, error) {
+	stored, err := m.repo.Torrents(item.Term)
+	if err != nil {
+		return nil, err
+	}
+
+	var usable []storage.Magnet
+	for _, t := range stored {
+		if t.FailedReason == "" && t.RejectedReason == "" {
+			usable = append(usable, t)
+		}
+	}
+	if len(usable) > 0 {
+		return usable, nil
+	}
+
+	return m.scrape(item)
+}
+
+func (m *manager) Grab(item media.SearchItem, mag storage.Magnet) error {
+	return m.runner.Grab(item, mag)
+}
+
+func (m *manager) Retry(title string) error {
+	return m.runner.Retry(title)
+}
+
+// Cancel stops the flow of the item, along with its downloads
+func (m *manager) Cancel(title string) error {
+	if err := m.runner.Cancel(title); err != nil {
+		return err
+	}
+	m.queue.Cancel(title)
+	return nil
+}
+
+func (m *manager) Pause() {
+	m.queue.Pause()
+}
+
+func (m *manager) Resume() {
+	m.queue.Resume()
+}
+
+func (m *manager) Paused() bool {
+	return m.queue.Paused()
+}
+
+func (m *manager) Progress() map[string]int {
+	return m.queue.Progress()
+}
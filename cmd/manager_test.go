@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Search(t *testing.T) {
+	testCases := []struct {
+		name     string
+		failed   []string
+		rejected []string
+		magnets  []string
+		scraped  bool
+	}{
+		{
+			name:    "stored magnets",
+			magnets: []string{"magnet-1", "magnet-2", "magnet-3"},
+		},
+		{
+			name:     "without unusable magnets",
+			failed:   []string{"magnet-1"},
+			rejected: []string{"magnet-2"},
+			magnets:  []string{"magnet-3"},
+		},
+		{
+			name:     "scraped when none is usable",
+			failed:   []string{"magnet-1", "magnet-2"},
+			rejected: []string{"magnet-3"},
+			magnets:  []string{"scraped"},
+			scraped:  true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, cleanup := testRepo(t)
+			defer cleanup()
+
+			item := media.NewMovie("Movie", 2019, "tt0123")
+			if err := repo.StoreItem(item); err != nil {
+				t.Fatal(err)
+			}
+			for i, loc := range []string{"magnet-1", "magnet-2", "magnet-3"} {
+				m := storage.Magnet{Location: loc, Item: item, Quality: storage.QualityFHD, Rating: i + 1}
+				for _, r := range tt.rejected {
+					if r == loc {
+						m.RejectedReason = "blocked"
+					}
+				}
+				assert.NoError(t, repo.AddTorrent(m))
+			}
+			for _, loc := range tt.failed {
+				assert.NoError(t, repo.MarkMagnetBad(item.Term, loc, "dead"))
+			}
+
+			scraped := false
+			m := &manager{repo: repo, scrape: func(item media.SearchItem) ([]storage.Magnet, error) {
+				scraped = true
+				return []storage.Magnet{{Location: "scraped", Item: item}}, nil
+			}}
+
+			magnets, err := m.Search(item)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.scraped, scraped)
+
+			var locations []string
+			for _, mag := range magnets {
+				locations = append(locations, mag.Location)
+			}
+			assert.Equal(t, tt.magnets, locations)
+		})
+	}
+}
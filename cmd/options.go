@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/hooks"
+	"github.com/nenad/couch/pkg/magnet"
+)
+
+// downloadWindows returns the windows of the config in which downloads are allowed
+func downloadWindows(windows []config.DownloadWindow) []download.Window {
+	var converted []download.Window
+	for _, w := range windows {
+		converted = append(converted, download.Window(w))
+	}
+	return converted
+}
+
+// rateLimits returns the download speed limits of the config
+func rateLimits(c config.RateLimitConfig) download.RateLimits {
+	limits := download.RateLimits{Global: c.Global, Getters: c.Getters}
+	for _, s := range c.Slots {
+		limits.Slots = append(limits.Slots, download.RateSlot{
+			Window:  download.Window(s.DownloadWindow),
+			Global:  s.Global,
+			Getters: s.Getters,
+		})
+	}
+	return limits
+}
+
+// rateLimitUpdater returns the func which applies the limits of a changed config to the throttle
+func rateLimitUpdater(throttle *download.Throttle) func(config.RateLimitConfig) error {
+	return func(c config.RateLimitConfig) error {
+		return throttle.Update(rateLimits(c))
+	}
+}
+
+// blocklistUpdater returns the func which applies the blocklist of a changed config
+func blocklistUpdater(blocklist *magnet.Blocklist) func(config.BlocklistConfig) error {
+	return func(c config.BlocklistConfig) error {
+		return blocklist.Update(magnet.BlocklistOptions(c))
+	}
+}
+
+// importOptions returns how the downloaded torrents get into the library
+func importOptions(c config.ImportConfig) download.ImportOptions {
+	return download.ImportOptions{
+		StagingPath: c.StagingPath,
+		Mode:        c.Mode,
+		Seed:        download.NewSeedLimits(c.SeedRatio, time.Duration(c.SeedTimeHours)*time.Hour),
+	}
+}
+
+// hookConfigs returns the scripts which are run on the events of the items
+func hookConfigs(confs []config.HookConfig) []hooks.Config {
+	var converted []hooks.Config
+	for _, c := range confs {
+		h := hooks.Config{Name: c.Name, Command: c.Command, Args: c.Args, Timeout: time.Duration(c.TimeoutSeconds) * time.Second}
+		for _, e := range c.Events {
+			h.Events = append(h.Events, hooks.Event(e))
+		}
+		converted = append(converted, h)
+	}
+	return converted
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// qualityProfiles resolves the named profiles of the config, where items without
+// an assigned profile use magnet.DefaultProfile
+func qualityProfiles(c config.Config) (magnet.Profiles, error) {
+	profiles := magnet.Profiles{
+		Default: magnet.DefaultProfile,
+		Types:   make(map[media.Type]magnet.Profile),
+		Items:   make(map[string]magnet.Profile),
+	}
+
+	named := func(name string) (magnet.Profile, error) {
+		p, ok := c.QualityProfiles[name]
+		if !ok {
+			return magnet.Profile{}, fmt.Errorf("unknown quality profile %q", name)
+		}
+		return profile(p), nil
+	}
+
+	var err error
+	if c.Quality.Default != "" {
+		if profiles.Default, err = named(c.Quality.Default); err != nil {
+			return profiles, err
+		}
+	}
+
+	for t, name := range c.Quality.Types {
+		switch media.Type(t) {
+		case media.TypeMovie, media.TypeEpisode, media.TypeSeason:
+		default:
+			return profiles, fmt.Errorf("unknown media type %q", t)
+		}
+
+		if profiles.Types[media.Type(t)], err = named(name); err != nil {
+			return profiles, err
+		}
+	}
+
+	for key, name := range c.Quality.Items {
+		if profiles.Items[key], err = named(name); err != nil {
+			return profiles, err
+		}
+	}
+
+	return profiles, profiles.Validate()
+}
+
+func profile(p config.QualityProfile) magnet.Profile {
+	profile := magnet.Profile{
+		MinQuality: storage.Quality(p.MinQuality),
+		MaxQuality: storage.Quality(p.MaxQuality),
+		MinSize:    p.MinSizeMB * magnet.Megabyte,
+		MaxSize:    p.MaxSizeMB * magnet.Megabyte,
+		MinSeeders: p.MinSeeders,
+		Cutoff:     storage.Quality(p.Cutoff),
+		Weights: magnet.Weights{
+			Quality:  p.Weights.Quality,
+			Encoding: p.Weights.Encoding,
+			Size:     p.Weights.Size,
+			Seeders:  p.Weights.Seeders,
+		},
+	}
+
+	for _, e := range p.Encodings {
+		if e == "unknown" {
+			e = string(storage.EncodingUnknown)
+		}
+		profile.Encodings = append(profile.Encodings, storage.Encoding(e))
+	}
+
+	for _, k := range p.Order {
+		profile.Order = append(profile.Order, magnet.SortKey{By: k.By, Desc: k.Desc})
+	}
+
+	return profile
+}
+
+// sizeSanity returns the filter which rejects torrents with an unexpected size for the
+// runtime of their item, with the defaults overridden by the config
+func sizeSanity(c config.Config, reject magnet.RejectFunc) (magnet.ProcessFunc, error) {
+	if c.SizeSanity.Disabled {
+		return nil, nil
+	}
+
+	bounds := make(magnet.SizeBounds)
+	for q, r := range magnet.DefaultSizeBounds {
+		bounds[q] = r
+	}
+	for q, r := range c.SizeSanity.PerMinuteMB {
+		switch storage.Quality(q) {
+		case storage.QualitySD, storage.QualityHD, storage.QualityFHD, storage.Quality4K:
+		default:
+			return nil, fmt.Errorf("unknown quality %q", q)
+		}
+		bounds[storage.Quality(q)] = magnet.SizeRange{Min: r.Min * magnet.Megabyte, Max: r.Max * magnet.Megabyte}
+	}
+
+	runtimes := make(map[media.Type]time.Duration)
+	for t, r := range magnet.DefaultRuntimes {
+		runtimes[t] = r
+	}
+	for t, minutes := range c.SizeSanity.RuntimeMinutes {
+		switch media.Type(t) {
+		case media.TypeMovie, media.TypeEpisode, media.TypeSeason:
+		default:
+			return nil, fmt.Errorf("unknown media type %q", t)
+		}
+		runtimes[media.Type(t)] = time.Duration(minutes) * time.Minute
+	}
+
+	return magnet.FilterSizePerMinute(bounds, runtimes, reject), nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/sirupsen/logrus"
+)
+
+// renameFunc returns the path of a downloaded file of the magnet
+type renameFunc func(f storage.Download, m storage.Magnet) string
+
+// newRenamer returns the function which names the downloaded files by the rename templates,
+// or nil if renaming is disabled
+func newRenamer(c config.Config) renameFunc {
+	if c.Rename.Disabled {
+		return nil
+	}
+
+	movies, err := media.ParseTemplate(orDefault(c.Rename.Movies, media.DefaultMovieTemplate))
+	if err != nil {
+		logrus.Fatalf("invalid rename template of movies: %s", err)
+	}
+	episodes, err := media.ParseTemplate(orDefault(c.Rename.Episodes, media.DefaultEpisodeTemplate))
+	if err != nil {
+		logrus.Fatalf("invalid rename template of episodes: %s", err)
+	}
+
+	return func(f storage.Download, m storage.Magnet) string {
+		base, template := c.MoviesPath, movies
+		if f.Item.Type == media.TypeEpisode || f.Item.Type == media.TypeSeason {
+			base, template = c.TVShowsPath, episodes
+		}
+
+		fields := f.Item.Fields(f.Local, f.Episodes)
+		fields.Quality = string(m.Quality)
+		if l := subtitles.Language(f.Local); l != "" && subtitles.IsSubtitle(f.Local) {
+			fields.Ext = l + ".srt"
+		}
+
+		return path.Join(base, template.Execute(fields))
+	}
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// renameDownloads moves the downloaded files of the item to the paths given by the rename templates
+func renameDownloads(repo *storage.MediaRepository, rename renameFunc) func([]storage.Download) state.DownloadResult {
+	return func(downloads []storage.Download) state.DownloadResult {
+		if len(downloads) == 0 {
+			return state.DownloadResult{}
+		}
+
+		item, grabbed, files, err := downloadedFiles(repo, downloads)
+		if err != nil {
+			logrus.Errorf("could not rename the files of %q: %s", item.Term, err)
+			return state.DownloadResult{}
+		}
+
+		if _, err := renameFiles(repo, rename, grabbed, files); err != nil {
+			logrus.Errorf("could not rename the files of %q: %s", item.Term, err)
+		}
+
+		return state.DownloadResult{}
+	}
+}
+
+// renameFiles moves the downloaded files of the magnet to the paths given by rename, and returns
+// where all of the files are afterwards. Existing files are replaced.
+func renameFiles(repo *storage.MediaRepository, rename renameFunc, m storage.Magnet, files []storage.Download) ([]string, error) {
+	locations := make([]string, 0, len(files))
+	for _, f := range files {
+		f.Item = m.Item
+		dest := f.Local
+		if rename != nil {
+			dest = rename(f, m)
+		}
+
+		if dest != f.Local {
+			if err := os.MkdirAll(path.Dir(dest), 0755); err != nil {
+				return locations, err
+			}
+			if err := os.Rename(f.Local, dest); err != nil {
+				return locations, err
+			}
+			if err := repo.MoveDownload(f.Remote, dest); err != nil {
+				return locations, fmt.Errorf("could not record the new location of %s: %s", f.Local, err)
+			}
+			logrus.Infof("renamed %s to %s", f.Local, dest)
+		}
+		locations = append(locations, dest)
+	}
+
+	return locations, nil
+}
@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"database/sql"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/nenad/couch/pkg/config"
@@ -29,16 +31,21 @@ func NewCLI(conf config.Config, db *sql.DB) *cobra.Command {
 
 	confStore := &config.Store{DB: db}
 	repo := storage.NewMediaRepository(db)
-	notifier := newNotifier(conf, db)
-	rootCmd.AddCommand(NewAppCommand(conf, repo, notifier))
+	notifier, telegram := newNotifier(conf, db, repo)
+	rootCmd.AddCommand(NewAppCommand(conf, repo, notifier, telegram, confStore))
 	rootCmd.AddCommand(NewAuthCommand(conf, confStore))
 
 	return rootCmd
 }
 
-func newNotifier(conf config.Config, db *sql.DB) notifications.Notifier {
+// newNotifier returns the notifier which dispatches to Telegram, if it has a token, and to the webhooks,
+// along with the Telegram client if there is one
+func newNotifier(conf config.Config, db *sql.DB, repo *storage.MediaRepository) (notifications.Notifier, *notifications.Telegram) {
+	fanout := notifications.NewFanout()
+	addWebhooks(fanout, conf, repo)
+
 	if conf.TelegramBotToken == "" {
-		return &notifications.NoopNotifier{}
+		return fanout, nil
 	}
 
 	bot, err := tgbotapi.NewBotAPI(conf.TelegramBotToken)
@@ -46,12 +53,28 @@ func newNotifier(conf config.Config, db *sql.DB) notifications.Notifier {
 		logrus.Fatalf("error while creating Telegram Bot: %s", err)
 	}
 
-	client := notifications.NewTelegramClient(bot, db)
-	go func() {
-		if err := client.StartListener(); err != nil {
-			logrus.Errorf("could not start Telegram listener: %s", err)
-		}
-	}()
+	client := notifications.NewTelegramClient(bot, db, conf.TelegramChats)
+	if err := fanout.Add(client, conf.Notifications.Telegram); err != nil {
+		logrus.Fatalf("invalid Telegram notifications: %s", err)
+	}
+	return fanout, client
+}
+
+// addWebhooks adds the webhooks to the fanout, which receive the events of the items they want
+func addWebhooks(fanout *notifications.Fanout, c config.Config, repo *storage.MediaRepository) {
+	client := &http.Client{Timeout: time.Second * 30}
 
-	return client
+	for _, conf := range c.Webhooks {
+		w, err := notifications.NewWebhook(client, notifications.WebhookConfig{
+			URL:    conf.URL,
+			Secret: conf.Secret,
+			Retry:  retryPolicy(conf.Retry),
+		}, repo)
+		if err != nil {
+			logrus.Fatalf("invalid webhook: %s", err)
+		}
+		if err := fanout.Add(w, conf.Events); err != nil {
+			logrus.Fatalf("invalid webhook %s: %s", conf.URL, err)
+		}
+	}
 }
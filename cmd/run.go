@@ -8,14 +8,18 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/nenad/couch/pipeline"
+	"github.com/dyrkin/fsm"
 	"github.com/nenad/couch/pkg/config"
 	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/hooks"
 	"github.com/nenad/couch/pkg/magnet"
 	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/mediaserver"
 	"github.com/nenad/couch/pkg/notifications"
-	"github.com/nenad/couch/pkg/refresh"
+	"github.com/nenad/couch/pkg/state"
 	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/nenad/couch/pkg/web"
 	"github.com/nenad/rd"
 	"github.com/nenad/trakt"
 	"github.com/sirupsen/logrus"
@@ -23,56 +27,98 @@ import (
 	"github.com/streadway/handy/retry"
 )
 
-func NewAppCommand(config config.Config, repo *storage.MediaRepository, notifier notifications.Notifier) *cobra.Command {
+func NewAppCommand(config config.Config, repo *storage.MediaRepository, notifier notifications.Notifier, telegram *notifications.Telegram, store config.Saver) *cobra.Command {
 	return &cobra.Command{
 		Use:   "run",
-		Run:   run(config, repo, notifier),
+		Run:   run(config, repo, notifier, telegram, store),
 		Short: "Runs the application",
 		Long:  "Starts a daemon that will download files",
 	}
 }
 
-func run(config config.Config, repo *storage.MediaRepository, notifier notifications.Notifier) func(cmd *cobra.Command, args []string) {
+func run(config config.Config, repo *storage.MediaRepository, notifier notifications.Notifier, telegram *notifications.Telegram, store config.Saver) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
-		stop := make(chan os.Signal)
+		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt, os.Kill, syscall.SIGTERM)
 		logrus.SetOutput(os.Stdout)
 		logrus.SetLevel(logrus.DebugLevel)
 
-		searchItems := pipeline.NewPollStep(repo, pollers(config)).
-			Poll()
-		magnetChan := pipeline.NewScrapeStep(repo, scrapers()).
-			Scrape(searchItems)
-		downloadLocations := pipeline.NewExtractStep(repo, extractor(config, repo), config).
-			Extract(magnetChan)
-		downloadedItems := pipeline.NewDownloadStep(repo, downloader(config, repo), config.ConcurrentDownloadFiles, notifier).
-			Download(downloadLocations)
+		schedule, err := download.NewSchedule(downloadWindows(config.DownloadWindows))
+		if err != nil {
+			logrus.Fatalf("invalid download windows: %s", err)
+		}
+		throttle, err := download.NewThrottle(config.Downloader, rateLimits(config.RateLimit))
+		if err != nil {
+			logrus.Fatalf("invalid rate limit: %s", err)
+		}
 
-		// Periodic pollers
-		go func() {
-			for {
-				if err := refresh.Extract(repo, magnetChan); err != nil {
-					logrus.Errorf("could not refresh database extract: %s", err)
+		blocklist, err := magnet.NewBlocklist(magnet.BlocklistOptions(config.Blocklist))
+		if err != nil {
+			logrus.Fatalf("invalid blocklist: %s", err)
+		}
+
+		queue := download.NewQueue(repo, downloader(config, repo, throttle), config.ConcurrentDownloadFiles, schedule)
+		if len(config.Notifications.Milestones) > 0 {
+			queue.OnProgress(config.Notifications.Milestones, func(dl storage.Download, percent int) {
+				if err := notifier.OnProgress(dl.Item, dl.Local, percent); err != nil {
+					logrus.Warnf("could not notify about the progress of %s: %s", dl.Local, err)
 				}
+			})
+		}
+		go queue.Watch()
 
-				time.Sleep(time.Minute * 10)
+		runHooks := newHookRunner(config, repo, notifier)
+		runner := state.NewRunner(repo, newDispatcher(config, repo, queue, notifier, runHooks, blocklist), retryPolicies(config))
+		runner.OnEvent(func(e state.Event) {
+			if e.Type == state.EventFailed {
+				runHooks(hooks.EventFailed, hooks.Data{Item: e.Item, Error: e.Error.Error()})
 			}
-		}()
+		})
+		if l, ok := notifier.(notifications.EventListener); ok {
+			runner.OnEvent(l.OnEvent)
+		}
+		if err := runner.ResumeAll(); err != nil {
+			logrus.Errorf("could not resume unfinished items: %s", err)
+		}
 
-		go func() {
-			for {
-				if err := refresh.Download(repo, downloadLocations); err != nil {
-					logrus.Errorf("could not refresh database for downloads: %s", err)
+		go watchUpgrades(config, repo, newUpgrader(config, repo, queue, notifier, runHooks, blocklist))
+
+		providers := pollers(config)
+		if telegram != nil {
+			// The items of the commands can be looked up by the providers which are finders as well
+			var finder media.Finder
+			for _, p := range providers {
+				if f, ok := p.(media.Finder); ok {
+					finder = f
+				}
+			}
+			telegram.Manage(repo, newManager(config, repo, runner, queue, blocklist), finder)
+			go func() {
+				if err := telegram.StartListener(); err != nil {
+					logrus.Errorf("could not start Telegram listener: %s", err)
 				}
+			}()
+		}
+
+		for _, provider := range providers {
+			go poll(provider, runner, groupEpisodes(config))
+		}
 
-				time.Sleep(time.Minute * 10)
+		server := web.NewWebServer(config, store, web.Appliers{
+			RateLimit: rateLimitUpdater(throttle),
+			Blocklist: blocklistUpdater(blocklist),
+		}, repo)
+		go func() {
+			if err := server.ListenAndServe(); err != nil {
+				logrus.Errorf("could not start web server: %s", err)
 			}
 		}()
 
-		// Download notifier
+		// Rate limits for the current time slot
 		go func() {
-			for item := range downloadedItems {
-				logrus.Debugf("Downloaded %q", item.Term)
+			for {
+				time.Sleep(time.Minute)
+				throttle.Apply(time.Now())
 			}
 		}()
 
@@ -80,15 +126,134 @@ func run(config config.Config, repo *storage.MediaRepository, notifier notificat
 	}
 }
 
-func scrapers() []magnet.Scraper {
-	rarbgScraper, err := magnet.NewRarbgScraper()
-	if err != nil {
-		logrus.Fatalf("could not initialize rarbg: %s", err)
+// poll fetches new items from the provider periodically, and starts a flow for each of them
+func poll(provider media.Provider, runner *state.Runner, group func([]media.SearchItem) []media.SearchItem) {
+	// TODO Add pauseChan which would stop the polling for a specified provider
+	for {
+		items, err := provider.Poll()
+		if err != nil {
+			logrus.Errorf("could not poll %T: %s", provider, err)
+		}
+
+		for _, item := range group(items) {
+			logrus.Debugf("fetched %q for searching", item.Term)
+			if err := runner.Add(item); err != nil {
+				logrus.Errorf("could not add %q: %s", item.Term, err)
+			}
+		}
+
+		time.Sleep(provider.Interval())
+	}
+}
+
+// defaultMinEpisodes is the number of episodes of a season which are grabbed from a pack by default
+const defaultMinEpisodes = 2
+
+// groupEpisodes returns the function which replaces the episodes of the same season with a season pack
+func groupEpisodes(c config.Config) func([]media.SearchItem) []media.SearchItem {
+	return func(items []media.SearchItem) []media.SearchItem {
+		if c.SeasonPacks.Disabled {
+			return items
+		}
+
+		min := c.SeasonPacks.MinEpisodes
+		if min <= 0 {
+			min = defaultMinEpisodes
+		}
+		return media.GroupEpisodes(items, min)
+	}
+}
+
+func retryPolicies(c config.Config) map[fsm.State]state.RetryPolicy {
+	stages := map[string]fsm.State{
+		"scraping":    state.ScrapingState,
+		"extracting":  state.ExtractingState,
+		"downloading": state.DownloadingState,
 	}
 
-	return []magnet.Scraper{
-		rarbgScraper,
+	policies := make(map[fsm.State]state.RetryPolicy)
+	for name, p := range c.Retry {
+		stage, ok := stages[name]
+		if !ok {
+			logrus.Warnf("unknown stage %q in retry policies", name)
+			continue
+		}
+
+		policies[stage] = retryPolicy(p)
 	}
+
+	return policies
+}
+
+func retryPolicy(p config.RetryPolicy) state.RetryPolicy {
+	return state.RetryPolicy{
+		MaxAttempts: p.MaxAttempts,
+		Backoff:     time.Duration(p.BackoffSeconds) * time.Second,
+		MaxBackoff:  time.Duration(p.MaxBackoffSeconds) * time.Second,
+		Jitter:      p.Jitter,
+	}
+}
+
+// scraperFactories creates the built-in scrapers by their name in the config
+var scraperFactories = map[string]func(c config.Config) (magnet.Scraper, error){
+	"rarbg": func(c config.Config) (magnet.Scraper, error) {
+		s, err := magnet.NewRarbgScraper()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	},
+	"eztv": func(c config.Config) (magnet.Scraper, error) {
+		return magnet.NewEZTVScraper(&http.Client{Timeout: time.Minute}, magnet.EZTVURL), nil
+	},
+	"torznab": func(c config.Config) (magnet.Scraper, error) {
+		if len(c.Torznab) == 0 {
+			return nil, fmt.Errorf("no torznab indexers configured")
+		}
+
+		client := &http.Client{Timeout: time.Minute}
+		var indexers []magnet.Scraper
+		for _, i := range c.Torznab {
+			indexers = append(indexers, magnet.NewTorznabScraper(client, i.URL, i.APIKey))
+		}
+		return magnet.NewMultiScraper(indexers...), nil
+	},
+}
+
+// defaultScrapers are enabled when the config doesn't list any
+var defaultScrapers = []string{"rarbg", "eztv"}
+
+// scraper merges the results of the enabled scrapers in the configured order
+func scraper(c config.Config) magnet.Scraper {
+	names := c.Scrapers
+	if len(names) == 0 {
+		names = defaultScrapers
+		if len(c.Torznab) > 0 {
+			names = append([]string{"torznab"}, names...)
+		}
+	}
+
+	var scrapers []magnet.Scraper
+	for _, name := range names {
+		factory, ok := scraperFactories[name]
+		if !ok {
+			logrus.Warnf("unknown scraper %q", name)
+			continue
+		}
+
+		s, err := factory(c)
+		if err != nil {
+			logrus.Errorf("could not initialize scraper %q: %s", name, err)
+			continue
+		}
+		scrapers = append(scrapers, s)
+	}
+
+	if len(scrapers) == 0 {
+		logrus.Fatalf("no scrapers could be initialized from %v", names)
+	}
+
+	return magnet.NewMultiScraper(scrapers...)
 }
 
 func pollers(c config.Config) []media.Provider {
@@ -118,6 +283,11 @@ func pollers(c config.Config) []media.Provider {
 }
 
 func extractor(c config.Config, r *storage.MediaRepository) magnet.Extractor {
+	files, err := magnet.NewFileSelection(magnet.FileSelectionOptions(c.FileSelection), c.Subtitles.Languages)
+	if err != nil {
+		logrus.Fatalf("invalid file selection: %s", err)
+	}
+
 	switch c.Downloader {
 	case download.TypeHTTP:
 		client := &http.Client{}
@@ -136,20 +306,61 @@ func extractor(c config.Config, r *storage.MediaRepository) magnet.Extractor {
 			rd.NewRealDebrid(createToken(c.RealDebrid), client, rd.AutoRefresh),
 			time.Second*10,
 			false,
+			files,
 		)
 	case download.TypeTorrent:
-		return magnet.NewTorrentExtractor(r)
+		return magnet.NewTorrentExtractor(r, files)
 	default:
 		panic(fmt.Errorf("extractor %s not found", c.Downloader))
 	}
 }
 
-func downloader(c config.Config, r *storage.MediaRepository) download.Getter {
+// subtitleFetcher returns the fetcher of the subtitles missing from the torrents, or nil if there is no provider
+func subtitleFetcher(c config.Config) *subtitles.Fetcher {
+	if len(c.Subtitles.Languages) == 0 || c.Subtitles.Provider == "" {
+		return nil
+	}
+
+	var provider subtitles.Provider
+	switch c.Subtitles.Provider {
+	case "opensubtitles":
+		provider = subtitles.NewOpenSubtitles(&http.Client{Timeout: time.Second * 30}, c.Subtitles.URL, c.Subtitles.APIKey)
+	default:
+		logrus.Fatalf("unknown subtitle provider %q", c.Subtitles.Provider)
+	}
+
+	fetcher, err := subtitles.NewFetcher(provider, c.Subtitles.Languages)
+	if err != nil {
+		logrus.Fatalf("invalid subtitles: %s", err)
+	}
+	return fetcher
+}
+
+// mediaServers returns the clients of the media servers whose libraries are refreshed after downloads
+func mediaServers(c config.Config) []mediaserver.Server {
+	client := &http.Client{Timeout: time.Second * 30}
+
+	var servers []mediaserver.Server
+	for _, conf := range c.MediaServers {
+		s, err := mediaserver.New(client, mediaserver.Config(conf))
+		if err != nil {
+			logrus.Fatalf("invalid media server: %s", err)
+		}
+		servers = append(servers, s)
+	}
+	return servers
+}
+
+func downloader(c config.Config, r *storage.MediaRepository, t *download.Throttle) download.Getter {
 	switch c.Downloader {
 	case download.TypeTorrent:
-		return download.NewTorrentDownloader(r)
+		d := download.NewTorrentDownloader(r, t.Limiter(), importOptions(c.Import))
+		if c.Import.StagingPath != "" {
+			go d.Seed()
+		}
+		return d
 	case download.TypeHTTP:
-		return download.NewHttpDownloader()
+		return download.NewHttpDownloader(t.Limiter())
 	default:
 		panic(fmt.Errorf("downloader %s not found", c.Downloader))
 	}
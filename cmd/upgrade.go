@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/mediaserver"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultUpgradeInterval is used when the config doesn't set how often to look for upgrades
+const defaultUpgradeInterval = time.Hour * 24
+
+// defaultProperWindow is used when the config doesn't set for how long PROPER releases are looked for
+const defaultProperWindow = time.Hour * 24 * 14
+
+// stagingSuffix is appended to new files which would overwrite the old ones before they are complete
+const stagingSuffix = ".upgrade"
+
+// newUpgrader returns the function which upgrades a downloaded item, using the same scrapers,
+// filters and quality profiles as the flows
+func newUpgrader(c config.Config, repo *storage.MediaRepository, queue *download.Queue, notifier notifications.Notifier, runHooks hookRunner, blocklist *magnet.Blocklist) func(m storage.Media) error {
+	profiles, err := qualityProfiles(c)
+	if err != nil {
+		logrus.Fatalf("invalid quality profiles: %s", err)
+	}
+
+	return upgradeItem(c, repo, scraper(c), profiles, rejectFilters(c, repo, blocklist), extractor(c, repo), newRenamer(c), mediaServers(c), runHooks, queue, notifier)
+}
+
+// watchUpgrades periodically searches for better releases of the downloaded items
+func watchUpgrades(c config.Config, repo *storage.MediaRepository, upgrade func(m storage.Media) error) {
+	interval := time.Duration(c.UpgradeIntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = defaultUpgradeInterval
+	}
+
+	for {
+		time.Sleep(interval)
+
+		items, err := repo.Downloaded()
+		if err != nil {
+			logrus.Errorf("could not get downloaded items: %s", err)
+			continue
+		}
+
+		for _, m := range items {
+			if err := upgrade(m); err != nil {
+				logrus.Errorf("could not upgrade %q: %s", m.Item.Term, err)
+			}
+		}
+	}
+}
+
+// wantsProper returns true if the episode was downloaded recently enough to be replaced by a PROPER release
+func wantsProper(c config.Config, m storage.Media, current storage.Magnet) bool {
+	if c.Propers.Disabled || current.Proper || m.DownloadedAt.IsZero() {
+		return false
+	}
+	if m.Item.Type != media.TypeEpisode && m.Item.Type != media.TypeSeason {
+		return false
+	}
+
+	window := time.Duration(c.Propers.WindowDays) * time.Hour * 24
+	if window <= 0 {
+		window = defaultProperWindow
+	}
+
+	return time.Since(m.DownloadedAt) < window
+}
+
+// upgradeItem scrapes the item again if its quality is below the cutoff of its profile, or if it
+// is a recent episode which may get a PROPER release. When a better ranked magnet or a PROPER is
+// found, its files are downloaded next to the old ones, which are only replaced once all new files
+// are complete.
+func upgradeItem(c config.Config, repo *storage.MediaRepository, s magnet.Scraper, profiles magnet.Profiles, filters []magnet.ProcessFunc,
+	extractor magnet.Extractor, rename renameFunc, servers []mediaserver.Server, runHooks hookRunner, queue *download.Queue, notifier notifications.Notifier) func(m storage.Media) error {
+	return func(m storage.Media) error {
+		item := m.Item
+		current, err := repo.GrabbedMagnet(item.Term)
+		if err == sql.ErrNoRows {
+			// Downloaded before the magnets of the files were stored
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not get the downloaded magnet: %s", err)
+		}
+
+		profile := profiles.For(item)
+		upgrade, proper := profile.BelowCutoff(current.Quality), wantsProper(c, m, current)
+		if !upgrade && !proper {
+			return nil
+		}
+
+		logrus.Debugf("looking for a replacement of %q in %s", item.Term, current.Quality)
+		magnets, err := s.Scrape(item)
+		if err != nil {
+			return fmt.Errorf("could not scrape: %s", err)
+		}
+		for _, filter := range filters {
+			if filter != nil {
+				magnets = filter(magnets)
+			}
+		}
+		magnets, err = withoutFailed(repo, item, magnets)
+		if err != nil {
+			return err
+		}
+
+		var better storage.Magnet
+		var reason string
+		var ok bool
+		if upgrade {
+			if better, ok, err = profile.Upgrade(current, magnets); err != nil {
+				return fmt.Errorf("could not rank magnets: %s", err)
+			}
+			reason = fmt.Sprintf("upgraded from %s to %s", current.Quality, better.Quality)
+		}
+		if !ok && proper {
+			ranked, err := profile.Process(magnets)
+			if err != nil {
+				return fmt.Errorf("could not rank magnets: %s", err)
+			}
+			better, ok = magnet.Proper(current, ranked, c.Propers.PreferredGroups)
+			reason = fmt.Sprintf("replaced by the PROPER release %s", better.Name)
+		}
+		if !ok {
+			logrus.Debugf("no replacement found for %q", item.Term)
+			return nil
+		}
+
+		logrus.Infof("%q is being %s with %s", item.Term, reason, better.Location)
+		if err := repo.AddTorrent(better); err != nil {
+			return fmt.Errorf("could not store magnet %s: %s", better.Location, err)
+		}
+		if err := repo.TryMagnet(item.Term, better.Location); err != nil {
+			logrus.Errorf("could not mark magnet %s as tried: %s", better.Location, err)
+		}
+
+		if err := replaceFiles(c, repo, extractor, rename, queue, current, better); err != nil {
+			if bad, ok := err.(badMagnetDownload); ok {
+				if err := repo.MarkMagnetBad(item.Term, bad.magnet, bad.err.Error()); err != nil {
+					logrus.Errorf("could not mark magnet %s as bad: %s", bad.magnet, err)
+				}
+			}
+			if err := repo.RemoveDownloads(item.Term, better.Location); err != nil {
+				logrus.Errorf("could not remove downloads of magnet %s: %s", better.Location, err)
+			}
+			if err := repo.Status(item.Term, storage.StatusDownloaded); err != nil {
+				logrus.Errorf("could not restore status of %q: %s", item.Term, err)
+			}
+			return err
+		}
+
+		// The new files were renamed in place
+		files, err := repo.Files(item.Term, better.Location)
+		if err != nil {
+			logrus.Errorf("could not get the new files of %q for the hooks and media servers: %s", item.Term, err)
+		}
+		runFileHooks(runHooks, better, files)
+		refreshFolders(servers, files)
+
+		if err := notifier.OnReplace(item, reason); err != nil {
+			logrus.Warnf("could not notify about replaced %q: %s", item.Term, err)
+		}
+
+		return nil
+	}
+}
+
+// withoutFailed drops the magnets which turned out to be unusable before
+func withoutFailed(repo *storage.MediaRepository, item media.SearchItem, magnets []storage.Magnet) ([]storage.Magnet, error) {
+	stored, err := repo.Torrents(item.Term)
+	if err != nil {
+		return nil, fmt.Errorf("could not load magnets: %s", err)
+	}
+
+	failed := make(map[string]bool)
+	for _, m := range stored {
+		if m.FailedReason != "" {
+			failed[m.Location] = true
+		}
+	}
+
+	var usable []storage.Magnet
+	for _, m := range magnets {
+		if !failed[m.Location] {
+			usable = append(usable, m)
+		}
+	}
+
+	return usable, nil
+}
+
+// replaceFiles downloads the files of the better magnet, moves them in place, and then
+// removes the files of the current magnet. If it fails, the new files are removed again.
+func replaceFiles(c config.Config, repo *storage.MediaRepository, extractor magnet.Extractor, rename renameFunc, queue *download.Queue, current, better storage.Magnet) (err error) {
+	item := better.Item
+	urls, err := extractor.Extract(better)
+	if magnet.IsBadMagnet(err) {
+		return badMagnetDownload{magnet: better.Location, err: err}
+	}
+	if err != nil {
+		return fmt.Errorf("could not extract link %s: %s", better.Location, err)
+	}
+
+	old, err := repo.Files(item.Term, current.Location)
+	if err != nil {
+		return fmt.Errorf("could not get the downloaded files: %s", err)
+	}
+	oldFiles := make(map[string]bool)
+	for _, f := range old {
+		oldFiles[f.Local] = true
+	}
+
+	var downloads []storage.Download
+	defer func() {
+		if err != nil {
+			removeNewFiles(downloads, oldFiles)
+		}
+	}()
+
+	staged := make(map[string]string)
+	for _, dl := range downloadsOf(c, better, urls) {
+		// The old file must stay usable until the new one is complete
+		if dest := dl.Local; oldFiles[dest] {
+			dl.Local = dest + stagingSuffix
+			staged[dl.Remote] = dest
+		}
+		if err := repo.AddDownload(dl); err != nil {
+			return fmt.Errorf("could not add download: %s", err)
+		}
+		downloads = append(downloads, dl)
+	}
+
+	if err := downloadAll(queue, downloads); err != nil {
+		return err
+	}
+
+	for _, dl := range downloads {
+		dest, ok := staged[dl.Remote]
+		if !ok {
+			continue
+		}
+		if err := os.Rename(dl.Local, dest); err != nil {
+			return fmt.Errorf("could not move %s in place: %s", dl.Local, err)
+		}
+		if err := repo.MoveDownload(dl.Remote, dest); err != nil {
+			return fmt.Errorf("could not record that %s was moved in place: %s", dl.Local, err)
+		}
+	}
+
+	// Renamed files take the place of the old ones with the same name
+	files, err := repo.Files(item.Term, better.Location)
+	if err != nil {
+		return fmt.Errorf("could not get the new files to rename: %s", err)
+	}
+	locations, err := renameFiles(repo, rename, better, files)
+	if err != nil {
+		return fmt.Errorf("could not rename the new files: %s", err)
+	}
+	newFiles := make(map[string]bool)
+	for _, l := range locations {
+		newFiles[l] = true
+	}
+
+	err = repo.ReplaceMagnet(storage.Upgrade{
+		Title:       item.Term,
+		From:        current.Location,
+		To:          better.Location,
+		FromQuality: current.Quality,
+		ToQuality:   better.Quality,
+		UpgradedAt:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("could not record the upgrade: %s", err)
+	}
+
+	for f := range oldFiles {
+		if newFiles[f] {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("could not remove the replaced file %s: %s", f, err)
+		}
+	}
+
+	return nil
+}
+
+// removeNewFiles removes what was downloaded of the new files, while the old files are kept
+func removeNewFiles(downloads []storage.Download, oldFiles map[string]bool) {
+	for _, dl := range downloads {
+		if oldFiles[dl.Local] {
+			continue
+		}
+		if err := os.Remove(dl.Local); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("could not remove the new file %s: %s", dl.Local, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/hooks"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScraper struct {
+	magnets []storage.Magnet
+}
+
+func (s fakeScraper) Scrape(item media.SearchItem) ([]storage.Magnet, error) {
+	return s.magnets, nil
+}
+
+func readFile(t *testing.T, file string) string {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestUpgradeItem(t *testing.T) {
+	bad := &magnet.BadMagnetError{Reason: "torrent has no peers"}
+
+	testCases := []struct {
+		name string
+		// files are the paths of the new files in the torrent, where the failed one gets the error
+		files  []string
+		failed string
+		err    error
+		// staged is where the new video is downloaded to, relative to the movies
+		staged string
+		// contents are the contents of the movies afterwards
+		contents map[string]string
+		upgraded bool
+		bad      bool
+	}{
+		{
+			name:     "same name",
+			files:    []string{"Movie.1080p/Movie.mkv"},
+			staged:   "Movie.mkv" + stagingSuffix,
+			contents: map[string]string{"Movie.mkv": "new", "Movie.mkv" + stagingSuffix: ""},
+			upgraded: true,
+		},
+		{
+			name:     "other name",
+			files:    []string{"Movie.1080p/Movie.1080p.mkv"},
+			staged:   "Movie.1080p.mkv",
+			contents: map[string]string{"Movie.mkv": "", "Movie.1080p.mkv": "new"},
+			upgraded: true,
+		},
+		{
+			name:     "failed download",
+			files:    []string{"Movie.1080p/Movie.mkv"},
+			failed:   "Movie.1080p/Movie.mkv",
+			err:      assert.AnError,
+			staged:   "Movie.mkv" + stagingSuffix,
+			contents: map[string]string{"Movie.mkv": "old", "Movie.mkv" + stagingSuffix: ""},
+		},
+		{
+			name:     "bad magnet",
+			files:    []string{"Movie.1080p/Movie.mkv"},
+			failed:   "Movie.1080p/Movie.mkv",
+			err:      bad,
+			staged:   "Movie.mkv" + stagingSuffix,
+			contents: map[string]string{"Movie.mkv": "old", "Movie.mkv" + stagingSuffix: ""},
+			bad:      true,
+		},
+		{
+			name:     "staged file of a failed upgrade",
+			files:    []string{"Movie.1080p/Movie.mkv", "Movie.1080p/Movie.eng.srt"},
+			failed:   "Movie.1080p/Movie.eng.srt",
+			err:      assert.AnError,
+			staged:   "Movie.mkv" + stagingSuffix,
+			contents: map[string]string{"Movie.mkv": "old", "Movie.mkv" + stagingSuffix: "", "Movie.en.srt": ""},
+		},
+		{
+			name:     "new file of a failed upgrade",
+			files:    []string{"Movie.1080p/Movie.1080p.mkv", "Movie.1080p/Movie.eng.srt"},
+			failed:   "Movie.1080p/Movie.eng.srt",
+			err:      assert.AnError,
+			staged:   "Movie.1080p.mkv",
+			contents: map[string]string{"Movie.mkv": "old", "Movie.1080p.mkv": "", "Movie.1080p.en.srt": ""},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, cleanup := testRepo(t)
+			defer cleanup()
+
+			dir, err := ioutil.TempDir("", "movies")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			item := media.NewMovie("Movie", 2019, "tt0123")
+			current := storage.Magnet{Location: "magnet-old", Item: item, Quality: storage.QualityHD, Encoding: storage.Encodingx264}
+			better := storage.Magnet{Location: "magnet-new", Item: item, Quality: storage.QualityFHD, Encoding: storage.Encodingx264}
+
+			// The item was downloaded from the current magnet
+			old := storage.Download{Remote: "Movie.720p/Movie.mkv", Local: path.Join(dir, "Movie.mkv"), Item: item, Magnet: current.Location}
+			assert.NoError(t, repo.StoreItem(item))
+			assert.NoError(t, repo.AddTorrent(current))
+			assert.NoError(t, repo.AddDownload(old))
+			assert.NoError(t, repo.UpdateDownload(item.Term, old.Remote, true, nil))
+			assert.NoError(t, ioutil.WriteFile(old.Local, []byte("old"), 0644))
+
+			profiles := magnet.Profiles{Default: magnet.DefaultProfile}
+			profiles.Default.Cutoff = storage.QualityFHD
+
+			getter := &fakeGetter{errs: map[string]error{tt.failed: tt.err}, write: func(url, destination string) {
+				// The old file stays until the new one is complete, and the download is stored where it is written to
+				assert.Equal(t, "old", readFile(t, old.Local))
+				pending, err := repo.Downloads(item.Term)
+				assert.NoError(t, err)
+				for _, dl := range pending {
+					if dl.Remote == url {
+						assert.Equal(t, destination, dl.Local)
+					}
+				}
+				assert.NoError(t, ioutil.WriteFile(destination, []byte("new"), 0644))
+			}}
+			schedule, err := download.NewSchedule(nil)
+			assert.NoError(t, err)
+			queue := download.NewQueue(repo, getter, 1, schedule)
+
+			extractor := &fakeExtractor{files: map[string][]string{better.Location: tt.files}}
+			noHooks := func(event hooks.Event, data hooks.Data) {}
+			upgrade := upgradeItem(config.Config{MoviesPath: dir}, repo, fakeScraper{[]storage.Magnet{better}}, profiles, nil,
+				extractor, nil, nil, noHooks, queue, notifications.NewFanout())
+
+			err = upgrade(storage.Media{Item: item})
+			assert.Equal(t, tt.err != nil, err != nil, "unexpected error: %v", err)
+
+			assert.Contains(t, getter.destinations, path.Join(dir, tt.staged))
+			for name, content := range tt.contents {
+				assert.Equal(t, content, readFile(t, path.Join(dir, name)), name)
+			}
+
+			upgrades, err := repo.Upgrades(item.Term)
+			assert.NoError(t, err)
+			oldFiles, err := repo.Files(item.Term, current.Location)
+			assert.NoError(t, err)
+			newFiles, err := repo.Files(item.Term, better.Location)
+			assert.NoError(t, err)
+			pending, err := repo.Downloads(item.Term)
+			assert.NoError(t, err)
+			m, err := repo.Fetch(item.Term)
+			assert.NoError(t, err)
+
+			assert.Equal(t, storage.StatusDownloaded, m.Status)
+			assert.Empty(t, pending)
+			if tt.upgraded {
+				if assert.Len(t, upgrades, 1) {
+					assert.Equal(t, storage.Upgrade{
+						Title:       item.Term,
+						From:        current.Location,
+						To:          better.Location,
+						FromQuality: storage.QualityHD,
+						ToQuality:   storage.QualityFHD,
+						UpgradedAt:  upgrades[0].UpgradedAt,
+					}, upgrades[0])
+				}
+				assert.Empty(t, oldFiles)
+				if assert.Len(t, newFiles, 1) {
+					assert.Equal(t, "new", readFile(t, newFiles[0].Local))
+				}
+			} else {
+				assert.Empty(t, upgrades)
+				assert.Equal(t, []string{old.Remote}, remotes(oldFiles))
+				assert.Empty(t, newFiles)
+			}
+
+			var failed []string
+			if tt.bad {
+				failed = []string{better.Location}
+			}
+			assert.Equal(t, failed, failedMagnets(t, repo, item.Term))
+		})
+	}
+}
@@ -18,4 +18,5 @@ require (
 	github.com/streadway/handy v0.0.0-20190108123426-d5acb3125c2a
 	github.com/stretchr/testify v1.3.0
 	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
 )
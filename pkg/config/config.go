@@ -30,6 +30,295 @@ type Config struct {
 	Trakt      AuthConfig `json:"trakt_tv"`
 
 	TelegramBotToken string `json:"telegram_bot_token"`
+	// TelegramChats are the IDs of the chats which may manage the items through the bot. Only they
+	// may subscribe to the notifications, unless there are none.
+	TelegramChats []int64 `json:"telegram_chats"`
+
+	// Notifications holds which events each notifier is told about
+	Notifications NotificationsConfig `json:"notifications"`
+
+	// Scrapers are the names of the enabled scrapers in order of priority, ex.
+	// "eztv", "rarbg" or "torznab". All built-in scrapers are enabled if none are set.
+	Scrapers []string `json:"scrapers"`
+
+	// Torznab holds the endpoints searched by the "torznab" scraper, in order of priority
+	Torznab []TorznabIndexer `json:"torznab"`
+
+	// DownloadWindows restricts downloading to certain times of the day.
+	// Downloads are always allowed if no windows are configured.
+	DownloadWindows []DownloadWindow `json:"download_windows"`
+
+	// RateLimit caps the download speed, it can be changed without a restart
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	// QualityProfiles holds the named quality profiles, which are assigned to items through Quality
+	QualityProfiles map[string]QualityProfile `json:"quality_profiles"`
+	Quality         QualityAssignment         `json:"quality"`
+
+	// UpgradeIntervalHours is how often the downloaded items below the cutoff of their
+	// quality profile are searched again, every 24 hours if it is not set
+	UpgradeIntervalHours int `json:"upgrade_interval_hours"`
+
+	// SeasonPacks groups the wanted episodes of the same season into a single season item
+	SeasonPacks SeasonPackConfig `json:"season_packs"`
+
+	// Propers replaces recently downloaded episodes by their PROPER or REPACK releases
+	Propers ProperConfig `json:"propers"`
+
+	// SizeSanity rejects torrents which are too small or too big for the runtime of the item
+	SizeSanity SizeSanityConfig `json:"size_sanity"`
+
+	// Blocklist rejects torrents by their source or by keywords in their name,
+	// it can be changed without a restart
+	Blocklist BlocklistConfig `json:"blocklist"`
+
+	// FileSelection skips samples, trailers and other extras in the files of a torrent
+	FileSelection FileSelectionConfig `json:"file_selection"`
+
+	// Import keeps torrents seeding from a staging folder, while their files are put into the library
+	Import ImportConfig `json:"import"`
+
+	// Rename moves the downloaded files to the paths given by the templates
+	Rename RenameConfig `json:"rename"`
+
+	// Subtitles are taken from the torrent, or fetched from a provider after the download
+	Subtitles SubtitlesConfig `json:"subtitles"`
+
+	// MediaServers are told to scan the folders of the downloaded files
+	MediaServers []MediaServerConfig `json:"media_servers"`
+
+	// Hooks are scripts run on the events of an item
+	Hooks []HookConfig `json:"hooks"`
+
+	// Webhooks receive the events in the lifecycle of the items
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// Retry holds the retry policy of a failing stage, keyed by "scraping",
+	// "extracting" or "downloading"
+	Retry map[string]RetryPolicy `json:"retry"`
+}
+
+// QualityProfile describes which magnets are acceptable, and how they are ranked
+type QualityProfile struct {
+	// MinQuality and MaxQuality bound the allowed qualities: "SD", "HD", "FHD" or "4K"
+	MinQuality string `json:"min_quality"`
+	MaxQuality string `json:"max_quality"`
+	// Encodings are the allowed encodings, ex. "x264", "x265" or "unknown" for releases
+	// without a recognized codec. All are allowed if none are set.
+	Encodings []string `json:"encodings"`
+	// MinSizeMB and MaxSizeMB bound the size of the torrent, zero means unbounded
+	MinSizeMB uint64 `json:"min_size_mb"`
+	MaxSizeMB uint64 `json:"max_size_mb"`
+	// MinSeeders drops the torrents with less seeders
+	MinSeeders int `json:"min_seeders"`
+	// Order sorts the magnets, from the most important key to the least important one.
+	// The magnets are sorted by a score made of Weights if it is empty.
+	Order   []SortKey    `json:"order"`
+	Weights ScoreWeights `json:"weights"`
+	// Cutoff is the quality at which downloaded items stop being upgraded, ex. "FHD".
+	// Downloaded items are never upgraded if it is empty.
+	Cutoff string `json:"cutoff"`
+}
+
+// ScoreWeights are the importance of each factor in the score of a torrent
+type ScoreWeights struct {
+	Quality  float64 `json:"quality"`
+	Encoding float64 `json:"encoding"`
+	Size     float64 `json:"size"`
+	Seeders  float64 `json:"seeders"`
+}
+
+// SortKey orders the magnets by "quality", "encoding" or "size"
+type SortKey struct {
+	By   string `json:"by"`
+	Desc bool   `json:"desc"`
+}
+
+// QualityAssignment assigns quality profiles by their names. The profile of an
+// individual item is preferred over the one of its type, which is preferred over the default.
+type QualityAssignment struct {
+	Default string `json:"default"`
+	// Types is keyed by the type of media: "Movie", "Episode" or "Season"
+	Types map[string]string `json:"types"`
+	// Items is keyed by the IMDb identifier, the search term, or the name of the TV show
+	Items map[string]string `json:"items"`
+}
+
+// SeasonPackConfig sets when episodes are downloaded from a season pack
+type SeasonPackConfig struct {
+	Disabled bool `json:"disabled"`
+	// MinEpisodes is the number of episodes of a season which are grabbed from a pack, 2 if not set
+	MinEpisodes int `json:"min_episodes"`
+}
+
+// ProperConfig sets which PROPER and REPACK releases replace the downloaded files
+type ProperConfig struct {
+	Disabled bool `json:"disabled"`
+	// WindowDays is for how long after downloading an episode its PROPER is looked for, 14 if not set
+	WindowDays int `json:"window_days"`
+	// PreferredGroups are accepted besides the group of the downloaded release
+	PreferredGroups []string `json:"preferred_groups"`
+}
+
+// SizeSanityConfig overrides the default size bounds, which are used for every quality profile
+type SizeSanityConfig struct {
+	Disabled bool `json:"disabled"`
+	// PerMinuteMB holds the allowed megabytes per minute of runtime, keyed by quality
+	PerMinuteMB map[string]SizeRange `json:"per_minute_mb"`
+	// RuntimeMinutes is used for items whose runtime is unknown, keyed by the type of media
+	RuntimeMinutes map[string]int `json:"runtime_minutes"`
+}
+
+// BlocklistConfig holds the blocked sources and keywords. The defaults are used
+// when a list is missing, while an empty list blocks nothing.
+type BlocklistConfig struct {
+	// Sources are ex. "CAM", "TS", "TC" or "SCR"
+	Sources []string `json:"sources"`
+	// Keywords are matched as whole words of the release name, ignoring case
+	Keywords []string `json:"keywords"`
+}
+
+// FileSelectionConfig holds which files of a torrent are skipped. The defaults are used
+// when a list is missing, while an empty list skips nothing.
+type FileSelectionConfig struct {
+	// ExcludedWords are matched as whole words of the file name, ignoring case
+	ExcludedWords []string `json:"excluded_words"`
+	// ExcludedFolders skip the files in folders with these names, ignoring case
+	ExcludedFolders []string `json:"excluded_folders"`
+	// MinSizePercent skips files smaller than this percent of the biggest video file, 10 if not set
+	MinSizePercent int `json:"min_size_percent"`
+}
+
+// ImportConfig holds how files downloaded by the torrent downloader get into the library
+type ImportConfig struct {
+	// StagingPath is where the torrents are downloaded and seeded from, files are moved
+	// into the library right away if it is empty
+	StagingPath string `json:"staging_path"`
+	// Mode is "hardlink", which copies when the library is on another file system, "copy", or
+	// "move", which stops seeding. The default is "hardlink".
+	Mode string `json:"mode"`
+	// SeedRatio and SeedTimeHours stop seeding once either of them is reached, where zero is
+	// unlimited. When both are zero, torrents are seeded up to a ratio of 1 or for two weeks.
+	SeedRatio     float64 `json:"seed_ratio"`
+	SeedTimeHours int     `json:"seed_time_hours"`
+}
+
+// RenameConfig holds the templates of the paths of the downloaded files, relative to the
+// download folder of movies or TV shows. The defaults are used when a template is empty.
+type RenameConfig struct {
+	Disabled bool   `json:"disabled"`
+	Movies   string `json:"movies"`
+	Episodes string `json:"episodes"`
+}
+
+// SubtitlesConfig holds the wanted languages of the subtitles, and where they are fetched from
+type SubtitlesConfig struct {
+	// Languages are ISO 639-1 codes, ex. "en" or "de", no subtitles are fetched if empty
+	Languages []string `json:"languages"`
+	// Provider is queried for the subtitles missing from the torrent, ex. "opensubtitles", or none if empty
+	Provider string `json:"provider"`
+	APIKey   string `json:"api_key"`
+	// URL overrides the address of the provider's API
+	URL string `json:"url"`
+}
+
+// MediaServerConfig holds how to reach a media server whose library is refreshed after downloads
+type MediaServerConfig struct {
+	// Type is "plex", "jellyfin", "emby" or "kodi"
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Token is the X-Plex-Token of Plex, or the API key of Jellyfin and Emby
+	Token string `json:"token"`
+	// Username and Password are used by Kodi
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Paths maps the prefixes of local paths to the paths the server sees, ex. when it runs in a container
+	Paths map[string]string `json:"paths"`
+}
+
+// HookConfig holds a script and the events it is run on
+type HookConfig struct {
+	// Name identifies the hook in the logs and notifications, the command is used if it is empty
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// Events are "queued", "downloaded" or "failed", the hook is run on all of them if empty
+	Events []string `json:"events"`
+	// TimeoutSeconds stops the script once it runs for longer, 300 if zero
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// NotificationsConfig holds the events of the notifiers, where webhooks have their own
+type NotificationsConfig struct {
+	// Telegram are the events sent to Telegram, ex. "failed" or "progress", all of them if empty
+	Telegram []string `json:"telegram"`
+	// Milestones are the percentages of a downloaded file which are notified about, ex. [50],
+	// there are no progress notifications if empty
+	Milestones []int `json:"milestones"`
+}
+
+// WebhookConfig holds where the events are posted, and how they are signed
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Secret signs the payloads with HMAC-SHA256, they are not signed if it is empty
+	Secret string `json:"secret"`
+	// Events are the names of the events which are posted, ex. "downloaded" or "progress", all of them if empty
+	Events []string `json:"events"`
+	// Retry is how failed deliveries are retried, 5 times starting after 10 seconds if not set
+	Retry RetryPolicy `json:"retry"`
+}
+
+// SizeRange bounds a size, where zero means unbounded
+type SizeRange struct {
+	Min uint64 `json:"min"`
+	Max uint64 `json:"max"`
+}
+
+// TorznabIndexer is a Torznab endpoint, ex. an indexer in Jackett or Prowlarr
+type TorznabIndexer struct {
+	Name string `json:"name"`
+	// URL is the address of the endpoint without the trailing "/api"
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+}
+
+// RetryPolicy describes how many times and how often a failed stage is retried
+type RetryPolicy struct {
+	MaxAttempts int `json:"max_attempts"`
+	// BackoffSeconds is the delay before the first retry, doubled with every next one
+	BackoffSeconds    int     `json:"backoff_seconds"`
+	MaxBackoffSeconds int     `json:"max_backoff_seconds"`
+	Jitter            float64 `json:"jitter"`
+}
+
+// DownloadWindow is a period of the day when downloads are allowed to run
+type DownloadWindow struct {
+	// Days on which the window applies, ex. "mon", "weekdays" or "weekends".
+	// The window applies to every day if no days are set.
+	Days []string `json:"days"`
+	// From and To are formatted as "15:04". If To is before From, the window
+	// spans over midnight into the next day.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RateLimitConfig holds download speed limits in bytes per second, where zero
+// means the speed is not limited
+type RateLimitConfig struct {
+	// Global is shared by all downloads
+	Global int64 `json:"global"`
+	// Getters holds limits for a specific downloader type, ex. "http" or "torrent"
+	Getters map[string]int64 `json:"getters"`
+	// Slots override the limits during the given periods of the day. The
+	// first slot matching the current time is used.
+	Slots []RateLimitSlot `json:"slots"`
+}
+
+// RateLimitSlot is a set of limits applied during a download window
+type RateLimitSlot struct {
+	DownloadWindow
+	Global  int64            `json:"global"`
+	Getters map[string]int64 `json:"getters"`
 }
 
 func InitConfiguration(store Loader) (conf Config, err error) {
@@ -26,6 +26,14 @@ func (f *Info) Progress() float64 {
 	return float64(f.DownloadedBytes) / float64(f.TotalBytes)
 }
 
+// Percent returns the whole percentage of the file which is downloaded, zero if its size is unknown
+func (f *Info) Percent() int {
+	if f.TotalBytes == 0 {
+		return 0
+	}
+	return int(f.DownloadedBytes * 100 / f.TotalBytes)
+}
+
 // Progress returns the progress of the file from 0 to 1
 func (f *Info) ProgressBytes() string {
 	return byteCountDecimal(f.DownloadedBytes) + " / " + byteCountDecimal(f.TotalBytes)
@@ -39,6 +47,12 @@ type Informer interface {
 	Info() *Info
 }
 
+// Pauser is implemented by transfers which can be suspended and continued later
+type Pauser interface {
+	Pause() error
+	Resume() error
+}
+
 func byteCountDecimal(b int64) string {
 	const unit = 1000
 	if b < unit {
@@ -2,21 +2,52 @@ package download
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"sync"
+	"time"
 
 	"github.com/anacrolix/torrent"
 	torStorage "github.com/anacrolix/torrent/storage"
+	"github.com/nenad/couch/pkg/magnet"
 	"github.com/nenad/couch/pkg/media"
 	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
+// seedInterval is how often the seeded torrents are checked against the seed limits
+const seedInterval = time.Minute
+
+// stallTimeout is how long a torrent may be without peers and progress before its magnet is bad
+const stallTimeout = 10 * time.Minute
+
 type torrentDownloader struct {
-	repo *storage.MediaRepository
+	repo    *storage.MediaRepository
+	limiter *rate.Limiter
+	opts    ImportOptions
+
+	mu    sync.Mutex
+	seeds map[string]*seed
 }
 
-func NewTorrentDownloader(repo *storage.MediaRepository) *torrentDownloader {
+// seed is a file which is seeded by its own client
+type seed struct {
+	storage.Seed
+	client  *torrent.Client
+	torrent *torrent.Torrent
+	// uploaded is what was uploaded before the client was started
+	uploaded int64
+}
+
+// NewTorrentDownloader returns a getter for torrent files, with all torrents sharing the limiter. With
+// a staging folder, the files are downloaded into it and imported into the library, while they are seeded.
+func NewTorrentDownloader(repo *storage.MediaRepository, limiter *rate.Limiter, opts ImportOptions) *torrentDownloader {
 	return &torrentDownloader{
-		repo: repo,
+		repo:    repo,
+		limiter: limiter,
+		opts:    opts,
+		seeds:   make(map[string]*seed),
 	}
 }
 
@@ -24,23 +55,30 @@ type torrentStatus struct {
 	file     *torrent.File
 	item     media.SearchItem
 	filepath string
+	// complete is called once, when the file is downloaded
+	complete func() error
+
+	mu   sync.Mutex
+	done *Info
+	// importing is set while the downloaded file is put into the library
+	importing bool
+	paused    bool
+	// active is when the torrent last had peers or downloaded new bytes
+	active    time.Time
+	completed int64
 }
 
 func (s *torrentStatus) Info() *Info {
-	var err error
-	if s.file.Torrent().Stats().TotalPeers == 0 {
-		err = fmt.Errorf("torrent for %q has no seeders", s.item.Term)
-	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	done := false
-	if err != nil {
-		done = true
+	// The torrent may be dropped once the file is complete
+	if s.done != nil {
+		return s.done
 	}
 
-	pieces := s.file.State()
-
 	var total, completed int64
-	for _, p := range pieces {
+	for _, p := range s.file.State() {
 		total += p.Bytes
 
 		if p.Complete {
@@ -48,42 +86,86 @@ func (s *torrentStatus) Info() *Info {
 		}
 	}
 
-	if total == completed {
-		done = true
-	}
-
-	return &Info{
+	info := &Info{
 		Url:             s.file.Path(),
-		Error:           err,
-		IsDone:          done,
 		TotalBytes:      total,
 		DownloadedBytes: completed,
 		Filepath:        s.filepath,
 		Item:            s.item,
 	}
+
+	// Copying the file may take a while, so it isn't done until it is imported
+	if total == completed {
+		if !s.importing {
+			s.importing = true
+			go s.finish(*info)
+		}
+		return info
+	}
+
+	now := time.Now()
+	if s.paused || s.active.IsZero() || completed > s.completed || s.file.Torrent().Stats().TotalPeers > 0 {
+		s.active = now
+	}
+	s.completed = completed
+
+	if now.Sub(s.active) > stallTimeout {
+		info.Error = &magnet.BadMagnetError{Reason: fmt.Sprintf("torrent for %q has had no peers for %s", s.item.Term, stallTimeout)}
+		info.IsDone = true
+	}
+
+	return info
+}
+
+// finish puts the downloaded file into the library, after which it is done
+func (s *torrentStatus) finish(info Info) {
+	info.IsDone = true
+	info.Error = s.complete()
+
+	s.mu.Lock()
+	s.done = &info
+	s.mu.Unlock()
+}
+
+// Pause stops requesting pieces of the file, while the torrent stays connected
+func (s *torrentStatus) Pause() error {
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+
+	s.file.SetPriority(torrent.PiecePriorityNone)
+	return nil
+}
+
+// Resume continues requesting the pieces of the file
+func (s *torrentStatus) Resume() error {
+	s.mu.Lock()
+	s.paused = false
+	s.active = time.Now()
+	s.mu.Unlock()
+
+	s.file.Download()
+	return nil
 }
 
 func (d *torrentDownloader) Get(item media.SearchItem, url string, destination string) (Informer, error) {
-	magnet, err := d.repo.GetAvailableMagnet(item.Term)
+	// Files of an upgrade come from another magnet than the best available one
+	magnet, err := d.repo.DownloadMagnet(url)
+	if err != nil || magnet == "" {
+		magnet, err = d.repo.GetAvailableMagnet(item.Term)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("could not get first available torrent: %s", err)
 	}
 
-	destFolder := path.Dir(destination)
-
-	completion, err := torStorage.NewSqlitePieceCompletion(destFolder)
-	if err != nil {
-		return nil, fmt.Errorf("could not initialize sqlite completion db: %s", err)
+	folder := path.Dir(destination)
+	if d.opts.StagingPath != "" {
+		folder = d.opts.StagingPath
 	}
 
-	// TODO Delete sqlite after download
-	filePather := torStorage.NewFileWithCompletion(destFolder, completion)
-
-	torrentConf := torrent.NewDefaultClientConfig()
-	torrentConf.DefaultStorage = filePather
-	client, err := torrent.NewClient(torrentConf)
+	client, err := d.client(folder)
 	if err != nil {
-		return nil, fmt.Errorf("coult not set up torrent client: %s", err)
+		return nil, err
 	}
 
 	tor, err := client.AddMagnet(magnet)
@@ -95,9 +177,13 @@ func (d *torrentDownloader) Get(item media.SearchItem, url string, destination s
 	<-tor.GotInfo()
 	for _, f := range tor.Files() {
 		if f.Path() == url {
+			source := path.Join(folder, f.Path())
 			status.file = f
 			status.item = item
 			status.filepath = destination
+			status.complete = func() error {
+				return d.complete(client, tor, magnet, source, destination, f.Length())
+			}
 
 			f.Download()
 			break
@@ -106,3 +192,158 @@ func (d *torrentDownloader) Get(item media.SearchItem, url string, destination s
 
 	return &status, err
 }
+
+// client returns a torrent client which stores the torrents in the folder
+func (d *torrentDownloader) client(folder string) (*torrent.Client, error) {
+	completion, err := torStorage.NewSqlitePieceCompletion(folder)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize sqlite completion db: %s", err)
+	}
+
+	// TODO Delete sqlite after download
+	filePather := torStorage.NewFileWithCompletion(folder, completion)
+
+	torrentConf := torrent.NewDefaultClientConfig()
+	torrentConf.DefaultStorage = filePather
+	torrentConf.DownloadRateLimiter = d.limiter
+	torrentConf.Seed = d.opts.StagingPath != ""
+	client, err := torrent.NewClient(torrentConf)
+	if err != nil {
+		return nil, fmt.Errorf("coult not set up torrent client: %s", err)
+	}
+	return client, nil
+}
+
+// complete puts the downloaded file into the library. Without a staging folder, or when
+// the file is moved, the torrent is stopped, and otherwise it keeps seeding.
+func (d *torrentDownloader) complete(client *torrent.Client, tor *torrent.Torrent, magnet, source, destination string, size int64) error {
+	if d.opts.StagingPath == "" || d.opts.Mode == ImportMove {
+		tor.Drop()
+		if err := moveFile(source, destination); err != nil {
+			return fmt.Errorf("could not move %s to %s: %s", source, destination, err)
+		}
+		return nil
+	}
+
+	if err := Import(d.opts.Mode, source, destination); err != nil {
+		tor.Drop()
+		return fmt.Errorf("could not import %s to %s: %s", source, destination, err)
+	}
+
+	s := storage.Seed{File: source, Magnet: magnet, Size: size, StartedAt: time.Now()}
+	if err := d.repo.AddSeed(s); err != nil {
+		logrus.Errorf("could not store the seed of %s: %s", source, err)
+	}
+
+	d.mu.Lock()
+	d.seeds[source] = &seed{Seed: s, client: client, torrent: tor}
+	d.mu.Unlock()
+
+	return nil
+}
+
+// Seed resumes seeding the files which were seeded before, and then periodically stops seeding
+// the files which reached the seed limits and removes them from the staging folder
+func (d *torrentDownloader) Seed() {
+	stored, err := d.repo.Seeds()
+	if err != nil {
+		logrus.Errorf("could not get the seeded files: %s", err)
+	}
+	for _, s := range stored {
+		if err := d.resume(s); err != nil {
+			logrus.Warnf("could not resume seeding %s: %s", s.File, err)
+		}
+	}
+
+	for {
+		d.checkSeeds(time.Now())
+		time.Sleep(seedInterval)
+	}
+}
+
+// resume seeds the file again after a restart, as long as it is still in the staging folder
+func (d *torrentDownloader) resume(s storage.Seed) error {
+	if _, err := os.Stat(s.File); err != nil {
+		return d.repo.RemoveSeed(s.File)
+	}
+
+	client, err := d.client(d.opts.StagingPath)
+	if err != nil {
+		return err
+	}
+	tor, err := client.AddMagnet(s.Magnet)
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("could not add magnet: %s", err)
+	}
+
+	// Waiting for the info of every torrent would delay the others
+	go func() {
+		select {
+		case <-tor.GotInfo():
+		case <-time.After(time.Minute * 10):
+			logrus.Warnf("could not get torrent info to seed %s", s.File)
+			client.Close()
+			return
+		}
+
+		for _, f := range tor.Files() {
+			if path.Join(d.opts.StagingPath, f.Path()) == s.File {
+				f.Download()
+			}
+		}
+
+		d.mu.Lock()
+		d.seeds[s.File] = &seed{Seed: s, client: client, torrent: tor, uploaded: s.Uploaded}
+		d.mu.Unlock()
+	}()
+
+	return nil
+}
+
+// checkSeeds stores the uploaded bytes of every seed, and removes the ones which reached the seed limits
+func (d *torrentDownloader) checkSeeds(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for file, s := range d.seeds {
+		stats := s.torrent.Stats()
+		uploaded := s.uploaded + stats.BytesWrittenData.Int64()
+		if err := d.repo.UpdateSeed(file, uploaded); err != nil {
+			logrus.Errorf("could not update the seed of %s: %s", file, err)
+		}
+
+		if !d.opts.Seed.Reached(uploaded, s.Size, now.Sub(s.StartedAt)) {
+			continue
+		}
+
+		logrus.Infof("stopped seeding %s after uploading %s", file, byteCountDecimal(uploaded))
+		s.torrent.Drop()
+		s.client.Close()
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("could not remove the seeded file %s: %s", file, err)
+		}
+		removeEmptyDirs(file, d.opts.StagingPath)
+		if err := d.repo.RemoveSeed(file); err != nil {
+			logrus.Errorf("could not remove the seed of %s: %s", file, err)
+		}
+		delete(d.seeds, file)
+	}
+}
+
+// moveFile moves the file out of the folder structure of the torrent, and removes the folders
+// of the torrent once they are empty
+func moveFile(source, destination string) error {
+	if source == destination {
+		return nil
+	}
+	if err := os.MkdirAll(path.Dir(destination), 0755); err != nil {
+		return err
+	}
+	if err := renameFile(source, destination); err != nil {
+		return err
+	}
+
+	removeEmptyDirs(source, path.Dir(destination))
+	return nil
+}
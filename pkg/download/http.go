@@ -1,34 +1,49 @@
 package download
 
 import (
+	"sync"
+
 	"github.com/cavaliercoder/grab"
 	"github.com/nenad/couch/pkg/media"
 )
 
 type HttpDownloader struct {
-	grab *grab.Client
+	grab    *grab.Client
+	limiter grab.RateLimiter
 }
 
 type grabFile struct {
+	client  *grab.Client
+	limiter grab.RateLimiter
+	item    media.SearchItem
+
+	mu       sync.RWMutex
 	response *grab.Response
-	item     media.SearchItem
+	paused   bool
 }
 
-func NewHttpDownloader() *HttpDownloader {
+// NewHttpDownloader returns a getter for HTTP links, with all transfers sharing the limiter
+func NewHttpDownloader(limiter grab.RateLimiter) *HttpDownloader {
 	return &HttpDownloader{
-		grab: grab.NewClient(),
+		grab:    grab.NewClient(),
+		limiter: limiter,
 	}
 }
 
 func (f *grabFile) Info() *Info {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	// A paused transfer is cancelled, but it must not be reported as finished
 	var err error
-	if f.response.IsComplete() {
+	isDone := f.response.IsComplete() && !f.paused
+	if isDone {
 		err = f.response.Err()
 	}
 
 	return &Info{
 		Item:            f.item,
-		IsDone:          f.response.IsComplete(),
+		IsDone:          isDone,
 		Error:           err,
 		Filepath:        f.response.Filename,
 		TotalBytes:      f.response.Size,
@@ -37,11 +52,46 @@ func (f *grabFile) Info() *Info {
 	}
 }
 
+// Pause cancels the transfer, leaving the partially downloaded file on disk
+func (f *grabFile) Pause() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.paused || f.response.IsComplete() {
+		return nil
+	}
+
+	f.paused = true
+	_ = f.response.Cancel()
+	return nil
+}
+
+// Resume starts a new request which continues from the partially downloaded file
+func (f *grabFile) Resume() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.paused {
+		return nil
+	}
+
+	req, err := grab.NewRequest(f.response.Filename, f.response.Request.URL().String())
+	if err != nil {
+		return err
+	}
+	req.RateLimiter = f.limiter
+
+	f.response = f.client.Do(req)
+	f.paused = false
+	return nil
+}
+
 func (d *HttpDownloader) Get(item media.SearchItem, url string, destination string) (Informer, error) {
 	req, err := grab.NewRequest(destination, url)
 	if err != nil {
 		return nil, err
 	}
+	req.RateLimiter = d.limiter
 
-	return &grabFile{response: d.grab.Do(req), item: item}, nil
+	return &grabFile{response: d.grab.Do(req), item: item, client: d.grab, limiter: d.limiter}, nil
 }
@@ -0,0 +1,142 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+const (
+	ImportHardlink = "hardlink"
+	ImportCopy     = "copy"
+	ImportMove     = "move"
+
+	defaultSeedRatio = 1
+	defaultSeedTime  = time.Hour * 24 * 14
+)
+
+// SeedLimits decide when a torrent was seeded enough, where zero values are unlimited
+type SeedLimits struct {
+	Ratio float64
+	Time  time.Duration
+}
+
+// ImportOptions hold how the files downloaded by the torrent downloader get into the library
+type ImportOptions struct {
+	// StagingPath is where the torrents are downloaded and seeded from, files are moved
+	// into the library right away if it is empty
+	StagingPath string
+	// Mode is ImportHardlink, ImportCopy or ImportMove
+	Mode string
+	Seed SeedLimits
+}
+
+// NewSeedLimits returns the limits, or the defaults if neither is set
+func NewSeedLimits(ratio float64, seedTime time.Duration) SeedLimits {
+	if ratio <= 0 && seedTime <= 0 {
+		return SeedLimits{Ratio: defaultSeedRatio, Time: defaultSeedTime}
+	}
+
+	return SeedLimits{Ratio: ratio, Time: seedTime}
+}
+
+// Reached returns true once the uploaded bytes reach the ratio of the size, or the file was seeded for long enough
+func (l SeedLimits) Reached(uploaded, size int64, seeding time.Duration) bool {
+	if l.Ratio > 0 && size > 0 && float64(uploaded)/float64(size) >= l.Ratio {
+		return true
+	}
+	return l.Time > 0 && seeding >= l.Time
+}
+
+// partSuffix is appended to a file which is put next to its destination, until it is complete
+const partSuffix = ".part"
+
+// Import puts the file from the staging folder into the library. Hardlinks and moves fall back to
+// copies when the library is on another file system. An existing file at the destination is replaced at
+// once, and is kept if the import fails.
+func Import(mode, source, destination string) error {
+	if err := os.MkdirAll(path.Dir(destination), 0755); err != nil {
+		return err
+	}
+
+	switch mode {
+	case ImportMove:
+		return renameFile(source, destination)
+	case ImportCopy:
+		return copyFile(source, destination)
+	case ImportHardlink, "":
+		if err := linkFile(source, destination); err == nil {
+			return nil
+		}
+		return copyFile(source, destination)
+	default:
+		return fmt.Errorf("unknown import mode %q", mode)
+	}
+}
+
+// linkFile links the file next to the destination first, as a link can't replace an existing file
+func linkFile(source, destination string) error {
+	tmp := destination + partSuffix
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(source, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, destination); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// renameFile renames the file, or copies it and removes the source when the destination is on another file system
+func renameFile(source, destination string) error {
+	err := os.Rename(source, destination)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	if err := copyFile(source, destination); err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
+
+// copyFile copies the file next to the destination first, so an incomplete copy is never in the library
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := destination + partSuffix
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, destination)
+}
+
+// removeEmptyDirs removes the folders of the file up to the root, as long as they are empty
+func removeEmptyDirs(file, root string) {
+	for dir := path.Dir(file); dir != path.Clean(root) && dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
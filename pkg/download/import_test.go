@@ -0,0 +1,211 @@
+package download_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/download"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mode    string
+		seeding bool
+		linked  bool
+		err     bool
+	}{
+		{
+			name:    "hardlink",
+			mode:    download.ImportHardlink,
+			seeding: true,
+			linked:  true,
+		},
+		{
+			name:    "default is hardlink",
+			mode:    "",
+			seeding: true,
+			linked:  true,
+		},
+		{
+			name:    "copy",
+			mode:    download.ImportCopy,
+			seeding: true,
+		},
+		{
+			name: "move",
+			mode: download.ImportMove,
+		},
+		{
+			name:    "unknown mode",
+			mode:    "symlink",
+			seeding: true,
+			err:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "couch-import")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			source := path.Join(dir, "staging", "Show.S01E02.720p", "show.s01e02.mkv")
+			destination := path.Join(dir, "library", "Show", "Season 01", "Show - S01E02.mkv")
+			assert.NoError(t, os.MkdirAll(path.Dir(source), 0755))
+			assert.NoError(t, ioutil.WriteFile(source, []byte("video"), 0644))
+
+			err = download.Import(tc.mode, source, destination)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			content, err := ioutil.ReadFile(destination)
+			assert.NoError(t, err)
+			assert.Equal(t, "video", string(content))
+
+			_, err = os.Stat(source)
+			assert.Equal(t, tc.seeding, err == nil)
+
+			if tc.seeding {
+				sourceInfo, _ := os.Stat(source)
+				destinationInfo, _ := os.Stat(destination)
+				assert.Equal(t, tc.linked, os.SameFile(sourceInfo, destinationInfo))
+			}
+		})
+	}
+}
+
+func TestImport_ReplacesExisting(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mode    string
+		missing bool
+		content string
+		err     bool
+	}{
+		{name: "hardlink", mode: download.ImportHardlink, content: "1080p"},
+		{name: "copy", mode: download.ImportCopy, content: "1080p"},
+		{name: "move", mode: download.ImportMove, content: "1080p"},
+		{name: "failed hardlink", mode: download.ImportHardlink, missing: true, content: "720p", err: true},
+		{name: "failed copy", mode: download.ImportCopy, missing: true, content: "720p", err: true},
+		{name: "failed move", mode: download.ImportMove, missing: true, content: "720p", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "couch-import")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			source := path.Join(dir, "new.mkv")
+			destination := path.Join(dir, "library", "Movie (2019).mkv")
+			if !tc.missing {
+				assert.NoError(t, ioutil.WriteFile(source, []byte("1080p"), 0644))
+			}
+			assert.NoError(t, os.MkdirAll(path.Dir(destination), 0755))
+			assert.NoError(t, ioutil.WriteFile(destination, []byte("720p"), 0644))
+
+			err = download.Import(tc.mode, source, destination)
+			assert.Equal(t, tc.err, err != nil, "unexpected error: %v", err)
+
+			content, err := ioutil.ReadFile(destination)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.content, string(content))
+
+			files, err := ioutil.ReadDir(path.Dir(destination))
+			assert.NoError(t, err)
+			assert.Len(t, files, 1)
+		})
+	}
+}
+
+func TestImport_MoveAcrossFileSystems(t *testing.T) {
+	// The memory file system is usually another one than the temporary folder
+	staging, err := ioutil.TempDir("/dev/shm", "couch-staging")
+	if err != nil {
+		t.Skipf("no memory file system: %s", err)
+	}
+	defer os.RemoveAll(staging)
+	library, err := ioutil.TempDir("", "couch-library")
+	assert.NoError(t, err)
+	defer os.RemoveAll(library)
+
+	source := path.Join(staging, "movie.mkv")
+	destination := path.Join(library, "Movie (2019).mkv")
+	assert.NoError(t, ioutil.WriteFile(source, []byte("video"), 0644))
+
+	assert.NoError(t, download.Import(download.ImportMove, source, destination))
+
+	content, err := ioutil.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "video", string(content))
+	_, err = os.Stat(source)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSeedLimits_Reached(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ratio    float64
+		time     time.Duration
+		uploaded int64
+		seeding  time.Duration
+		reached  bool
+	}{
+		{
+			name:     "default ratio",
+			uploaded: 100,
+			seeding:  time.Hour,
+			reached:  true,
+		},
+		{
+			name:     "default time",
+			uploaded: 10,
+			seeding:  time.Hour * 24 * 14,
+			reached:  true,
+		},
+		{
+			name:     "below defaults",
+			uploaded: 99,
+			seeding:  time.Hour * 24 * 13,
+		},
+		{
+			name:     "ratio only",
+			ratio:    2,
+			uploaded: 150,
+			seeding:  time.Hour * 24 * 365,
+		},
+		{
+			name:     "ratio reached",
+			ratio:    1.5,
+			uploaded: 150,
+			reached:  true,
+		},
+		{
+			name:     "time only",
+			time:     time.Hour * 24,
+			uploaded: 1000,
+			seeding:  time.Hour * 23,
+		},
+		{
+			name:    "time reached",
+			time:    time.Hour * 24,
+			seeding: time.Hour * 24,
+			reached: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limits := download.NewSeedLimits(tc.ratio, tc.time)
+			assert.Equal(t, tc.reached, limits.Reached(tc.uploaded, 100, tc.seeding))
+		})
+	}
+}
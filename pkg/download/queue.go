@@ -0,0 +1,293 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// Queue limits the number of concurrent downloads, and keeps them within the download windows
+type Queue struct {
+	repo   *storage.MediaRepository
+	getter Getter
+
+	mu        sync.Mutex
+	informers map[Informer]storage.Download
+	maxDL     chan struct{}
+
+	schedule *Schedule
+	paused   bool
+	// held is set while the downloads are paused by hand
+	held bool
+	// cancelled holds when the downloads of each item were cancelled
+	cancelled map[string]time.Time
+
+	milestones []int
+	progress   func(dl storage.Download, percent int)
+}
+
+func NewQueue(repo *storage.MediaRepository, getter Getter, maxDownloads int, schedule *Schedule) *Queue {
+	return &Queue{
+		repo:      repo,
+		getter:    getter,
+		maxDL:     make(chan struct{}, maxDownloads),
+		informers: make(map[Informer]storage.Download),
+		schedule:  schedule,
+		cancelled: make(map[string]time.Time),
+	}
+}
+
+// Pause suspends the active downloads, and keeps the queued ones from starting until Resume is called
+func (q *Queue) Pause() {
+	q.mu.Lock()
+	q.held = true
+	q.mu.Unlock()
+	q.applySchedule()
+}
+
+// Resume continues the downloads which were paused by Pause, within the download windows
+func (q *Queue) Resume() {
+	q.mu.Lock()
+	q.held = false
+	q.mu.Unlock()
+	q.applySchedule()
+}
+
+// Paused returns true if the downloads were paused by Pause
+func (q *Queue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.held
+}
+
+// Cancel stops the downloads of the item which were queued so far, where the active ones are paused
+// and return an error
+func (q *Queue) Cancel(title string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cancelled[title] = time.Now()
+}
+
+// isCancelled returns true if the downloads of the item were cancelled after the given time
+func (q *Queue) isCancelled(title string, queued time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	at, ok := q.cancelled[title]
+	return ok && !at.Before(queued)
+}
+
+// Progress returns the downloaded percentage of the active downloads, by their remote location
+func (q *Queue) Progress() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	progress := make(map[string]int)
+	for informer, dl := range q.informers {
+		progress[dl.Remote] = informer.Info().Percent()
+	}
+	return progress
+}
+
+// OnProgress sets the callback which is invoked once for each of the milestones, in percent, which a
+// download passes. Milestones which were passed before the download started are skipped.
+func (q *Queue) OnProgress(milestones []int, fn func(dl storage.Download, percent int)) {
+	sorted := append([]int(nil), milestones...)
+	sort.Ints(sorted)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.milestones = sorted
+	q.progress = fn
+}
+
+// Download blocks until the file is downloaded, or the download fails
+func (q *Queue) Download(dl storage.Download) (*Info, error) {
+	queued := time.Now()
+
+	// Acquire a token or wait until one is available
+	q.maxDL <- struct{}{}
+	defer func() { <-q.maxDL }()
+
+	// Do not start anything outside of the download windows
+	q.waitForWindow(dl, queued)
+	if q.isCancelled(dl.Item.Term, queued) {
+		return nil, fmt.Errorf("download of %q was cancelled", dl.Remote)
+	}
+
+	logrus.Debugf("started download for %q", dl.Remote)
+	informer, err := q.getter.Get(dl.Item, dl.Remote, dl.Local)
+	if err != nil {
+		return nil, fmt.Errorf("error during download: %s", err)
+	}
+
+	info := informer.Info()
+	if err := q.repo.UpdateDownload(dl.Item.Term, dl.Remote, info.IsDone, info.Error); err != nil {
+		logrus.Errorf("could not update status before download: %s", err)
+	}
+
+	q.mu.Lock()
+	q.informers[informer] = dl
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.informers, informer)
+		q.mu.Unlock()
+	}()
+
+	q.mu.Lock()
+	milestones, progress := q.milestones, q.progress
+	q.mu.Unlock()
+
+	// A resumed download doesn't pass the milestones again
+	next := passed(milestones, info.Percent())
+	for !info.IsDone {
+		time.Sleep(time.Second * 5)
+		if q.isCancelled(dl.Item.Term, queued) {
+			if pauser, ok := informer.(Pauser); ok {
+				if err := pauser.Pause(); err != nil {
+					logrus.Errorf("could not stop the cancelled download %q: %s", dl.Remote, err)
+				}
+			}
+			return info, fmt.Errorf("download of %q was cancelled", dl.Remote)
+		}
+
+		info = informer.Info()
+		if progress == nil || info.IsDone {
+			continue
+		}
+
+		for percent := info.Percent(); next < len(milestones) && milestones[next] <= percent; next++ {
+			progress(dl, milestones[next])
+		}
+	}
+
+	if err := q.repo.UpdateDownload(dl.Item.Term, dl.Remote, info.IsDone, info.Error); err != nil {
+		logrus.Errorf("could not update status after download: %s", err)
+	}
+
+	if info.Error != nil {
+		return info, fmt.Errorf("error while downloading %q: %s", dl.Item.Term, info.Error)
+	}
+
+	logrus.Debugf("completed download for %q", dl.Remote)
+	return info, nil
+}
+
+// passed returns the index of the first milestone which is above the percent
+func passed(milestones []int, percent int) int {
+	i := 0
+	for i < len(milestones) && milestones[i] <= percent {
+		i++
+	}
+	return i
+}
+
+// Watch pauses and resumes the active downloads according to the schedule,
+// and prints their progress when SIGUSR1 is received
+func (q *Queue) Watch() {
+	infoChan := make(chan os.Signal, 1)
+	signal.Notify(infoChan, syscall.SIGUSR1)
+
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.applySchedule()
+		case <-infoChan:
+			q.mu.Lock()
+			for informer := range q.informers {
+				info := informer.Info()
+				fmt.Printf("Progress of %s is %s\n", info.Filepath, info.ProgressBytes())
+				fmt.Printf("  -> %d/%d (%.2f%%)\n", info.DownloadedBytes, info.TotalBytes, info.Progress()*100)
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// open returns true if the schedule allows downloading, and the downloads were not paused by hand
+func (q *Queue) open(now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.held && q.schedule.IsOpen(now)
+}
+
+// waitForWindow blocks until the schedule allows downloading and the downloads are not paused, or
+// the download is cancelled
+func (q *Queue) waitForWindow(dl storage.Download, queued time.Time) {
+	if q.open(time.Now()) {
+		if dl.Paused {
+			if err := q.repo.PauseDownload(dl.Remote, false); err != nil {
+				logrus.Errorf("could not persist resumed download %q: %s", dl.Remote, err)
+			}
+		}
+		return
+	}
+
+	logrus.Infof("download of %q is waiting for the next download window, or to be resumed", dl.Remote)
+	if err := q.repo.PauseDownload(dl.Remote, true); err != nil {
+		logrus.Errorf("could not persist paused download %q: %s", dl.Remote, err)
+	}
+
+	for !q.open(time.Now()) && !q.isCancelled(dl.Item.Term, queued) {
+		time.Sleep(time.Second * 5)
+	}
+
+	if err := q.repo.PauseDownload(dl.Remote, false); err != nil {
+		logrus.Errorf("could not persist resumed download %q: %s", dl.Remote, err)
+	}
+}
+
+// applySchedule pauses active downloads when a download window closes or they are paused by hand,
+// and resumes them once it opens again
+func (q *Queue) applySchedule() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	shouldPause := q.held || !q.schedule.IsOpen(time.Now())
+
+	if shouldPause == q.paused {
+		return
+	}
+	q.paused = shouldPause
+
+	for informer, dl := range q.informers {
+		pauser, ok := informer.(Pauser)
+		if !ok {
+			continue
+		}
+
+		info := informer.Info()
+		if info.IsDone {
+			continue
+		}
+
+		var err error
+		if shouldPause {
+			logrus.Infof("pausing download of %q", dl.Remote)
+			err = pauser.Pause()
+		} else {
+			logrus.Infof("resuming download of %q", dl.Remote)
+			err = pauser.Resume()
+		}
+
+		if err != nil {
+			logrus.Errorf("could not change the state of download %q: %s", dl.Remote, err)
+			continue
+		}
+
+		if err := q.repo.PauseDownload(dl.Remote, shouldPause); err != nil {
+			logrus.Errorf("could not persist the state of download %q: %s", dl.Remote, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package download
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateBurst is the maximum number of bytes which can be read at once by a limited download
+const rateBurst = 1 << 20
+
+type (
+	// Throttle holds the token bucket shared by all downloads. Only one type of downloader
+	// is active at a time, so a single bucket enforces both the global limit and the
+	// limit of the downloader.
+	Throttle struct {
+		mu      sync.Mutex
+		getter  string
+		limits  RateLimits
+		slots   []rateSlot
+		limiter *rate.Limiter
+	}
+
+	// RateLimits are download speeds in bytes per second, where zero means the speed is not limited
+	RateLimits struct {
+		// Global is shared by all downloads
+		Global int64
+		// Getters holds the limits of a downloader type, ex. "http" or "torrent"
+		Getters map[string]int64
+		// Slots override the limits during their window, where the first matching slot is used
+		Slots []RateSlot
+	}
+
+	// RateSlot holds the limits which are applied during the window
+	RateSlot struct {
+		Window
+		Global  int64
+		Getters map[string]int64
+	}
+
+	rateSlot struct {
+		window window
+		slot   RateSlot
+	}
+)
+
+// NewThrottle creates the bucket for the downloads of the getter type and applies
+// the limits for the current time
+func NewThrottle(getter string, limits RateLimits) (*Throttle, error) {
+	t := &Throttle{getter: getter, limiter: rate.NewLimiter(rate.Inf, rateBurst)}
+	if err := t.Update(limits); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Limiter returns the bucket shared by all downloads
+func (t *Throttle) Limiter() *rate.Limiter {
+	return t.limiter
+}
+
+// Update replaces the configured limits, and applies them immediately to all
+// running downloads
+func (t *Throttle) Update(limits RateLimits) error {
+	var slots []rateSlot
+	for _, s := range limits.Slots {
+		w, err := parseWindow(s.Window)
+		if err != nil {
+			return err
+		}
+		slots = append(slots, rateSlot{window: w, slot: s})
+	}
+
+	t.mu.Lock()
+	t.limits = limits
+	t.slots = slots
+	t.mu.Unlock()
+
+	t.Apply(time.Now())
+	return nil
+}
+
+// Apply sets the limits of the slot matching the given time, or the default
+// limits when no slot matches
+func (t *Throttle) Apply(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	global, getters := t.limits.Global, t.limits.Getters
+	for _, s := range t.slots {
+		if s.window.contains(now) {
+			global, getters = s.slot.Global, s.slot.Getters
+			break
+		}
+	}
+
+	limit := bytesPerSecond(global, getters[t.getter])
+	if t.limiter.Limit() != limit {
+		t.limiter.SetLimitAt(now, limit)
+	}
+}
+
+// bytesPerSecond returns the stricter of the limits, where zero is unlimited
+func bytesPerSecond(limits ...int64) rate.Limit {
+	limit := rate.Inf
+	for _, l := range limits {
+		if l > 0 && (limit == rate.Inf || rate.Limit(l) < limit) {
+			limit = rate.Limit(l)
+		}
+	}
+
+	return limit
+}
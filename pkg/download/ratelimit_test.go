@@ -0,0 +1,52 @@
+package download_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/download"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestThrottle_Apply(t *testing.T) {
+	// 2019-07-01 is a Monday
+	evening, _ := time.Parse("2006-01-02 15:04", "2019-07-01 19:00")
+	morning, _ := time.Parse("2006-01-02 15:04", "2019-07-01 09:00")
+
+	limits := download.RateLimits{
+		Global:  2000,
+		Getters: map[string]int64{download.TypeTorrent: 1000},
+		Slots: []download.RateSlot{
+			{
+				Window: download.Window{From: "17:00", To: "23:00"},
+				Global: 500,
+			},
+		},
+	}
+	httpThrottle, err := download.NewThrottle(download.TypeHTTP, limits)
+	assert.NoError(t, err)
+	torrentThrottle, err := download.NewThrottle(download.TypeTorrent, limits)
+	assert.NoError(t, err)
+
+	httpThrottle.Apply(morning)
+	torrentThrottle.Apply(morning)
+	assert.Equal(t, rate.Limit(2000), httpThrottle.Limiter().Limit())
+	assert.Equal(t, rate.Limit(1000), torrentThrottle.Limiter().Limit())
+
+	httpThrottle.Apply(evening)
+	torrentThrottle.Apply(evening)
+	assert.Equal(t, rate.Limit(500), httpThrottle.Limiter().Limit())
+	assert.Equal(t, rate.Limit(500), torrentThrottle.Limiter().Limit())
+}
+
+func TestThrottle_UpdateAppliesToSharedLimiter(t *testing.T) {
+	throttle, err := download.NewThrottle(download.TypeHTTP, download.RateLimits{})
+	assert.NoError(t, err)
+
+	limiter := throttle.Limiter()
+	assert.Equal(t, rate.Inf, limiter.Limit())
+
+	assert.NoError(t, throttle.Update(download.RateLimits{Global: 3000}))
+	assert.Equal(t, rate.Limit(3000), limiter.Limit())
+}
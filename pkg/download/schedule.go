@@ -0,0 +1,128 @@
+package download
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var dayAliases = map[string][]time.Weekday{
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"sun":      {time.Sunday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+type (
+	// Schedule decides whether downloads are allowed at a given time
+	Schedule struct {
+		windows []window
+	}
+
+	// Window is a period of the day when downloads are allowed
+	Window struct {
+		// Days on which the window applies, ex. "mon", "weekdays" or "weekends", or every day if empty
+		Days []string
+		// From and To are formatted as "15:04", where a window with To before From spans over midnight
+		From string
+		To   string
+	}
+
+	window struct {
+		days     map[time.Weekday]bool
+		from, to time.Duration // Offset from midnight
+	}
+)
+
+// NewSchedule parses the configured download windows. An empty list of windows
+// results in a schedule that is always open.
+func NewSchedule(windows []Window) (*Schedule, error) {
+	s := &Schedule{}
+	for _, w := range windows {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, parsed)
+	}
+
+	return s, nil
+}
+
+// IsOpen returns true if downloads are allowed at the given time
+func (s *Schedule) IsOpen(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w window) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if w.from == w.to {
+		return w.days[t.Weekday()]
+	}
+
+	if w.from < w.to {
+		return w.days[t.Weekday()] && offset >= w.from && offset < w.to
+	}
+
+	// The window spans over midnight, so the early morning part belongs to the previous day
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && offset >= w.from) || (w.days[yesterday] && offset < w.to)
+}
+
+func parseWindow(w Window) (parsed window, err error) {
+	parsed.days = make(map[time.Weekday]bool)
+	if len(w.Days) == 0 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			parsed.days[d] = true
+		}
+	}
+
+	for _, d := range w.Days {
+		weekdays, ok := dayAliases[strings.ToLower(strings.TrimSpace(d))]
+		if !ok {
+			return parsed, fmt.Errorf("unknown day %q in download window", d)
+		}
+		for _, wd := range weekdays {
+			parsed.days[wd] = true
+		}
+	}
+
+	if parsed.from, err = parseClock(w.From); err != nil {
+		return parsed, err
+	}
+	if parsed.to, err = parseClock(w.To); err != nil {
+		return parsed, err
+	}
+
+	return parsed, nil
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	// An empty value is treated as midnight, so a window without times lasts the whole day
+	if clock == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q in download window, expected HH:MM", clock)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
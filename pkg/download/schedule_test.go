@@ -0,0 +1,92 @@
+package download_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/download"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule_IsOpen(t *testing.T) {
+	// 2019-07-01 is a Monday
+	monday := func(clock string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", "2019-07-01 "+clock)
+		return t
+	}
+	days := func(t time.Time, n int) time.Time {
+		return t.AddDate(0, 0, n)
+	}
+
+	testCases := []struct {
+		name    string
+		windows []download.Window
+		time    time.Time
+		open    bool
+	}{
+		{
+			name: "no windows",
+			time: monday("20:00"),
+			open: true,
+		},
+		{
+			name:    "inside weekday window",
+			windows: []download.Window{{Days: []string{"weekdays"}, From: "02:00", To: "17:00"}},
+			time:    monday("10:00"),
+			open:    true,
+		},
+		{
+			name:    "end of window is exclusive",
+			windows: []download.Window{{Days: []string{"weekdays"}, From: "02:00", To: "17:00"}},
+			time:    monday("17:00"),
+			open:    false,
+		},
+		{
+			name:    "outside of the listed days",
+			windows: []download.Window{{Days: []string{"weekdays"}, From: "02:00", To: "17:00"}},
+			time:    days(monday("10:00"), 5),
+			open:    false,
+		},
+		{
+			name: "all day on weekends",
+			windows: []download.Window{
+				{Days: []string{"weekdays"}, From: "02:00", To: "17:00"},
+				{Days: []string{"weekends"}},
+			},
+			time: days(monday("20:00"), 6),
+			open: true,
+		},
+		{
+			name:    "window over midnight before midnight",
+			windows: []download.Window{{Days: []string{"fri"}, From: "23:00", To: "06:00"}},
+			time:    days(monday("23:30"), 4),
+			open:    true,
+		},
+		{
+			name:    "window over midnight continues into the next day",
+			windows: []download.Window{{Days: []string{"fri"}, From: "23:00", To: "06:00"}},
+			time:    days(monday("05:00"), 5),
+			open:    true,
+		},
+		{
+			name:    "window over midnight does not start on unlisted days",
+			windows: []download.Window{{Days: []string{"fri"}, From: "23:00", To: "06:00"}},
+			time:    monday("05:00"),
+			open:    false,
+		},
+	}
+
+	for _, test := range testCases {
+		s, err := download.NewSchedule(test.windows)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.open, s.IsOpen(test.time), test.name)
+	}
+}
+
+func TestNewSchedule_InvalidWindows(t *testing.T) {
+	_, err := download.NewSchedule([]download.Window{{Days: []string{"someday"}}})
+	assert.Error(t, err)
+
+	_, err = download.NewSchedule([]download.Window{{From: "25:00", To: "02:00"}})
+	assert.Error(t, err)
+}
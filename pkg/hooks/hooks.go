@@ -0,0 +1,226 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+)
+
+const (
+	// Events on which the hooks are run
+	EventQueued     Event = "queued"
+	EventDownloaded Event = "downloaded"
+	EventFailed     Event = "failed"
+
+	DefaultTimeout = time.Minute * 5
+
+	// maxOutput is how much of the end of the output of a script is kept
+	maxOutput = 16 << 10
+)
+
+var events = []Event{EventQueued, EventDownloaded, EventFailed}
+
+type (
+	// Event is a change of an item which hooks are run on
+	Event string
+
+	// Data describes the item of the event to the script through the environment, where only
+	// the item is known for every event
+	Data struct {
+		Item media.SearchItem
+		// File is the local path of the downloaded file
+		File    string
+		Size    int64
+		Quality storage.Quality
+		// Error is why the item failed
+		Error string
+	}
+
+	// Config holds a script and the events it is run on
+	Config struct {
+		// Name identifies the hook in the logs and notifications, the command is used if it is empty
+		Name    string
+		Command string
+		Args    []string
+		// Events are run on all of them if empty
+		Events []Event
+		// Timeout stops the script once it runs for longer, DefaultTimeout if zero
+		Timeout time.Duration
+	}
+
+	// Hook is a script which is run on the events of an item
+	Hook struct {
+		name    string
+		command string
+		args    []string
+		events  map[Event]bool
+		timeout time.Duration
+	}
+
+	// Hooks are run one after another, in the order they were configured
+	Hooks []*Hook
+)
+
+// Env returns the environment variables which describe the event to the script
+func (d Data) Env(event Event) []string {
+	size := ""
+	if d.Size > 0 {
+		size = strconv.FormatInt(d.Size, 10)
+	}
+
+	return []string{
+		"COUCH_EVENT=" + string(event),
+		"COUCH_TERM=" + d.Item.Term,
+		"COUCH_TYPE=" + string(d.Item.Type),
+		"COUCH_IMDB=" + d.Item.IMDb,
+		"COUCH_PATH=" + d.File,
+		"COUCH_SIZE=" + size,
+		"COUCH_QUALITY=" + string(d.Quality),
+		"COUCH_ERROR=" + d.Error,
+	}
+}
+
+func New(conf Config) (*Hook, error) {
+	if conf.Command == "" {
+		return nil, fmt.Errorf("hook %q has no command", conf.Name)
+	}
+
+	h := &Hook{
+		name:    conf.Name,
+		command: conf.Command,
+		args:    conf.Args,
+		events:  make(map[Event]bool),
+		timeout: conf.Timeout,
+	}
+	if h.name == "" {
+		h.name = conf.Command
+	}
+	if h.timeout <= 0 {
+		h.timeout = DefaultTimeout
+	}
+
+	for _, e := range conf.Events {
+		if !known(e) {
+			return nil, fmt.Errorf("unknown event %q of hook %q", e, h.name)
+		}
+		h.events[e] = true
+	}
+	if len(h.events) == 0 {
+		for _, e := range events {
+			h.events[e] = true
+		}
+	}
+
+	return h, nil
+}
+
+func NewHooks(confs []Config) (Hooks, error) {
+	var hooks Hooks
+	for _, conf := range confs {
+		h, err := New(conf)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+func known(event Event) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the hook, or its command if it has none
+func (h *Hook) Name() string {
+	return h.name
+}
+
+// Wants returns true if the hook is run on the event
+func (h *Hook) Wants(event Event) bool {
+	return h.events[event]
+}
+
+// Run runs the script with the data of the event in its environment, and waits until it exits
+// or its timeout passes. A script fails if it exits with a non-zero code.
+func (h *Hook) Run(event Event, data Data) storage.HookRun {
+	cmd := exec.Command(h.command, h.args...)
+	cmd.Env = append(os.Environ(), data.Env(event)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	setProcessGroup(cmd)
+
+	run := storage.HookRun{
+		Title:     data.Item.Term,
+		Hook:      h.name,
+		Event:     string(event),
+		File:      data.File,
+		StartedAt: time.Now(),
+	}
+	if err := cmd.Start(); err != nil {
+		run.ExitCode = -1
+		run.Error = err.Error()
+		return run
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var err error
+	timedOut := false
+	select {
+	case err = <-done:
+	case <-time.After(h.timeout):
+		// The children of the script would keep the output open
+		killProcessGroup(cmd)
+		err, timedOut = <-done, true
+	}
+	run.Duration = time.Since(run.StartedAt)
+	run.Output = tail(output.Bytes(), maxOutput)
+
+	switch {
+	case timedOut:
+		run.ExitCode = -1
+		run.Error = fmt.Sprintf("timed out after %s", h.timeout)
+	case err != nil:
+		run.ExitCode = -1
+		if exit, ok := err.(*exec.ExitError); ok {
+			run.ExitCode = exit.ExitCode()
+		}
+		run.Error = err.Error()
+	}
+
+	return run
+}
+
+// Run runs the hooks which want the event, and returns their results
+func (hs Hooks) Run(event Event, data Data) []storage.HookRun {
+	var runs []storage.HookRun
+	for _, h := range hs {
+		if h.Wants(event) {
+			runs = append(runs, h.Run(event, data))
+		}
+	}
+	return runs
+}
+
+// tail returns the last max bytes of the output
+func tail(output []byte, max int) string {
+	if len(output) <= max {
+		return string(output)
+	}
+	return "..." + string(output[len(output)-max:])
+}
@@ -0,0 +1,87 @@
+package hooks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/hooks"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHook_Run(t *testing.T) {
+	item := media.NewEpisode("Show", 1, 2, "tt0123")
+	data := hooks.Data{Item: item, File: "/tv/Show/Season 01/Show - S01E02.mkv", Size: 1024, Quality: "FHD"}
+
+	testCases := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		exitCode int
+		output   string
+		failed   bool
+	}{
+		{
+			name:   "environment",
+			script: `echo "$COUCH_EVENT|$COUCH_TERM|$COUCH_TYPE|$COUCH_IMDB|$COUCH_PATH|$COUCH_SIZE|$COUCH_QUALITY"`,
+			output: "downloaded|Show S01E02|Episode|tt0123|/tv/Show/Season 01/Show - S01E02.mkv|1024|FHD\n",
+		},
+		{
+			name:     "exit code",
+			script:   "echo failed >&2; exit 3",
+			exitCode: 3,
+			output:   "failed\n",
+			failed:   true,
+		},
+		{
+			name:     "timeout",
+			script:   "sleep 5",
+			timeout:  time.Second,
+			exitCode: -1,
+			failed:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := hooks.New(hooks.Config{
+				Name:    "test",
+				Command: "/bin/sh",
+				Args:    []string{"-c", tc.script},
+				Timeout: tc.timeout,
+			})
+			assert.NoError(t, err)
+
+			run := h.Run(hooks.EventDownloaded, data)
+			assert.Equal(t, "test", run.Hook)
+			assert.Equal(t, "Show S01E02", run.Title)
+			assert.Equal(t, "downloaded", run.Event)
+			assert.Equal(t, data.File, run.File)
+			assert.Equal(t, tc.exitCode, run.ExitCode)
+			assert.Equal(t, tc.output, run.Output)
+			assert.Equal(t, tc.failed, run.Error != "")
+		})
+	}
+}
+
+func TestNewHooks(t *testing.T) {
+	hs, err := hooks.NewHooks([]hooks.Config{
+		{Command: "/bin/true"},
+		{Name: "failed only", Command: "/bin/true", Events: []hooks.Event{hooks.EventFailed}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/bin/true", hs[0].Name())
+	assert.True(t, hs[0].Wants(hooks.EventQueued))
+	assert.True(t, hs[0].Wants(hooks.EventFailed))
+	assert.False(t, hs[1].Wants(hooks.EventQueued))
+	assert.True(t, hs[1].Wants(hooks.EventFailed))
+
+	runs := hs.Run(hooks.EventQueued, hooks.Data{Item: media.NewMovie("Movie", 2019, "tt0123")})
+	assert.Len(t, runs, 1)
+	assert.Equal(t, 0, runs[0].ExitCode)
+
+	_, err = hooks.NewHooks([]hooks.Config{{Command: "/bin/true", Events: []hooks.Event{"finished"}}})
+	assert.Error(t, err)
+	_, err = hooks.NewHooks([]hooks.Config{{Name: "empty"}})
+	assert.Error(t, err)
+}
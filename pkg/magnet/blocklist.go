@@ -0,0 +1,124 @@
+package magnet
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nenad/couch/pkg/storage"
+)
+
+var (
+	// DefaultBlockedSources are the sources recorded or leaked in cinemas
+	DefaultBlockedSources = []string{"CAM", "TS", "TC", "SCR"}
+	// DefaultBlockedKeywords mark releases with hardcoded subtitles
+	DefaultBlockedKeywords = []string{"KORSUB", "HC", "HCSUB", "HARDSUB", "HARDCODED"}
+)
+
+// Blocklist rejects magnets by the source of the release, and by keywords in its name
+type Blocklist struct {
+	mu       sync.Mutex
+	sources  map[storage.Source]bool
+	keywords []keyword
+}
+
+// BlocklistOptions hold the blocked sources and keywords. The defaults are used
+// when a list is nil, while an empty list blocks nothing.
+type BlocklistOptions struct {
+	Sources  []string
+	Keywords []string
+}
+
+type keyword struct {
+	word  string
+	regex *regexp.Regexp
+}
+
+func NewBlocklist(opts BlocklistOptions) (*Blocklist, error) {
+	b := &Blocklist{}
+	if err := b.Update(opts); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Update replaces the blocked sources and keywords, a missing list is replaced by the defaults
+func (b *Blocklist) Update(opts BlocklistOptions) error {
+	names := opts.Sources
+	if names == nil {
+		names = DefaultBlockedSources
+	}
+	sources := make(map[storage.Source]bool)
+	for _, name := range names {
+		source, ok := parseSource(name)
+		if !ok {
+			return fmt.Errorf("unknown source %q", name)
+		}
+		sources[source] = true
+	}
+
+	words := opts.Keywords
+	if words == nil {
+		words = DefaultBlockedKeywords
+	}
+	var keywords []keyword
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		keywords = append(keywords, keyword{word: w, regex: tokenRegex(regexp.QuoteMeta(w))})
+	}
+
+	b.mu.Lock()
+	b.sources = sources
+	b.keywords = keywords
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Filter drops the blocked magnets, and calls reject with each of them
+func (b *Blocklist) Filter(reject RejectFunc) ProcessFunc {
+	return func(magnets []storage.Magnet) (new []storage.Magnet) {
+		for _, m := range magnets {
+			if reason := b.check(m); reason != "" {
+				if reject != nil {
+					reject(m, reason)
+				}
+				continue
+			}
+			new = append(new, m)
+		}
+
+		return new
+	}
+}
+
+func (b *Blocklist) check(m storage.Magnet) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sources[m.Source] {
+		return fmt.Sprintf("source %s is blocked", m.Source)
+	}
+
+	for _, k := range b.keywords {
+		if k.regex.MatchString(m.Name) {
+			return fmt.Sprintf("keyword %s is blocked", k.word)
+		}
+	}
+
+	return ""
+}
+
+func parseSource(name string) (storage.Source, bool) {
+	for _, s := range storage.Sources {
+		if strings.EqualFold(string(s), name) {
+			return s, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,94 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlocklist_Filter(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		conf   magnet.BlocklistOptions
+		magnet storage.Magnet
+		reason string
+	}{
+		{
+			desc:   "cam is blocked by default",
+			magnet: storage.Magnet{Name: "Movie.2019.CAM.x264", Source: storage.SourceCAM},
+			reason: "source CAM is blocked",
+		},
+		{
+			desc:   "korean subtitles are blocked by default",
+			magnet: storage.Magnet{Name: "Movie.2019.1080p.KORSUB.HDRip.x264", Source: storage.SourceWEBRip},
+			reason: "keyword KORSUB is blocked",
+		},
+		{
+			desc:   "keywords ignore case",
+			magnet: storage.Magnet{Name: "Movie 2019 1080p WEBRip HC x264", Source: storage.SourceWEBRip},
+			reason: "keyword HC is blocked",
+		},
+		{
+			desc:   "keywords match whole words",
+			magnet: storage.Magnet{Name: "Movie.2019.1080p.BluRay.x264-HCGROUP", Source: storage.SourceBluRay},
+		},
+		{
+			desc:   "unknown source",
+			magnet: storage.Magnet{Name: "Movie.2019.1080p.x264"},
+		},
+		{
+			desc:   "empty lists block nothing",
+			conf:   magnet.BlocklistOptions{Sources: []string{}, Keywords: []string{}},
+			magnet: storage.Magnet{Name: "Movie.2019.KORSUB.CAM", Source: storage.SourceCAM},
+		},
+		{
+			desc:   "configured source",
+			conf:   magnet.BlocklistOptions{Sources: []string{"hdtv"}},
+			magnet: storage.Magnet{Name: "Show.S01E02.HDTV.x264", Source: storage.SourceHDTV},
+			reason: "source HDTV is blocked",
+		},
+		{
+			desc:   "configured keyword",
+			conf:   magnet.BlocklistOptions{Keywords: []string{"3D"}},
+			magnet: storage.Magnet{Name: "Movie.2019.3D.1080p.BluRay", Source: storage.SourceBluRay},
+			reason: "keyword 3D is blocked",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			b, err := magnet.NewBlocklist(test.conf)
+			assert.NoError(t, err)
+
+			var reasons []string
+			reject := func(m storage.Magnet, reason string) {
+				assert.Equal(t, test.magnet, m)
+				reasons = append(reasons, reason)
+			}
+
+			magnets := b.Filter(reject)([]storage.Magnet{test.magnet})
+			if test.reason != "" {
+				assert.Empty(t, magnets)
+				assert.Equal(t, []string{test.reason}, reasons)
+			} else {
+				assert.Equal(t, []storage.Magnet{test.magnet}, magnets)
+				assert.Empty(t, reasons)
+			}
+		})
+	}
+}
+
+func TestBlocklist_Update(t *testing.T) {
+	b, err := magnet.NewBlocklist(magnet.BlocklistOptions{})
+	assert.NoError(t, err)
+
+	cam := storage.Magnet{Name: "Movie.2019.CAM", Source: storage.SourceCAM}
+	assert.Empty(t, b.Filter(nil)([]storage.Magnet{cam}))
+
+	assert.NoError(t, b.Update(magnet.BlocklistOptions{Sources: []string{"TS"}}))
+	assert.Equal(t, []storage.Magnet{cam}, b.Filter(nil)([]storage.Magnet{cam}))
+
+	assert.Error(t, b.Update(magnet.BlocklistOptions{Sources: []string{"VHS"}}))
+}
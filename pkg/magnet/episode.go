@@ -0,0 +1,142 @@
+package magnet
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nenad/couch/pkg/media"
+)
+
+// EpisodeFile is a file of a magnet along with the range of episodes which it contains
+type EpisodeFile struct {
+	Path       string
+	Episode    int
+	EpisodeEnd int
+}
+
+// absoluteRegex matches the episode number at the end of a title, ex. "Show - 13" or "Show Episode 13v2"
+var absoluteRegex = regexp.MustCompile(`(?i)(?:^|\s|-)(?:ep(?:isode)?\s?|e)?(\d{1,4})(?:v\d)?$`)
+
+// MatchEpisodes maps the files of a TV item to the wanted episodes of its season. Episodes are
+// recognized as S01E05, 1x05, 105, or as absolute numbers such as "Show - 13", which are counted
+// from the first episode in the files for seasons after the first one. Files without an episode,
+// such as extras, are left out. Every file of a single episode belongs to that episode.
+func MatchEpisodes(item media.SearchItem, files []string) []EpisodeFile {
+	if item.Type != media.TypeEpisode && item.Type != media.TypeSeason {
+		return nil
+	}
+
+	season, episode := item.Episode()
+	offset := AbsoluteOffset(item, files)
+	var wanted []EpisodeFile
+	for _, f := range files {
+		m := EpisodeFile{Path: f, Episode: episode, EpisodeEnd: episode}
+		if item.Type == media.TypeSeason {
+			m.Episode, m.EpisodeEnd = seasonEpisodes(item, season, f, offset)
+		}
+		if m.Episode == 0 {
+			continue
+		}
+		for e := m.Episode; e <= m.EpisodeEnd; e++ {
+			if item.WantsEpisode(e) {
+				wanted = append(wanted, m)
+				break
+			}
+		}
+	}
+	return wanted
+}
+
+// AbsoluteOffset returns how far the absolute numbers in the files of a season are ahead of its
+// episodes, ex. 12 if the second season starts at "Show - 13". It is zero for the first season.
+func AbsoluteOffset(item media.SearchItem, files []string) int {
+	season, _ := item.Episode()
+	if item.Type != media.TypeSeason || season <= 1 {
+		return 0
+	}
+
+	first := 0
+	for _, f := range files {
+		start, _, abs := fileEpisodes(item, season, f)
+		if abs && (first == 0 || start < first) {
+			first = start
+		}
+	}
+	if first > 1 {
+		return first - 1
+	}
+	return 0
+}
+
+// FileEpisode returns the episodes of a single file of a TV item, which are found in the name
+// of the file, or otherwise in the name of its folder, ex. "Subs/Show.S01E02/English.srt".
+// Absolute numbers are reduced by the offset of all the files, see AbsoluteOffset.
+func FileEpisode(item media.SearchItem, file string, offset int) (EpisodeFile, bool) {
+	season, episode := item.Episode()
+	switch item.Type {
+	case media.TypeEpisode:
+		return EpisodeFile{Path: file, Episode: episode, EpisodeEnd: episode}, true
+	case media.TypeSeason:
+	default:
+		return EpisodeFile{}, false
+	}
+
+	for _, name := range []string{file, path.Dir(file)} {
+		if start, end := seasonEpisodes(item, season, name, offset); start > 0 {
+			return EpisodeFile{Path: file, Episode: start, EpisodeEnd: end}, true
+		}
+	}
+	return EpisodeFile{}, false
+}
+
+// seasonEpisodes returns the range of episodes of the season in the name of the file, or zero
+func seasonEpisodes(item media.SearchItem, season int, file string, offset int) (episode, episodeEnd int) {
+	start, end, abs := fileEpisodes(item, season, file)
+	if abs {
+		start, end = start-offset, end-offset
+	}
+	if start <= 0 {
+		return 0, 0
+	}
+	return start, end
+}
+
+// fileEpisodes returns the range of episodes in the name of the file, and whether it is an absolute number
+func fileEpisodes(item media.SearchItem, season int, file string) (episode, episodeEnd int, absolute bool) {
+	name := path.Base(file)
+	if allowedExtensions[strings.ToLower(path.Ext(name))] {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	r := ParseRelease(name)
+	if r.Episode > 0 {
+		if !r.hasSeason(season) {
+			return 0, 0, false
+		}
+		return r.Episode, r.EpisodeEnd, false
+	}
+	if r.Season > 0 {
+		return 0, 0, false
+	}
+
+	// The name of the show may contain numbers as well, ex. "The 100"
+	title := strings.ToLower(r.Title)
+	title = strings.TrimSpace(strings.TrimPrefix(title, strings.ToLower(cleanTitle(item.Name()))))
+
+	m := absoluteRegex.FindStringSubmatch(title)
+	if m == nil {
+		return 0, 0, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	if n == 0 {
+		return 0, 0, false
+	}
+
+	// The season followed by the episode, ex. 105 or 1012
+	if n >= 100 && n/100 == season && n%100 > 0 {
+		return n % 100, n % 100, false
+	}
+	return n, n, true
+}
@@ -0,0 +1,166 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchEpisodes(t *testing.T) {
+	season := media.NewSeason("Show", 2, "tt1")
+	wanted := season
+	wanted.Episodes = []int{2, 4}
+
+	testCases := []struct {
+		desc     string
+		item     media.SearchItem
+		files    []string
+		expected []magnet.EpisodeFile
+	}{
+		{
+			desc:  "movie",
+			item:  media.NewMovie("Movie", 2019, "tt2"),
+			files: []string{"Movie.2019.1080p.mkv"},
+		},
+		{
+			desc:  "episode",
+			item:  media.NewEpisode("Show", 2, 3, "tt1"),
+			files: []string{"Show.S02E03.1080p/video.mkv"},
+			expected: []magnet.EpisodeFile{
+				{Path: "Show.S02E03.1080p/video.mkv", Episode: 3, EpisodeEnd: 3},
+			},
+		},
+		{
+			desc: "season pack with extras",
+			item: season,
+			files: []string{
+				"Show.S02.1080p.WEB.x264-GRP/Show.S02E01.1080p.WEB.x264-GRP.mkv",
+				"Show.S02.1080p.WEB.x264-GRP/Show.S02E02E03.1080p.WEB.x264-GRP.mkv",
+				"Show.S02.1080p.WEB.x264-GRP/Featurettes/Making.Of.mkv",
+				"Show.S02.1080p.WEB.x264-GRP/Show.S01E07.1080p.WEB.x264-GRP.mkv",
+			},
+			expected: []magnet.EpisodeFile{
+				{Path: "Show.S02.1080p.WEB.x264-GRP/Show.S02E01.1080p.WEB.x264-GRP.mkv", Episode: 1, EpisodeEnd: 1},
+				{Path: "Show.S02.1080p.WEB.x264-GRP/Show.S02E02E03.1080p.WEB.x264-GRP.mkv", Episode: 2, EpisodeEnd: 3},
+			},
+		},
+		{
+			desc: "cross and compact numbering",
+			item: season,
+			files: []string{
+				"Show Season 2/Show - 2x05 - Title.avi",
+				"Show Season 2/show.206.hdtv.avi",
+			},
+			expected: []magnet.EpisodeFile{
+				{Path: "Show Season 2/Show - 2x05 - Title.avi", Episode: 5, EpisodeEnd: 5},
+				{Path: "Show Season 2/show.206.hdtv.avi", Episode: 6, EpisodeEnd: 6},
+			},
+		},
+		{
+			desc: "absolute numbering of the second season",
+			item: season,
+			files: []string{
+				"[Subs] Show S2 [1080p]/[Subs] Show - 14 [1080p].mkv",
+				"[Subs] Show S2 [1080p]/[Subs] Show - 13 [1080p].mkv",
+				"[Subs] Show S2 [1080p]/[Subs] Show - NCOP [1080p].mkv",
+			},
+			expected: []magnet.EpisodeFile{
+				{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 14 [1080p].mkv", Episode: 2, EpisodeEnd: 2},
+				{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 13 [1080p].mkv", Episode: 1, EpisodeEnd: 1},
+			},
+		},
+		{
+			desc: "number in the name of the show",
+			item: media.NewSeason("The 100", 1, "tt3"),
+			files: []string{
+				"The.100.S01/The.100.E03.mkv",
+				"The.100.S01/The 100.mkv",
+			},
+			expected: []magnet.EpisodeFile{
+				{Path: "The.100.S01/The.100.E03.mkv", Episode: 3, EpisodeEnd: 3},
+			},
+		},
+		{
+			desc: "wanted episodes",
+			item: wanted,
+			files: []string{
+				"Show.S02/Show.S02E03.1080p.mkv",
+				"Show.S02/Show.S02E04.1080p.mkv",
+				"Show.S02/Show.S02E01E02.1080p.mkv",
+			},
+			expected: []magnet.EpisodeFile{
+				{Path: "Show.S02/Show.S02E04.1080p.mkv", Episode: 4, EpisodeEnd: 4},
+				{Path: "Show.S02/Show.S02E01E02.1080p.mkv", Episode: 1, EpisodeEnd: 2},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, magnet.MatchEpisodes(test.item, test.files))
+		})
+	}
+}
+
+func TestFileEpisode(t *testing.T) {
+	season := media.NewSeason("Show", 2, "tt1")
+	videos := []string{
+		"[Subs] Show S2 [1080p]/[Subs] Show - 13 [1080p].mkv",
+		"[Subs] Show S2 [1080p]/[Subs] Show - 14 [1080p].mkv",
+		"[Subs] Show S2 [1080p]/[Subs] Show - 15 [1080p].mkv",
+	}
+
+	testCases := []struct {
+		desc     string
+		item     media.SearchItem
+		file     string
+		expected magnet.EpisodeFile
+		ok       bool
+	}{
+		{
+			desc:     "absolute number of the second season",
+			item:     season,
+			file:     videos[1],
+			expected: magnet.EpisodeFile{Path: videos[1], Episode: 2, EpisodeEnd: 2},
+			ok:       true,
+		},
+		{
+			desc:     "absolute number of the subtitles",
+			item:     season,
+			file:     "[Subs] Show S2 [1080p]/[Subs] Show - 15 [1080p].eng.srt",
+			expected: magnet.EpisodeFile{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 15 [1080p].eng.srt", Episode: 3, EpisodeEnd: 3},
+			ok:       true,
+		},
+		{
+			desc:     "episode in the folder",
+			item:     season,
+			file:     "Subs/Show.S02E04.1080p/English.srt",
+			expected: magnet.EpisodeFile{Path: "Subs/Show.S02E04.1080p/English.srt", Episode: 4, EpisodeEnd: 4},
+			ok:       true,
+		},
+		{
+			desc: "without an episode",
+			item: season,
+			file: "[Subs] Show S2 [1080p]/[Subs] Show - NCOP [1080p].mkv",
+		},
+		{
+			desc:     "episode",
+			item:     media.NewEpisode("Show", 2, 3, "tt1"),
+			file:     "Show.S02E03.1080p/video.mkv",
+			expected: magnet.EpisodeFile{Path: "Show.S02E03.1080p/video.mkv", Episode: 3, EpisodeEnd: 3},
+			ok:       true,
+		},
+	}
+
+	offset := magnet.AbsoluteOffset(season, videos)
+	assert.Equal(t, 12, offset)
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			f, ok := magnet.FileEpisode(test.item, test.file, offset)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, f)
+		})
+	}
+}
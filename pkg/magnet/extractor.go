@@ -9,3 +9,19 @@ var allowedExtensions = map[string]bool{".mp4": true, ".mkv": true, ".avi": true
 type Extractor interface {
 	Extract(magnet storage.Magnet) ([]string, error)
 }
+
+// BadMagnetError is returned when the magnet itself cannot be used, ex. the
+// torrent is dead or has no video files, so a different magnet should be tried
+type BadMagnetError struct {
+	Reason string
+}
+
+func (e *BadMagnetError) Error() string {
+	return e.Reason
+}
+
+// IsBadMagnet returns true if the error was caused by an unusable magnet
+func IsBadMagnet(err error) bool {
+	_, ok := err.(*BadMagnetError)
+	return ok
+}
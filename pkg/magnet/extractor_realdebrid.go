@@ -2,11 +2,9 @@ package magnet
 
 import (
 	"fmt"
-	"sort"
 	"strings"
 	"time"
 
-	"github.com/nenad/couch/pkg/media"
 	"github.com/nenad/couch/pkg/storage"
 	"github.com/nenad/rd"
 	"github.com/sirupsen/logrus"
@@ -17,14 +15,16 @@ type (
 		debrid       *rd.RealDebrid
 		pollInterval time.Duration
 		downloadAll  bool
+		files        *FileSelection
 	}
 )
 
-func NewRealDebridExtractor(debrid *rd.RealDebrid, pollInterval time.Duration, downloadAll bool) *RealDebridExtractor {
+func NewRealDebridExtractor(debrid *rd.RealDebrid, pollInterval time.Duration, downloadAll bool, files *FileSelection) *RealDebridExtractor {
 	return &RealDebridExtractor{
 		debrid:       debrid,
 		pollInterval: pollInterval,
 		downloadAll:  downloadAll,
+		files:        files,
 	}
 }
 
@@ -50,13 +50,16 @@ loop:
 		case rd.StatusWaitingFiles:
 			// TODO Check if we need to download the whole torrent
 			fileIDs := ex.extractFileIDs(torrent, magnet, ex.downloadAll)
+			if len(fileIDs) == 0 {
+				return nil, &BadMagnetError{fmt.Sprintf("no video files found for magnet %s", magnet.Location)}
+			}
 			if err := ex.debrid.Torrents.SelectFilesFromTorrent(torrent.ID, fileIDs); err != nil {
 				return nil, fmt.Errorf("extractor: could not select files for download: %s", err)
 			}
 
 		// Return error if we cannot download the torrent for some reason
 		case rd.StatusDead, rd.StatusMagnetError, rd.StatusVirus, rd.StatusError:
-			return nil, fmt.Errorf("extractor: could not download torrent %s, status %s", torrent.ID, torrent.Status)
+			return nil, &BadMagnetError{fmt.Sprintf("extractor: could not download torrent %s, status %s", torrent.ID, torrent.Status)}
 
 		// Only exit the loop when the torrent is successfully downloaded
 		case rd.StatusDownloaded:
@@ -92,32 +95,23 @@ func (ex *RealDebridExtractor) extractFileIDs(torrentInfo rd.TorrentInfo, magnet
 		return ids
 	}
 
-	// Get only the biggest video file
-	var candidateFiles []rd.File
-	for _, f := range torrentInfo.Files {
-		if !checkSuffix(f.Path) {
-			continue
-		}
-		candidateFiles = append(candidateFiles, f)
+	files := make([]TorrentFile, len(torrentInfo.Files))
+	for i, f := range torrentInfo.Files {
+		files[i] = TorrentFile{Path: f.Path, Size: f.Bytes}
 	}
 
-	// Some torrent files have
-	sort.SliceStable(candidateFiles, func(i, j int) bool {
-		return candidateFiles[i].Bytes < candidateFiles[j].Bytes
-	})
-
-	switch magnet.Item.Type {
-	case media.TypeEpisode, media.TypeMovie:
-		return []int{candidateFiles[len(candidateFiles)-1].ID}
-	case media.TypeSeason:
-		ids := make([]int, len(candidateFiles))
-		for i, r := range candidateFiles {
-			ids[i] = r.ID
-		}
-		return ids
+	selected := ex.files.Select(magnet.Item, files)
+	if len(selected) == 0 {
+		return nil
 	}
 
-	return []int{0}
+	// Subtitles are downloaded along with the videos
+	selected = append(selected, ex.files.Subtitles(magnet.Item, files, selected)...)
+	ids := make([]int, len(selected))
+	for i, s := range selected {
+		ids[i] = torrentInfo.Files[s].ID
+	}
+	return ids
 }
 
 func (ex *RealDebridExtractor) AddOrGetTorrentUrl(magnet string) (info rd.TorrentUrlInfo, err error) {
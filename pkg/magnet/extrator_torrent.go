@@ -2,20 +2,24 @@ package magnet
 
 import (
 	"fmt"
-	"sort"
+	"time"
 
 	"github.com/anacrolix/torrent"
-	"github.com/nenad/couch/pkg/media"
 	"github.com/nenad/couch/pkg/storage"
 )
 
+// metadataTimeout is how long to wait for peers to send the info about the torrent
+const metadataTimeout = time.Minute * 10
+
 type torrentExtractor struct {
-	repo *storage.MediaRepository
+	repo  *storage.MediaRepository
+	files *FileSelection
 }
 
-func NewTorrentExtractor(repo *storage.MediaRepository) *torrentExtractor {
+func NewTorrentExtractor(repo *storage.MediaRepository, files *FileSelection) *torrentExtractor {
 	return &torrentExtractor{
-		repo: repo,
+		repo:  repo,
+		files: files,
 	}
 }
 
@@ -30,35 +34,27 @@ func (ex *torrentExtractor) Extract(magnet storage.Magnet) ([]string, error) {
 		return nil, fmt.Errorf("could not create torrent file: %s", err)
 	}
 
-	<-tor.GotInfo()
-
-	var candidateFiles []*torrent.File
-	for _, f := range tor.Files() {
-
-		if !checkSuffix(f.Path()) {
-			continue
-		}
-		candidateFiles = append(candidateFiles, f)
+	select {
+	case <-tor.GotInfo():
+	case <-time.After(metadataTimeout):
+		return nil, &BadMagnetError{fmt.Sprintf("could not get torrent info for magnet %s, no peers", magnet.Location)}
 	}
 
-	if len(candidateFiles) == 0 {
-		return nil, fmt.Errorf("no video files found for magnet %s", magnet.Location)
+	files := make([]TorrentFile, len(tor.Files()))
+	for i, f := range tor.Files() {
+		files[i] = TorrentFile{Path: f.Path(), Size: f.Length()}
 	}
 
-	// Some torrent files have
-	sort.SliceStable(candidateFiles, func(i, j int) bool {
-		return candidateFiles[i].Length() < candidateFiles[j].Length()
-	})
+	selected := ex.files.Select(magnet.Item, files)
+	if len(selected) == 0 {
+		return nil, &BadMagnetError{fmt.Sprintf("no video files found for magnet %s", magnet.Location)}
+	}
 
-	var candidates []string
-	switch magnet.Item.Type {
-	case media.TypeEpisode, media.TypeMovie:
-		candidates = []string{candidateFiles[len(candidateFiles)-1].Path()}
-	case media.TypeSeason:
-		candidates = make([]string, len(candidateFiles))
-		for i, r := range candidateFiles {
-			candidates[i] = r.Path()
-		}
+	// Subtitles are downloaded along with the videos
+	selected = append(selected, ex.files.Subtitles(magnet.Item, files, selected)...)
+	candidates := make([]string, len(selected))
+	for i, s := range selected {
+		candidates[i] = files[s].Path
 	}
 
 	return candidates, nil
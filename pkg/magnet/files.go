@@ -0,0 +1,225 @@
+package magnet
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/subtitles"
+)
+
+// DefaultMinSizePercent is the smallest size of a file, relative to the biggest video file of the torrent
+const DefaultMinSizePercent = 10
+
+var (
+	// DefaultExcludedWords mark files which aren't the movie or the episode itself
+	DefaultExcludedWords = []string{"sample", "trailer", "teaser", "featurette", "extras", "bonus", "behind the scenes",
+		"deleted scenes", "interview", "NCOP", "NCED"}
+	// DefaultExcludedFolders hold the extras of a release
+	DefaultExcludedFolders = []string{"sample", "samples", "extras", "featurettes", "trailers", "bonus", "behind the scenes",
+		"deleted scenes", "interviews", "scenes", "shorts", "other"}
+)
+
+// TorrentFile is a file of a torrent along with its size in bytes
+type TorrentFile struct {
+	Path string
+	Size int64
+}
+
+// FileSelectionOptions hold which files of a torrent are skipped. The defaults are used
+// when a list is nil, while an empty list skips nothing.
+type FileSelectionOptions struct {
+	ExcludedWords   []string
+	ExcludedFolders []string
+	// MinSizePercent is the smallest size of a file relative to the biggest video file, or the default if zero
+	MinSizePercent int
+}
+
+// FileSelection decides which files of a torrent are downloaded, skipping samples,
+// trailers and other extras, and keeping the subtitles in the wanted languages
+type FileSelection struct {
+	words     []*regexp.Regexp
+	folders   map[string]bool
+	minSize   int
+	languages map[string]bool
+}
+
+// NewFileSelection returns the policy for the options, which also selects the subtitles in the languages
+func NewFileSelection(opts FileSelectionOptions, languages []string) (*FileSelection, error) {
+	if opts.MinSizePercent < 0 || opts.MinSizePercent > 100 {
+		return nil, fmt.Errorf("min_size_percent %d is not between 0 and 100", opts.MinSizePercent)
+	}
+
+	s := &FileSelection{folders: make(map[string]bool), minSize: opts.MinSizePercent, languages: make(map[string]bool)}
+	for _, l := range languages {
+		s.languages[l] = true
+	}
+	if s.minSize == 0 {
+		s.minSize = DefaultMinSizePercent
+	}
+
+	words := opts.ExcludedWords
+	if words == nil {
+		words = DefaultExcludedWords
+	}
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			s.words = append(s.words, tokenRegex(strings.Replace(regexp.QuoteMeta(w), " ", `[\s._\-]`, -1)))
+		}
+	}
+
+	folders := opts.ExcludedFolders
+	if folders == nil {
+		folders = DefaultExcludedFolders
+	}
+	for _, f := range folders {
+		s.folders[strings.ToLower(strings.TrimSpace(f))] = true
+	}
+
+	return s, nil
+}
+
+// Select returns the indexes of the files which are downloaded for the item, which are the
+// biggest file for movies and episodes, and the biggest file of every wanted episode of a season
+func (s *FileSelection) Select(item media.SearchItem, files []TorrentFile) []int {
+	// The size is relative to the biggest video which isn't excluded, as extras can be bigger than the episodes
+	var videos []int
+	var largest int64
+	for i, f := range files {
+		if !checkSuffix(f.Path) || s.excluded(item, f.Path) {
+			continue
+		}
+		videos = append(videos, i)
+		if f.Size > largest {
+			largest = f.Size
+		}
+	}
+
+	var candidates []int
+	for _, i := range videos {
+		if files[i].Size*100 >= largest*int64(s.minSize) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return files[candidates[i]].Size > files[candidates[j]].Size
+	})
+
+	if item.Type != media.TypeSeason {
+		return candidates[:1]
+	}
+
+	paths := make([]string, len(candidates))
+	index := make(map[string]int)
+	for i, c := range candidates {
+		paths[i] = files[c].Path
+		index[files[c].Path] = c
+	}
+
+	// The candidates are sorted by size, so the first file of an episode is the biggest one. Files
+	// whose episodes are all in the files before them, ex. "S02E03" after "S02E02E03", are skipped.
+	var selected []int
+	seen := make(map[int]bool)
+	matched := MatchEpisodes(item, paths)
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Episode < matched[j].Episode
+	})
+	for _, m := range matched {
+		if covered(seen, m.Episode, m.EpisodeEnd) {
+			continue
+		}
+		for e := m.Episode; e <= m.EpisodeEnd; e++ {
+			seen[e] = true
+		}
+		selected = append(selected, index[m.Path])
+	}
+
+	return selected
+}
+
+// covered returns true if all episodes of the range were seen
+func covered(seen map[int]bool, episode, episodeEnd int) bool {
+	for e := episode; e <= episodeEnd; e++ {
+		if !seen[e] {
+			return false
+		}
+	}
+	return true
+}
+
+// Subtitles returns the indexes of the subtitle files in the wanted languages, which belong to
+// one of the selected videos. Only the first file of each language is kept for a video.
+func (s *FileSelection) Subtitles(item media.SearchItem, files []TorrentFile, selected []int) []int {
+	if len(s.languages) == 0 {
+		return nil
+	}
+
+	// The absolute numbers of the episodes are counted from the first video of the torrent
+	var videos []string
+	for _, f := range files {
+		if checkSuffix(f.Path) && !s.excluded(item, f.Path) {
+			videos = append(videos, f.Path)
+		}
+	}
+	offset := AbsoluteOffset(item, videos)
+
+	episodes := make(map[int]bool)
+	for _, i := range selected {
+		if f, ok := FileEpisode(item, files[i].Path, offset); ok {
+			episodes[f.Episode] = true
+		}
+	}
+
+	var subs []int
+	seen := make(map[string]bool)
+	for i, f := range files {
+		language := subtitles.Language(f.Path)
+		if !subtitles.IsSubtitle(f.Path) || !s.languages[language] || s.excluded(item, f.Path) {
+			continue
+		}
+
+		key := language
+		if item.Type == media.TypeSeason {
+			e, ok := FileEpisode(item, f.Path, offset)
+			if !ok || !episodes[e.Episode] {
+				continue
+			}
+			key += strconv.Itoa(e.Episode)
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			subs = append(subs, i)
+		}
+	}
+
+	return subs
+}
+
+// excluded returns true if the file is in an excluded folder, or if its name contains an
+// excluded word besides the name of the item, ex. "Trailer Park Boys"
+func (s *FileSelection) excluded(item media.SearchItem, file string) bool {
+	dir, name := path.Split(file)
+	for _, folder := range strings.Split(dir, "/") {
+		if s.folders[strings.ToLower(folder)] {
+			return true
+		}
+	}
+
+	name = strings.ToLower(cleanTitle(strings.TrimSuffix(name, path.Ext(name))))
+	name = strings.Replace(name, strings.ToLower(cleanTitle(item.Name())), "", 1)
+	for _, w := range s.words {
+		if w.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSelection_Select(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		conf     magnet.FileSelectionOptions
+		item     media.SearchItem
+		files    []magnet.TorrentFile
+		expected []int
+	}{
+		{
+			desc: "movie with a sample and extras",
+			item: media.NewMovie("Movie", 2019, "tt1"),
+			files: []magnet.TorrentFile{
+				{Path: "Movie.2019.1080p.BluRay.x264-GRP/Movie.2019.1080p.BluRay.x264-GRP.nfo", Size: 1024},
+				{Path: "Movie.2019.1080p.BluRay.x264-GRP/Sample/movie.2019.1080p.bluray.x264-grp.sample.mkv", Size: 80 * mb},
+				{Path: "Movie.2019.1080p.BluRay.x264-GRP/Movie.2019.1080p.BluRay.x264-GRP.mkv", Size: 9000 * mb},
+				{Path: "Movie.2019.1080p.BluRay.x264-GRP/Featurettes/Making of Movie.mkv", Size: 12000 * mb},
+			},
+			expected: []int{2},
+		},
+		{
+			desc: "season pack with samples",
+			item: media.NewSeason("Show", 1, "tt2"),
+			files: []magnet.TorrentFile{
+				{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E02.1080p.WEB.x264-GRP.mkv", Size: 1500 * mb},
+				{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E01.1080p.WEB.x264-GRP.mkv", Size: 1400 * mb},
+				{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E01.1080p.WEB.x264-GRP.sample.mkv", Size: 30 * mb},
+				{Path: "Show.S01.1080p.WEB.x264-GRP/Samples/Show.S01E02.sample.mkv", Size: 30 * mb},
+				{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01.Trailer.mp4", Size: 200 * mb},
+				{Path: "Show.S01.1080p.WEB.x264-GRP/Extras/Show.S01E00.Behind.The.Scenes.mkv", Size: 700 * mb},
+			},
+			expected: []int{1, 0},
+		},
+		{
+			desc: "season pack with extras bigger than the episodes",
+			item: media.NewSeason("Show", 1, "tt2"),
+			files: []magnet.TorrentFile{
+				{Path: "Show.S01.720p.BluRay.x264-GRP/Show.S01E01.720p.BluRay.x264-GRP.mkv", Size: 900 * mb},
+				{Path: "Show.S01.720p.BluRay.x264-GRP/Show.S01E02.720p.BluRay.x264-GRP.mkv", Size: 900 * mb},
+				{Path: "Show.S01.720p.BluRay.x264-GRP/Extras/Show.S01.Behind.The.Scenes.mkv", Size: 12000 * mb},
+			},
+			expected: []int{0, 1},
+		},
+		{
+			desc: "episode without the files below the relative size",
+			item: media.NewEpisode("Show", 1, 3, "tt2"),
+			files: []magnet.TorrentFile{
+				{Path: "Show.S01E03.720p.HDTV.x264/show.s01e03.720p.hdtv.x264.mkv", Size: 40 * mb},
+				{Path: "Show.S01E03.720p.HDTV.x264/Show.S01E03.720p.HDTV.x264.mkv", Size: 900 * mb},
+			},
+			expected: []int{1},
+		},
+		{
+			desc: "excluded word in the name of the show",
+			item: media.NewSeason("Trailer Park Boys", 2, "tt3"),
+			files: []magnet.TorrentFile{
+				{Path: "Trailer.Park.Boys.S02.DVDRip/Trailer.Park.Boys.S02E01.DVDRip.avi", Size: 350 * mb},
+				{Path: "Trailer.Park.Boys.S02.DVDRip/Trailer.Park.Boys.S02E02.DVDRip.avi", Size: 350 * mb},
+			},
+			expected: []int{0, 1},
+		},
+		{
+			desc: "anime openings and endings",
+			item: media.NewSeason("Show", 1, "tt4"),
+			files: []magnet.TorrentFile{
+				{Path: "[Subs] Show [1080p]/[Subs] Show - 01 [1080p].mkv", Size: 1300 * mb},
+				{Path: "[Subs] Show [1080p]/[Subs] Show - NCOP [1080p].mkv", Size: 150 * mb},
+				{Path: "[Subs] Show [1080p]/[Subs] Show - 02 [1080p].mkv", Size: 1300 * mb},
+			},
+			expected: []int{0, 2},
+		},
+		{
+			desc: "episode in a double episode file",
+			item: media.NewSeason("Show", 2, "tt2"),
+			files: []magnet.TorrentFile{
+				{Path: "Show.S02.720p/Show.S02E01.720p.mkv", Size: 700 * mb},
+				{Path: "Show.S02.720p/Show.S02E03.720p.mkv", Size: 700 * mb},
+				{Path: "Show.S02.720p/Show.S02E02E03.720p.mkv", Size: 1400 * mb},
+				{Path: "Show.S02.720p/Show.S02E04.720p.mkv", Size: 700 * mb},
+			},
+			expected: []int{0, 2, 3},
+		},
+		{
+			desc: "nothing excluded",
+			conf: magnet.FileSelectionOptions{ExcludedWords: []string{}, ExcludedFolders: []string{}, MinSizePercent: 1},
+			item: media.NewMovie("Movie", 2019, "tt1"),
+			files: []magnet.TorrentFile{
+				{Path: "Movie.2019/Sample/sample.mkv", Size: 9000 * mb},
+				{Path: "Movie.2019/Movie.2019.mkv", Size: 8000 * mb},
+			},
+			expected: []int{0},
+		},
+		{
+			desc: "no video files",
+			item: media.NewMovie("Movie", 2019, "tt1"),
+			files: []magnet.TorrentFile{
+				{Path: "Movie.2019/Movie.2019.iso", Size: 9000 * mb},
+				{Path: "Movie.2019/Sample/sample.mkv", Size: 90 * mb},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			s, err := magnet.NewFileSelection(test.conf, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, s.Select(test.item, test.files))
+		})
+	}
+}
+
+func TestNewFileSelection_InvalidSize(t *testing.T) {
+	_, err := magnet.NewFileSelection(magnet.FileSelectionOptions{MinSizePercent: 120}, nil)
+	assert.Error(t, err)
+}
+
+func TestFileSelection_Subtitles(t *testing.T) {
+	s, err := magnet.NewFileSelection(magnet.FileSelectionOptions{}, []string{"en", "de"})
+	assert.NoError(t, err)
+
+	season := media.NewSeason("Show", 1, "tt2")
+	season.Episodes = []int{1}
+	files := []magnet.TorrentFile{
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E01.1080p.WEB.x264-GRP.mkv", Size: 1400 * mb},
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Subs/Show.S01E01.1080p.WEB.x264-GRP/2_English.srt", Size: 50000},
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Subs/Show.S01E01.1080p.WEB.x264-GRP/3_English.srt", Size: 60000},
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Subs/Show.S01E01.1080p.WEB.x264-GRP/4_French.srt", Size: 50000},
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E02.1080p.WEB.x264-GRP.mkv", Size: 1400 * mb},
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E02.1080p.WEB.x264-GRP.ger.srt", Size: 50000},
+		{Path: "Show.S01.1080p.WEB.x264-GRP/Show.S01E01.1080p.WEB.x264-GRP.ger.srt", Size: 50000},
+	}
+
+	selected := s.Select(season, files)
+	assert.Equal(t, []int{0}, selected)
+	assert.Equal(t, []int{1, 6}, s.Subtitles(season, files, selected))
+
+	// The absolute numbers of the second season start at 13
+	second := media.NewSeason("Show", 2, "tt2")
+	second.Episodes = []int{2, 3}
+	absolute := []magnet.TorrentFile{
+		{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 13 [1080p].mkv", Size: 1300 * mb},
+		{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 13 [1080p].eng.srt", Size: 50000},
+		{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 14 [1080p].mkv", Size: 1300 * mb},
+		{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 14 [1080p].eng.srt", Size: 50000},
+		{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 15 [1080p].mkv", Size: 1300 * mb},
+		{Path: "[Subs] Show S2 [1080p]/[Subs] Show - 15 [1080p].eng.srt", Size: 50000},
+	}
+
+	selected = s.Select(second, absolute)
+	assert.Equal(t, []int{2, 4}, selected)
+	assert.Equal(t, []int{3, 5}, s.Subtitles(second, absolute, selected))
+
+	none, err := magnet.NewFileSelection(magnet.FileSelectionOptions{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, none.Subtitles(season, files, selected))
+}
@@ -39,3 +39,30 @@ func FilterEncoding(encodings ...storage.Encoding) ProcessFunc {
 		return new
 	}
 }
+
+// FilterSize keeps the magnets within the size bounds in bytes, where zero means unbounded
+func FilterSize(min, max uint64) ProcessFunc {
+	return func(magnets []storage.Magnet) (new []storage.Magnet) {
+		for _, m := range magnets {
+			if m.Size < min || (max > 0 && m.Size > max) {
+				continue
+			}
+			new = append(new, m)
+		}
+
+		return new
+	}
+}
+
+// FilterMinSeeders keeps the magnets with at least the given number of seeders
+func FilterMinSeeders(min int) ProcessFunc {
+	return func(magnets []storage.Magnet) (new []storage.Magnet) {
+		for _, m := range magnets {
+			if m.Seeders >= min {
+				new = append(new, m)
+			}
+		}
+
+		return new
+	}
+}
@@ -0,0 +1,35 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMinSeeders(t *testing.T) {
+	magnets := []storage.Magnet{{Seeders: 0}, {Seeders: 5}, {Seeders: 10}}
+
+	assert.Equal(t, []storage.Magnet{{Seeders: 5}, {Seeders: 10}}, magnet.FilterMinSeeders(5)(magnets))
+	assert.Equal(t, magnets, magnet.FilterMinSeeders(0)(magnets))
+	assert.Empty(t, magnet.FilterMinSeeders(11)(magnets))
+}
+
+func TestFilterSize(t *testing.T) {
+	magnets := []storage.Magnet{{Size: 1}, {Size: 5}, {Size: 10}}
+
+	testCases := []struct {
+		min, max uint64
+		expected []storage.Magnet
+	}{
+		{0, 0, magnets},
+		{5, 0, []storage.Magnet{{Size: 5}, {Size: 10}}},
+		{0, 5, []storage.Magnet{{Size: 1}, {Size: 5}}},
+		{2, 9, []storage.Magnet{{Size: 5}}},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, magnet.FilterSize(test.min, test.max)(magnets))
+	}
+}
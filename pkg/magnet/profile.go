@@ -0,0 +1,220 @@
+package magnet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// DefaultProfile is used for items without an assigned profile
+var DefaultProfile = Profile{
+	MinQuality: storage.QualitySD,
+	MaxQuality: storage.QualityFHD,
+	Encodings:  []storage.Encoding{storage.Encodingx264, storage.Encodingx265, storage.EncodingUnknown},
+	Weights:    DefaultWeights,
+}
+
+const (
+	// Possible keys for ordering the magnets
+	SortByQuality  = "quality"
+	SortByEncoding = "encoding"
+	SortBySize     = "size"
+)
+
+var sorters = map[string]func(desc bool) ProcessFunc{
+	SortByQuality:  SortQuality,
+	SortByEncoding: SortEncoding,
+	SortBySize:     SortSize,
+}
+
+type (
+	// Profile describes which magnets are acceptable for an item, and how they are ranked
+	Profile struct {
+		// MinQuality and MaxQuality bound the allowed qualities, both are
+		// inclusive and any quality is allowed if they are empty
+		MinQuality storage.Quality
+		MaxQuality storage.Quality
+		// Encodings are the allowed encodings, any encoding is allowed if empty
+		Encodings []storage.Encoding
+		// MinSize and MaxSize bound the size in bytes, zero means unbounded
+		MinSize uint64
+		MaxSize uint64
+		// MinSeeders drops the magnets with less seeders
+		MinSeeders int
+		// Order sorts the magnets, from the most important key to the least important one.
+		// If it is empty, the magnets are sorted by their score instead.
+		Order []SortKey
+		// Weights are used for the score, DefaultWeights are used if they are not set
+		Weights Weights
+		// Cutoff is the quality at which downloaded items stop being upgraded,
+		// they are never upgraded if it is empty
+		Cutoff storage.Quality
+	}
+
+	SortKey struct {
+		By   string
+		Desc bool
+	}
+
+	// Profiles assigns profiles to items, where the profile of an individual
+	// item is preferred over the one of its type
+	Profiles struct {
+		Default Profile
+		// Types holds the profiles for a type of media
+		Types map[media.Type]Profile
+		// Items holds the profiles keyed by the IMDb identifier, the search term, or the name
+		// of the TV show
+		Items map[string]Profile
+	}
+)
+
+// Processors compiles the profile into the filters followed by the sorters, in the order
+// in which they should run
+func (p Profile) Processors() ([]ProcessFunc, error) {
+	var processors []ProcessFunc
+
+	if p.MinQuality != "" || p.MaxQuality != "" {
+		min, max := p.MinQuality, p.MaxQuality
+		if min == "" {
+			min = storage.QualitySD
+		}
+		if max == "" {
+			max = storage.Quality4K
+		}
+		for _, q := range []storage.Quality{min, max} {
+			if _, ok := qualityScore[q]; !ok {
+				return nil, fmt.Errorf("unknown quality %q", q)
+			}
+		}
+		processors = append(processors, FilterQuality(min, max))
+	}
+
+	if _, ok := qualityScore[p.Cutoff]; !ok && p.Cutoff != "" {
+		return nil, fmt.Errorf("unknown cutoff quality %q", p.Cutoff)
+	}
+
+	if len(p.Encodings) > 0 {
+		for _, e := range p.Encodings {
+			if _, ok := encodingScore[e]; !ok && e != storage.EncodingUnknown {
+				return nil, fmt.Errorf("unknown encoding %q", e)
+			}
+		}
+		processors = append(processors, FilterEncoding(p.Encodings...))
+	}
+
+	if p.MinSize > 0 || p.MaxSize > 0 {
+		processors = append(processors, FilterSize(p.MinSize, p.MaxSize))
+	}
+
+	if p.MinSeeders > 0 {
+		processors = append(processors, FilterMinSeeders(p.MinSeeders))
+	}
+
+	if len(p.Order) == 0 {
+		weights := p.Weights
+		if weights == (Weights{}) {
+			weights = DefaultWeights
+		}
+		return append(processors, SortScore(weights)), nil
+	}
+
+	// Stable sorts run from the least important key, so the most important one wins
+	for i := len(p.Order) - 1; i >= 0; i-- {
+		sorter, ok := sorters[strings.ToLower(p.Order[i].By)]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key %q", p.Order[i].By)
+		}
+		processors = append(processors, sorter(p.Order[i].Desc))
+	}
+
+	return processors, nil
+}
+
+// Process filters and sorts the magnets by the profile
+func (p Profile) Process(magnets []storage.Magnet) ([]storage.Magnet, error) {
+	processors, err := p.Processors()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range processors {
+		magnets = f(magnets)
+	}
+
+	return magnets, nil
+}
+
+// BelowCutoff returns true if an item downloaded in the quality should be upgraded
+func (p Profile) BelowCutoff(q storage.Quality) bool {
+	return p.Cutoff != "" && qualityScore[q] < qualityScore[p.Cutoff]
+}
+
+// Upgrade returns the best magnet which is ranked above the current one by the profile,
+// and has a better quality. It returns false if the current magnet reached the cutoff,
+// or if there is nothing better.
+func (p Profile) Upgrade(current storage.Magnet, magnets []storage.Magnet) (storage.Magnet, bool, error) {
+	if !p.BelowCutoff(current.Quality) {
+		return storage.Magnet{}, false, nil
+	}
+
+	candidates := []storage.Magnet{current}
+	for _, m := range magnets {
+		if m.Location != current.Location {
+			candidates = append(candidates, m)
+		}
+	}
+
+	ranked, err := p.Process(candidates)
+	if err != nil {
+		return storage.Magnet{}, false, err
+	}
+
+	for _, m := range ranked {
+		if m.Location == current.Location {
+			break
+		}
+		if qualityScore[m.Quality] > qualityScore[current.Quality] {
+			return m, true, nil
+		}
+	}
+
+	return storage.Magnet{}, false, nil
+}
+
+// For returns the profile assigned to the item
+func (p Profiles) For(item media.SearchItem) Profile {
+	for _, key := range []string{item.IMDb, item.Term, item.Name()} {
+		if profile, ok := p.Items[key]; ok && key != "" {
+			return profile
+		}
+	}
+
+	if profile, ok := p.Types[item.Type]; ok {
+		return profile
+	}
+
+	return p.Default
+}
+
+// Validate checks that all profiles can be compiled
+func (p Profiles) Validate() error {
+	if _, err := p.Default.Processors(); err != nil {
+		return fmt.Errorf("default profile: %s", err)
+	}
+
+	for t, profile := range p.Types {
+		if _, err := profile.Processors(); err != nil {
+			return fmt.Errorf("profile for %s: %s", t, err)
+		}
+	}
+
+	for key, profile := range p.Items {
+		if _, err := profile.Processors(); err != nil {
+			return fmt.Errorf("profile for %q: %s", key, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile_Process(t *testing.T) {
+	magnets := []storage.Magnet{
+		{Size: 9, Encoding: storage.Encodingx265, Quality: storage.Quality4K},
+		{Size: 8, Encoding: storage.Encodingx264, Quality: storage.QualityFHD},
+		{Size: 2, Encoding: storage.EncodingXVID, Quality: storage.QualitySD},
+		{Size: 5, Encoding: storage.Encodingx265, Quality: storage.QualityFHD},
+		{Size: 3, Encoding: storage.Encodingx264, Quality: storage.QualityHD},
+	}
+
+	testCases := []struct {
+		desc     string
+		profile  magnet.Profile
+		expected []storage.Magnet
+	}{
+		{
+			desc:    "default profile",
+			profile: magnet.DefaultProfile,
+			expected: []storage.Magnet{
+				{Size: 5, Encoding: storage.Encodingx265, Quality: storage.QualityFHD},
+				{Size: 8, Encoding: storage.Encodingx264, Quality: storage.QualityFHD},
+				{Size: 3, Encoding: storage.Encodingx264, Quality: storage.QualityHD},
+			},
+		},
+		{
+			desc: "size bounds and smallest first",
+			profile: magnet.Profile{
+				MinSize: 3,
+				MaxSize: 8,
+				Order:   []magnet.SortKey{{By: magnet.SortBySize}},
+			},
+			expected: []storage.Magnet{
+				{Size: 3, Encoding: storage.Encodingx264, Quality: storage.QualityHD},
+				{Size: 5, Encoding: storage.Encodingx265, Quality: storage.QualityFHD},
+				{Size: 8, Encoding: storage.Encodingx264, Quality: storage.QualityFHD},
+			},
+		},
+		{
+			desc: "minimum quality only, largest first",
+			profile: magnet.Profile{
+				MinQuality: storage.QualityFHD,
+				Order:      []magnet.SortKey{{By: magnet.SortBySize, Desc: true}},
+			},
+			expected: []storage.Magnet{
+				{Size: 9, Encoding: storage.Encodingx265, Quality: storage.Quality4K},
+				{Size: 8, Encoding: storage.Encodingx264, Quality: storage.QualityFHD},
+				{Size: 5, Encoding: storage.Encodingx265, Quality: storage.QualityFHD},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			input := make([]storage.Magnet, len(magnets))
+			copy(input, magnets)
+
+			processed, err := test.profile.Process(input)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, processed)
+		})
+	}
+}
+
+func TestProfile_ProcessorsInvalid(t *testing.T) {
+	testCases := []magnet.Profile{
+		{MinQuality: "8K"},
+		{Encodings: []storage.Encoding{"AV1"}},
+		{Order: []magnet.SortKey{{By: "title"}}},
+		{Cutoff: "8K"},
+	}
+
+	for _, profile := range testCases {
+		_, err := profile.Processors()
+		assert.Error(t, err)
+	}
+}
+
+func TestProfile_Upgrade(t *testing.T) {
+	profile := magnet.Profile{
+		MaxQuality: storage.QualityFHD,
+		Cutoff:     storage.QualityFHD,
+		Order:      []magnet.SortKey{{By: magnet.SortByQuality, Desc: true}, {By: magnet.SortBySize}},
+	}
+
+	hd := storage.Magnet{Location: "hd", Quality: storage.QualityHD, Size: 2}
+	smallHD := storage.Magnet{Location: "small-hd", Quality: storage.QualityHD, Size: 1}
+	fhd := storage.Magnet{Location: "fhd", Quality: storage.QualityFHD, Size: 5}
+	smallFHD := storage.Magnet{Location: "small-fhd", Quality: storage.QualityFHD, Size: 4}
+	uhd := storage.Magnet{Location: "4k", Quality: storage.Quality4K, Size: 9}
+
+	testCases := []struct {
+		desc     string
+		profile  magnet.Profile
+		current  storage.Magnet
+		magnets  []storage.Magnet
+		expected storage.Magnet
+		upgrade  bool
+	}{
+		{
+			desc:     "best ranked better quality",
+			profile:  profile,
+			current:  hd,
+			magnets:  []storage.Magnet{fhd, smallFHD, hd},
+			expected: smallFHD,
+			upgrade:  true,
+		},
+		{
+			desc:    "same quality is not an upgrade",
+			profile: profile,
+			current: hd,
+			magnets: []storage.Magnet{smallHD},
+		},
+		{
+			desc:    "quality outside of the profile",
+			profile: profile,
+			current: hd,
+			magnets: []storage.Magnet{uhd},
+		},
+		{
+			desc:    "cutoff reached",
+			profile: profile,
+			current: fhd,
+			magnets: []storage.Magnet{uhd, smallFHD},
+		},
+		{
+			desc:    "no cutoff",
+			profile: magnet.DefaultProfile,
+			current: hd,
+			magnets: []storage.Magnet{fhd},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			m, ok, err := test.profile.Upgrade(test.current, test.magnets)
+			assert.NoError(t, err)
+			assert.Equal(t, test.upgrade, ok)
+			assert.Equal(t, test.expected, m)
+		})
+	}
+}
+
+func TestProfiles_For(t *testing.T) {
+	def := magnet.Profile{MaxSize: 1}
+	movies := magnet.Profile{MaxSize: 2}
+	show := magnet.Profile{MaxSize: 3}
+	movie := magnet.Profile{MaxSize: 4}
+
+	profiles := magnet.Profiles{
+		Default: def,
+		Types:   map[media.Type]magnet.Profile{media.TypeMovie: movies},
+		Items: map[string]magnet.Profile{
+			"Show":      show,
+			"tt0111161": movie,
+		},
+	}
+
+	assert.Equal(t, def, profiles.For(media.NewEpisode("Other", 1, 2, "")))
+	assert.Equal(t, show, profiles.For(media.NewEpisode("Show", 1, 2, "")))
+	assert.Equal(t, show, profiles.For(media.NewSeason("Show", 1, "")))
+	assert.Equal(t, movies, profiles.For(media.NewMovie("Movie", 2019, "")))
+	assert.Equal(t, movie, profiles.For(media.NewMovie("Movie", 1994, "tt0111161")))
+}
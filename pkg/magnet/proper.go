@@ -0,0 +1,37 @@
+package magnet
+
+import (
+	"strings"
+
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// Proper returns the first PROPER or REPACK magnet which fixes the current one. It has to
+// be of the same quality, and come from the same group or one of the preferred groups.
+// Nothing is returned for a current magnet which is already a PROPER.
+func Proper(current storage.Magnet, magnets []storage.Magnet, preferred []string) (storage.Magnet, bool) {
+	if current.Proper {
+		return storage.Magnet{}, false
+	}
+
+	for _, m := range magnets {
+		if !m.Proper || m.Location == current.Location || m.Quality != current.Quality {
+			continue
+		}
+
+		if sameGroup(m.Group, current.Group) {
+			return m, true
+		}
+		for _, g := range preferred {
+			if sameGroup(m.Group, g) {
+				return m, true
+			}
+		}
+	}
+
+	return storage.Magnet{}, false
+}
+
+func sameGroup(a, b string) bool {
+	return a != "" && strings.EqualFold(a, b)
+}
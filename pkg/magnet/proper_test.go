@@ -0,0 +1,69 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProper(t *testing.T) {
+	current := storage.Magnet{Location: "1", Quality: storage.QualityFHD, Group: "NTb"}
+
+	testCases := []struct {
+		desc      string
+		current   storage.Magnet
+		magnets   []storage.Magnet
+		preferred []string
+		expected  storage.Magnet
+		found     bool
+	}{
+		{
+			desc:    "proper of the same group",
+			current: current,
+			magnets: []storage.Magnet{
+				{Location: "2", Quality: storage.QualityFHD, Group: "NTb"},
+				{Location: "3", Quality: storage.QualityFHD, Group: "ntb", Proper: true},
+			},
+			expected: storage.Magnet{Location: "3", Quality: storage.QualityFHD, Group: "ntb", Proper: true},
+			found:    true,
+		},
+		{
+			desc:      "proper of a preferred group",
+			current:   current,
+			magnets:   []storage.Magnet{{Location: "2", Quality: storage.QualityFHD, Group: "KiNGS", Proper: true}},
+			preferred: []string{"KINGS"},
+			expected:  storage.Magnet{Location: "2", Quality: storage.QualityFHD, Group: "KiNGS", Proper: true},
+			found:     true,
+		},
+		{
+			desc:    "proper of another group",
+			current: current,
+			magnets: []storage.Magnet{{Location: "2", Quality: storage.QualityFHD, Group: "KiNGS", Proper: true}},
+		},
+		{
+			desc:    "proper of another quality",
+			current: current,
+			magnets: []storage.Magnet{{Location: "2", Quality: storage.QualityHD, Group: "NTb", Proper: true}},
+		},
+		{
+			desc:    "unknown groups",
+			current: storage.Magnet{Location: "1", Quality: storage.QualityFHD},
+			magnets: []storage.Magnet{{Location: "2", Quality: storage.QualityFHD, Proper: true}},
+		},
+		{
+			desc:    "already a proper",
+			current: storage.Magnet{Location: "1", Quality: storage.QualityFHD, Group: "NTb", Proper: true},
+			magnets: []storage.Magnet{{Location: "2", Quality: storage.QualityFHD, Group: "NTb", Proper: true}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			m, found := magnet.Proper(test.current, test.magnets, test.preferred)
+			assert.Equal(t, test.found, found)
+			assert.Equal(t, test.expected, m)
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package magnet
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nenad/couch/pkg/storage"
+)
+
+type (
+	// Release is the information which could be parsed from the name of a release
+	Release struct {
+		// Title is the name of the movie or the TV show
+		Title string
+		Year  int
+		// Resolution is the vertical resolution, ex. 1080, and zero if unknown
+		Resolution int
+		Source     storage.Source
+		Remux      bool
+		// Codec is the video codec as named by couch, ex. "x265" or "AV1"
+		Codec string
+		// HDR is the HDR format, ex. "HDR10+", and empty for SDR releases
+		HDR         string
+		DolbyVision bool
+		// Audio is the audio format, ex. "DTS-HD MA" or "DD+", along with its channels, ex. "5.1"
+		Audio    string
+		Channels string
+		Atmos    bool
+		Group    string
+		Proper   bool
+		Repack   bool
+		// Season and SeasonEnd are the range of seasons, which are the same for a single season
+		Season    int
+		SeasonEnd int
+		// Episode and EpisodeEnd are the range of episodes, which are zero for whole seasons
+		Episode    int
+		EpisodeEnd int
+		// Complete is set for releases containing a whole show or season
+		Complete  bool
+		Languages []string
+	}
+
+	// token is a pattern which is searched for in the name of a release
+	token struct {
+		regex *regexp.Regexp
+		value string
+	}
+)
+
+// tokenRegex matches the pattern as a whole word, where dots, dashes, underscores
+// and spaces separate the words of a release name
+func tokenRegex(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[\s._\-\[\](){}+])(?:` + pattern + `)(?:$|[\s._\-\[\](){}+])`)
+}
+
+var (
+	resolutionTokens = []token{
+		{tokenRegex(`2160[pi]|4k|uhd`), "2160"},
+		{tokenRegex(`1080[pi]`), "1080"},
+		{tokenRegex(`720[pi]`), "720"},
+		{tokenRegex(`576[pi]`), "576"},
+		{tokenRegex(`480[pi]`), "480"},
+	}
+
+	// The order matters, ex. WEBRip has to be checked before WEB
+	sourceTokens = []token{
+		{tokenRegex(`(?:hd)?cam(?:rip)?`), string(storage.SourceCAM)},
+		{tokenRegex(`(?:hd)?ts|telesync|pdvd`), string(storage.SourceTelesync)},
+		{tokenRegex(`(?:hd)?tc|telecine`), string(storage.SourceTelecine)},
+		{tokenRegex(`(?:dvd)?scr(?:eener)?`), string(storage.SourceScreener)},
+		{tokenRegex(`web[ .\-]?rip`), string(storage.SourceWEBRip)},
+		{tokenRegex(`web[ .\-]?dl|web`), string(storage.SourceWEBDL)},
+		{tokenRegex(`blu[ .\-]?ray|bd[ .\-]?rip|br[ .\-]?rip|bd[ .\-]?remux|bd25|bd50`), string(storage.SourceBluRay)},
+		{tokenRegex(`hdtv|pdtv|sdtv|dsr|tvrip`), string(storage.SourceHDTV)},
+		{tokenRegex(`dvd[ .\-]?rip|dvdr|dvd5|dvd9|dvd`), string(storage.SourceDVD)},
+	}
+
+	codecTokens = []token{
+		{tokenRegex(`[xh][ .]?265|hevc`), string(storage.Encodingx265)},
+		{tokenRegex(`[xh][ .]?264|avc`), string(storage.Encodingx264)},
+		{tokenRegex(`av1`), "AV1"},
+		{tokenRegex(`xvid|divx`), string(storage.EncodingXVID)},
+		{tokenRegex(`vc[ .\-]?1`), string(storage.EncodingVC1)},
+		{tokenRegex(`mpeg[ .\-]?2`), "MPEG-2"},
+	}
+
+	hdrTokens = []token{
+		{tokenRegex(`hdr10(?:\+|plus)|hdr10p`), "HDR10+"},
+		{tokenRegex(`hdr10`), "HDR10"},
+		{tokenRegex(`hdr`), "HDR"},
+	}
+
+	// Channels may follow the audio format directly, ex. DDP5.1
+	channels    = `(?:[ .]?([1-9][ .][0-2]))?`
+	audioTokens = []token{
+		{tokenRegex(`truehd` + channels), "TrueHD"},
+		{tokenRegex(`dts[ .\-]?hd[ .\-]?ma` + channels), "DTS-HD MA"},
+		{tokenRegex(`dts[ .\-:]?x` + channels), "DTS:X"},
+		{tokenRegex(`dts(?:[ .\-]?hd)?` + channels), "DTS"},
+		{tokenRegex(`(?:ddp|dd\+|e[ .\-]?ac[ .\-]?3)` + channels), "DD+"},
+		{tokenRegex(`(?:dd|ac3)` + channels), "DD"},
+		{tokenRegex(`aac` + channels), "AAC"},
+		{tokenRegex(`flac` + channels), "FLAC"},
+		{tokenRegex(`opus` + channels), "Opus"},
+		{tokenRegex(`mp3`), "MP3"},
+	}
+
+	languageTokens = []token{
+		{tokenRegex(`multi(?:[ .\-]?(?:subs?|audio))?`), "multi"},
+		{tokenRegex(`english|eng`), "english"},
+		{tokenRegex(`(?:true)?french|vff|vfq|vf2`), "french"},
+		{tokenRegex(`german|ger|deutsch`), "german"},
+		{tokenRegex(`italian|ita`), "italian"},
+		{tokenRegex(`spanish|esp|castellano|latino`), "spanish"},
+		{tokenRegex(`russian|rus`), "russian"},
+		{tokenRegex(`japanese|jap`), "japanese"},
+		{tokenRegex(`korean|kor`), "korean"},
+		{tokenRegex(`hindi`), "hindi"},
+		{tokenRegex(`dutch|nl`), "dutch"},
+		{tokenRegex(`polish|pl`), "polish"},
+	}
+
+	remuxRegex    = tokenRegex(`remux`)
+	dvRegex       = tokenRegex(`dv|dovi|dolby[ .]?vision`)
+	atmosRegex    = tokenRegex(`atmos`)
+	properRegex   = tokenRegex(`proper|real`)
+	repackRegex   = tokenRegex(`repack\d?|rerip`)
+	completeRegex = tokenRegex(`complete`)
+	// The separator after the year isn't matched, so years can follow each other
+	yearRegex = regexp.MustCompile(`(?:^|[\s._\-\[(])(19\d{2}|20\d{2})`)
+
+	// Ranges, ex. S01E01-E03, S01E01E02 or S01E01-03
+	episodeRegex = regexp.MustCompile(`(?i)(?:^|[\s._\-\[(])S(\d{1,2})[ .\-]?E(\d{1,3})((?:[ .\-]?-?[ .\-]?E?\d{1,3}(?:$|[^\dp]))*)`)
+	// 1x05 or 1x05-07
+	crossRegex = regexp.MustCompile(`(?i)(?:^|[\s._\-\[(])(\d{1,2})x(\d{2,3})(?:-(\d{2,3}))?(?:$|[\s._\-\])])`)
+	// S01-S03, S01-03, S01 or Season 1-3
+	seasonRegex      = regexp.MustCompile(`(?i)(?:^|[\s._\-\[(])(?:S|Seasons?[ .]?)(\d{1,2})(?:[ .]?-[ .]?S?(\d{1,2}))?(?:$|[\s._\-\])])`)
+	episodeListRegex = regexp.MustCompile(`\d{1,3}`)
+
+	groupRegex  = regexp.MustCompile(`-[ ]?([A-Za-z0-9][A-Za-z0-9_]*)\s*(?:\[[^\]]*\])?\s*(?:\.(?:mkv|mp4|avi|m4v|torrent))?$`)
+	prefixRegex = regexp.MustCompile(`^(?:\[[^\]]*\]|www\.\S+\s*-)\s*`)
+)
+
+// notGroups are words which can end a release name after a dash, but aren't groups
+var notGroups = map[string]bool{"DL": true, "RIP": true, "RAY": true, "HD": true, "X": true, "MA": true}
+
+// ParseRelease parses the name of a release, ex. "Show.S01E02.1080p.WEB-DL.DDP5.1.H.264-GROUP",
+// where everything which couldn't be recognized is left empty
+func ParseRelease(name string) Release {
+	r := Release{}
+	name = strings.TrimSpace(prefixRegex.ReplaceAllString(strings.TrimSpace(name), ""))
+
+	// The title ends at the episodes, the year or the resolution, whichever comes first
+	end := len(name)
+	cut := func(idx []int, offset int) {
+		if idx != nil && idx[0]+offset < end {
+			end = idx[0] + offset
+		}
+	}
+
+	cut(parseEpisodes(&r, name), 0)
+	if v, idx := find(resolutionTokens, name); v != "" {
+		r.Resolution, _ = strconv.Atoi(v)
+		cut(idx, 0)
+	}
+
+	// The last year before the rest, as titles can contain years as well
+	var year []int
+	for _, m := range yearRegex.FindAllStringSubmatchIndex(name, -1) {
+		if m[2] > 0 && m[0] <= end && (m[3] == len(name) || isSeparator(name[m[3]])) {
+			year = m
+		}
+	}
+	if year != nil {
+		r.Year, _ = strconv.Atoi(name[year[2]:year[3]])
+		cut(year, 0)
+	}
+
+	// Everything else is searched after the title, unless the title couldn't be
+	// found, in which case it ends at the first recognized part
+	offset := 0
+	if end < len(name) {
+		offset = end
+	}
+	rest := name[offset:]
+
+	// Words of an episode title can look like a source as well, ex. "The.Ts.Of.Life.720p.HDTV"
+	if v, idx := findLast(sourceTokens, rest); v != "" {
+		r.Source = storage.Source(v)
+		cut(idx, offset)
+	}
+	if v, idx := find(codecTokens, rest); v != "" {
+		r.Codec = v
+		cut(idx, offset)
+	}
+	if v, idx := find(hdrTokens, rest); v != "" {
+		r.HDR = v
+		cut(idx, offset)
+	}
+	for _, t := range audioTokens {
+		if m := t.regex.FindStringSubmatchIndex(rest); m != nil {
+			r.Audio = t.value
+			if len(m) > 2 && m[2] >= 0 {
+				r.Channels = strings.Replace(rest[m[2]:m[3]], " ", ".", 1)
+			}
+			cut(m, offset)
+			break
+		}
+	}
+
+	flags := []struct {
+		regex *regexp.Regexp
+		value *bool
+	}{
+		{remuxRegex, &r.Remux},
+		{dvRegex, &r.DolbyVision},
+		{atmosRegex, &r.Atmos},
+		{properRegex, &r.Proper},
+		{repackRegex, &r.Repack},
+		{completeRegex, &r.Complete},
+	}
+	for _, f := range flags {
+		if idx := f.regex.FindStringIndex(rest); idx != nil && idx[0]+offset > 0 {
+			*f.value = true
+			cut(idx, offset)
+		}
+	}
+	if r.Remux && r.Source == "" {
+		r.Source = storage.SourceBluRay
+	}
+
+	for _, t := range languageTokens {
+		if idx := t.regex.FindStringIndex(name); idx != nil && idx[0] >= end {
+			r.Languages = append(r.Languages, t.value)
+		}
+	}
+
+	if m := groupRegex.FindStringSubmatch(name); m != nil && !notGroups[strings.ToUpper(m[1])] && !isNumber(m[1]) {
+		r.Group = m[1]
+	}
+
+	r.Title = cleanTitle(name[:end])
+
+	return r
+}
+
+// Quality maps the resolution to a quality, where an unknown resolution is SD. Releases
+// recorded in a cinema are SD regardless of their resolution.
+func (r Release) Quality() storage.Quality {
+	switch {
+	case r.Source.IsCinema():
+		return storage.QualitySD
+	case r.Resolution >= 2160:
+		return storage.Quality4K
+	case r.Resolution >= 1080:
+		return storage.QualityFHD
+	case r.Resolution >= 720:
+		return storage.QualityHD
+	default:
+		return storage.QualitySD
+	}
+}
+
+// Encoding maps the codec to one of the stored encodings, or EncodingUnknown
+func (r Release) Encoding() storage.Encoding {
+	switch storage.Encoding(r.Codec) {
+	case storage.Encodingx264, storage.Encodingx265, storage.EncodingXVID, storage.EncodingVC1:
+		return storage.Encoding(r.Codec)
+	default:
+		return storage.EncodingUnknown
+	}
+}
+
+// IsProper returns true for PROPER and REPACK releases, which fix a broken release
+func (r Release) IsProper() bool {
+	return r.Proper || r.Repack
+}
+
+// find returns the value of the first token found in the name, and where it was found
+func find(tokens []token, name string) (string, []int) {
+	for _, t := range tokens {
+		if idx := t.regex.FindStringIndex(name); idx != nil {
+			return t.value, idx
+		}
+	}
+	return "", nil
+}
+
+// findLast returns the value of the token found last in the name, and where it was found. Tokens
+// found at the same place are taken in their order.
+func findLast(tokens []token, name string) (string, []int) {
+	value, last := "", []int(nil)
+	for _, t := range tokens {
+		matches := t.regex.FindAllStringIndex(name, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if idx := matches[len(matches)-1]; last == nil || idx[0] > last[0] {
+			value, last = t.value, idx
+		}
+	}
+	return value, last
+}
+
+// parseEpisodes sets the seasons and episodes of the release, and returns where they were found
+func parseEpisodes(r *Release, name string) []int {
+	if m := episodeRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		r.SeasonEnd = r.Season
+		r.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		r.EpisodeEnd = r.Episode
+
+		// The rest of the range, ex. "-E03" or "E02E03"
+		var episodes []int
+		for _, e := range episodeListRegex.FindAllString(name[m[6]:m[7]], -1) {
+			n, _ := strconv.Atoi(e)
+			episodes = append(episodes, n)
+		}
+		sort.Ints(episodes)
+		if len(episodes) > 0 && episodes[len(episodes)-1] > r.Episode {
+			r.EpisodeEnd = episodes[len(episodes)-1]
+		}
+		return m
+	}
+
+	if m := crossRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		r.SeasonEnd = r.Season
+		r.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		r.EpisodeEnd = r.Episode
+		if m[6] >= 0 {
+			r.EpisodeEnd, _ = strconv.Atoi(name[m[6]:m[7]])
+		}
+		return m
+	}
+
+	if m := seasonRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		r.SeasonEnd = r.Season
+		if m[4] >= 0 {
+			r.SeasonEnd, _ = strconv.Atoi(name[m[4]:m[5]])
+		}
+		return m
+	}
+
+	return nil
+}
+
+func cleanTitle(title string) string {
+	title = strings.NewReplacer(".", " ", "_", " ").Replace(title)
+	title = strings.Join(strings.Fields(title), " ")
+	return strings.Trim(title, " -[(")
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func isSeparator(c byte) bool {
+	return strings.IndexByte(" ._-[](){}+", c) >= 0
+}
@@ -0,0 +1,309 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelease(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected magnet.Release
+	}{
+		{
+			name: "The.Matrix.1999.1080p.BluRay.x264-GROUP",
+			expected: magnet.Release{
+				Title: "The Matrix", Year: 1999, Resolution: 1080, Source: storage.SourceBluRay, Codec: "x264", Group: "GROUP",
+			},
+		},
+		{
+			name: "Blade.Runner.2049.2017.2160p.UHD.BluRay.REMUX.HDR.HEVC.TrueHD.7.1.Atmos-FGT",
+			expected: magnet.Release{
+				Title: "Blade Runner 2049", Year: 2017, Resolution: 2160, Source: storage.SourceBluRay, Remux: true,
+				Codec: "x265", HDR: "HDR", Audio: "TrueHD", Channels: "7.1", Atmos: true, Group: "FGT",
+			},
+		},
+		{
+			name: "2001.A.Space.Odyssey.1968.720p.BRRip.XviD.AC3-FLAWL3SS",
+			expected: magnet.Release{
+				Title: "2001 A Space Odyssey", Year: 1968, Resolution: 720, Source: storage.SourceBluRay, Codec: "XviD",
+				Audio: "DD", Group: "FLAWL3SS",
+			},
+		},
+		{
+			name: "1917 (2019) [1080p] [WEBRip] [5.1] [YTS.MX]",
+			expected: magnet.Release{
+				Title: "1917", Year: 2019, Resolution: 1080, Source: storage.SourceWEBRip,
+			},
+		},
+		{
+			name: "Show.Name.S01E02.1080p.WEB-DL.DDP5.1.H.264-NTb",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 1080, Source: storage.SourceWEBDL, Codec: "x264", Audio: "DD+", Channels: "5.1",
+				Group: "NTb", Season: 1, SeasonEnd: 1, Episode: 2, EpisodeEnd: 2,
+			},
+		},
+		{
+			name: "Show Name S03E10 720p HDTV x264-SVA[eztv].mkv",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 720, Source: storage.SourceHDTV, Codec: "x264", Group: "SVA",
+				Season: 3, SeasonEnd: 3, Episode: 10, EpisodeEnd: 10,
+			},
+		},
+		{
+			name: "Show.Name.S02E05.PROPER.720p.HDTV.x264-KILLERS",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 720, Source: storage.SourceHDTV, Codec: "x264", Group: "KILLERS", Proper: true,
+				Season: 2, SeasonEnd: 2, Episode: 5, EpisodeEnd: 5,
+			},
+		},
+		{
+			name: "Show.Name.S02E05.REPACK.1080p.AMZN.WEB-DL.DD+5.1.H.264-CtrlHD",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 1080, Source: storage.SourceWEBDL, Codec: "x264", Audio: "DD+", Channels: "5.1",
+				Group: "CtrlHD", Repack: true, Season: 2, SeasonEnd: 2, Episode: 5, EpisodeEnd: 5,
+			},
+		},
+		{
+			name: "Show.Name.S01E01-E03.1080p.WEB.h264-GRP",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 1080, Source: storage.SourceWEBDL, Codec: "x264", Group: "GRP",
+				Season: 1, SeasonEnd: 1, Episode: 1, EpisodeEnd: 3,
+			},
+		},
+		{
+			name: "Show.Name.S01E01E02.720p.HDTV.x264-GRP",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 720, Source: storage.SourceHDTV, Codec: "x264", Group: "GRP",
+				Season: 1, SeasonEnd: 1, Episode: 1, EpisodeEnd: 2,
+			},
+		},
+		{
+			name: "Show Name S04E11-12 1080p",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 1080, Season: 4, SeasonEnd: 4, Episode: 11, EpisodeEnd: 12,
+			},
+		},
+		{
+			name: "Show.Name.1x05.HDTV.XviD-LOL",
+			expected: magnet.Release{
+				Title: "Show Name", Source: storage.SourceHDTV, Codec: "XviD", Group: "LOL",
+				Season: 1, SeasonEnd: 1, Episode: 5, EpisodeEnd: 5,
+			},
+		},
+		{
+			name: "Show.Name.S02.1080p.BluRay.x265-GRP",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 1080, Source: storage.SourceBluRay, Codec: "x265", Group: "GRP",
+				Season: 2, SeasonEnd: 2,
+			},
+		},
+		{
+			name: "Show Name S01-S03 COMPLETE 720p WEBRip x264",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 720, Source: storage.SourceWEBRip, Codec: "x264", Complete: true,
+				Season: 1, SeasonEnd: 3,
+			},
+		},
+		{
+			name: "Show Name Season 2 Complete 1080p",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 1080, Complete: true, Season: 2, SeasonEnd: 2,
+			},
+		},
+		{
+			name: "Show Name (2019) S01E01 2160p DV HDR10+ WEB-DL DDP5.1 Atmos x265",
+			expected: magnet.Release{
+				Title: "Show Name", Year: 2019, Resolution: 2160, Source: storage.SourceWEBDL, Codec: "x265", HDR: "HDR10+",
+				DolbyVision: true, Audio: "DD+", Channels: "5.1", Atmos: true, Season: 1, SeasonEnd: 1, Episode: 1, EpisodeEnd: 1,
+			},
+		},
+		{
+			name: "Movie.Name.2019.HDCAM.x264-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2019, Source: storage.SourceCAM, Codec: "x264", Group: "GRP",
+			},
+		},
+		{
+			name: "Movie Name 2019 HDTS 720p",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2019, Resolution: 720, Source: storage.SourceTelesync,
+			},
+		},
+		{
+			name: "Movie.Name.2019.DVDScr.XviD-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2019, Source: storage.SourceScreener, Codec: "XviD", Group: "GRP",
+			},
+		},
+		{
+			name: "Movie.Name.2005.DVDRip.XviD-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2005, Source: storage.SourceDVD, Codec: "XviD", Group: "GRP",
+			},
+		},
+		{
+			name: "Movie.Name.2012.MULTi.TRUEFRENCH.1080p.BluRay.DTS-HD.MA.5.1.x264-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2012, Resolution: 1080, Source: storage.SourceBluRay, Codec: "x264",
+				Audio: "DTS-HD MA", Channels: "5.1", Group: "GRP", Languages: []string{"multi", "french"},
+			},
+		},
+		{
+			name: "Movie Name 2016 GERMAN DL 1080p BluRay AVC-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2016, Resolution: 1080, Source: storage.SourceBluRay, Codec: "x264",
+				Group: "GRP", Languages: []string{"german"},
+			},
+		},
+		{
+			name: "Movie.Name.2018.ITA.ENG.720p.BluRay.x264.AAC2.0",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2018, Resolution: 720, Source: storage.SourceBluRay, Codec: "x264",
+				Audio: "AAC", Channels: "2.0", Languages: []string{"english", "italian"},
+			},
+		},
+		{
+			name: "Movie.Name.2020.1080p.WEB-DL.AV1.Opus.5.1-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2020, Resolution: 1080, Source: storage.SourceWEBDL, Codec: "AV1",
+				Audio: "Opus", Channels: "5.1", Group: "GRP",
+			},
+		},
+		{
+			name: "Movie.Name.2008.1080p.BluRay.VC-1.DTS-HD.MA.5.1-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2008, Resolution: 1080, Source: storage.SourceBluRay, Codec: "VC-1",
+				Audio: "DTS-HD MA", Channels: "5.1", Group: "GRP",
+			},
+		},
+		{
+			name: "Movie.Name.2019.4K.HDR10.2160p.WEB-DL.DTS-X.7.1.HEVC",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2019, Resolution: 2160, Source: storage.SourceWEBDL, Codec: "x265", HDR: "HDR10",
+				Audio: "DTS:X", Channels: "7.1",
+			},
+		},
+		{
+			name: "Movie.Name.2019.REAL.PROPER.1080p.WEB.H265-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2019, Resolution: 1080, Source: storage.SourceWEBDL, Codec: "x265", Proper: true,
+				Group: "GRP",
+			},
+		},
+		{
+			name: "Movie.Name.2014.1080p.BluRay.REMUX.AVC.DTS-HD.MA.5.1-EPSiLON",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2014, Resolution: 1080, Source: storage.SourceBluRay, Remux: true, Codec: "x264",
+				Audio: "DTS-HD MA", Channels: "5.1", Group: "EPSiLON",
+			},
+		},
+		{
+			name: "Movie Name 2019 1080p WEB-DL",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2019, Resolution: 1080, Source: storage.SourceWEBDL,
+			},
+		},
+		{
+			name: "Charlottes Web 2006 720p BluRay FLAC",
+			expected: magnet.Release{
+				Title: "Charlottes Web", Year: 2006, Resolution: 720, Source: storage.SourceBluRay, Audio: "FLAC",
+			},
+		},
+		{
+			name: "[TGx] Movie.Name.2017.480p.DVDRip.MP3-GRP",
+			expected: magnet.Release{
+				Title: "Movie Name", Year: 2017, Resolution: 480, Source: storage.SourceDVD, Audio: "MP3", Group: "GRP",
+			},
+		},
+		{
+			name: "www.Torrenting.com - Show.Name.S05E01.576p.PDTV.x264-GRP",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 576, Source: storage.SourceHDTV, Codec: "x264", Group: "GRP",
+				Season: 5, SeasonEnd: 5, Episode: 1, EpisodeEnd: 1,
+			},
+		},
+		{
+			name: "Show_Name_S10E100_720p_HDTV_x264-GRP",
+			expected: magnet.Release{
+				Title: "Show Name", Resolution: 720, Source: storage.SourceHDTV, Codec: "x264", Group: "GRP",
+				Season: 10, SeasonEnd: 10, Episode: 100, EpisodeEnd: 100,
+			},
+		},
+		{
+			name: "Show.Name.2018.S01E01.Pilot.1080p.NF.WEB-DL.DDP5.1.x264-NTG",
+			expected: magnet.Release{
+				Title: "Show Name", Year: 2018, Resolution: 1080, Source: storage.SourceWEBDL, Codec: "x264", Audio: "DD+",
+				Channels: "5.1", Group: "NTG", Season: 1, SeasonEnd: 1, Episode: 1, EpisodeEnd: 1,
+			},
+		},
+		{
+			name: "Show.S03E01.The.Ts.Of.Life.720p.HDTV.x264-GRP",
+			expected: magnet.Release{
+				Title: "Show", Resolution: 720, Source: storage.SourceHDTV, Codec: "x264", Group: "GRP",
+				Season: 3, SeasonEnd: 3, Episode: 1, EpisodeEnd: 1,
+			},
+		},
+		{
+			name: "Show.S02E05.Cam.Girl.1080p.WEB-DL",
+			expected: magnet.Release{
+				Title: "Show", Resolution: 1080, Source: storage.SourceWEBDL,
+				Season: 2, SeasonEnd: 2, Episode: 5, EpisodeEnd: 5,
+			},
+		},
+		{
+			name: "Some Random Name",
+			expected: magnet.Release{
+				Title: "Some Random Name",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, magnet.ParseRelease(test.name))
+		})
+	}
+}
+
+func TestRelease_Quality(t *testing.T) {
+	testCases := []struct {
+		resolution int
+		source     storage.Source
+		quality    storage.Quality
+	}{
+		{0, "", storage.QualitySD},
+		{480, storage.SourceDVD, storage.QualitySD},
+		{576, "", storage.QualitySD},
+		{720, storage.SourceHDTV, storage.QualityHD},
+		{1080, storage.SourceWEBDL, storage.QualityFHD},
+		{1080, storage.SourceCAM, storage.QualitySD},
+		{1080, storage.SourceTelesync, storage.QualitySD},
+		{2160, storage.SourceBluRay, storage.Quality4K},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.quality, magnet.Release{Resolution: test.resolution, Source: test.source}.Quality())
+	}
+}
+
+func TestRelease_Encoding(t *testing.T) {
+	testCases := []struct {
+		codec    string
+		encoding storage.Encoding
+	}{
+		{"x264", storage.Encodingx264},
+		{"x265", storage.Encodingx265},
+		{"XviD", storage.EncodingXVID},
+		{"VC-1", storage.EncodingVC1},
+		{"AV1", storage.EncodingUnknown},
+		{"", storage.EncodingUnknown},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.encoding, magnet.Release{Codec: test.codec}.Encoding())
+	}
+}
@@ -0,0 +1,83 @@
+package magnet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// Megabyte is the unit of the sizes in the config
+const Megabyte = 1 << 20
+
+// DefaultSizeBounds allow everything from small x265 encodes up to remuxes of the quality
+var DefaultSizeBounds = SizeBounds{
+	storage.QualitySD:  {Min: 1 * Megabyte, Max: 25 * Megabyte},
+	storage.QualityHD:  {Min: 3 * Megabyte, Max: 80 * Megabyte},
+	storage.QualityFHD: {Min: 5 * Megabyte, Max: 250 * Megabyte},
+	storage.Quality4K:  {Min: 15 * Megabyte, Max: 600 * Megabyte},
+}
+
+// DefaultRuntimes are used for items whose runtime is unknown
+var DefaultRuntimes = map[media.Type]time.Duration{
+	media.TypeMovie:   time.Minute * 120,
+	media.TypeEpisode: time.Minute * 45,
+	media.TypeSeason:  time.Minute * 45 * 10,
+}
+
+type (
+	// SizeBounds are the allowed sizes per minute of runtime, keyed by quality
+	SizeBounds map[storage.Quality]SizeRange
+
+	// SizeRange bounds the size in bytes per minute, zero means unbounded
+	SizeRange struct {
+		Min uint64
+		Max uint64
+	}
+
+	// RejectFunc is called with every magnet which was filtered out, and the reason for it
+	RejectFunc func(m storage.Magnet, reason string)
+)
+
+// FilterSizePerMinute drops the magnets which are too small or too big for the runtime of
+// their item, ex. fakes or remuxes. Items without a runtime use the runtime of their type,
+// and magnets with an unknown size or quality are kept.
+func FilterSizePerMinute(bounds SizeBounds, runtimes map[media.Type]time.Duration, reject RejectFunc) ProcessFunc {
+	return func(magnets []storage.Magnet) (new []storage.Magnet) {
+		for _, m := range magnets {
+			if reason := checkSize(m, bounds, runtimes); reason != "" {
+				if reject != nil {
+					reject(m, reason)
+				}
+				continue
+			}
+			new = append(new, m)
+		}
+
+		return new
+	}
+}
+
+func checkSize(m storage.Magnet, bounds SizeBounds, runtimes map[media.Type]time.Duration) string {
+	runtime := m.Item.Runtime
+	if runtime <= 0 {
+		runtime = runtimes[m.Item.Type]
+	}
+
+	limit, ok := bounds[m.Quality]
+	minutes := uint64(runtime / time.Minute)
+	if !ok || m.Size == 0 || minutes == 0 {
+		return ""
+	}
+
+	perMinute := m.Size / minutes
+	switch {
+	case limit.Min > 0 && perMinute < limit.Min:
+		return fmt.Sprintf("%d MB is too small for %d minutes of %s, expected at least %d MB", m.Size/Megabyte, minutes, m.Quality, limit.Min*minutes/Megabyte)
+	case limit.Max > 0 && perMinute > limit.Max:
+		return fmt.Sprintf("%d MB is too big for %d minutes of %s, expected at most %d MB", m.Size/Megabyte, minutes, m.Quality, limit.Max*minutes/Megabyte)
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package magnet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const mb = magnet.Megabyte
+
+func TestFilterSizePerMinute(t *testing.T) {
+	episode := media.NewEpisode("Show", 1, 2, "")
+	shortEpisode := episode
+	shortEpisode.Runtime = time.Minute * 22
+	movie := media.NewMovie("Movie", 2019, "")
+
+	testCases := []struct {
+		desc     string
+		magnet   storage.Magnet
+		rejected bool
+	}{
+		{
+			desc:   "regular episode",
+			magnet: storage.Magnet{Item: episode, Quality: storage.QualityFHD, Size: 1500 * mb},
+		},
+		{
+			desc:     "remux of a short episode",
+			magnet:   storage.Magnet{Item: shortEpisode, Quality: storage.QualityFHD, Size: 60000 * mb},
+			rejected: true,
+		},
+		{
+			desc:     "fake movie",
+			magnet:   storage.Magnet{Item: movie, Quality: storage.QualityFHD, Size: 200 * mb},
+			rejected: true,
+		},
+		{
+			desc:   "runtime of the item is preferred over the default",
+			magnet: storage.Magnet{Item: shortEpisode, Quality: storage.QualitySD, Size: 300 * mb},
+		},
+		{
+			desc:   "unknown size",
+			magnet: storage.Magnet{Item: movie, Quality: storage.Quality4K},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			var reasons []string
+			reject := func(m storage.Magnet, reason string) {
+				assert.Equal(t, test.magnet, m)
+				reasons = append(reasons, reason)
+			}
+
+			f := magnet.FilterSizePerMinute(magnet.DefaultSizeBounds, magnet.DefaultRuntimes, reject)
+			magnets := f([]storage.Magnet{test.magnet})
+
+			if test.rejected {
+				assert.Empty(t, magnets)
+				assert.Len(t, reasons, 1)
+			} else {
+				assert.Equal(t, []storage.Magnet{test.magnet}, magnets)
+				assert.Empty(t, reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package magnet
+
+import (
+	"sort"
+
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// healthySeeders is the number of seeders at which a torrent gets half of the seeder score
+const healthySeeders = 10
+
+// DefaultWeights prefer quality, followed by encoding and seeders, with size as a tie breaker
+var DefaultWeights = Weights{
+	Quality:  4,
+	Encoding: 2,
+	Size:     1,
+	Seeders:  2,
+}
+
+type scoredMagnet struct {
+	magnet storage.Magnet
+	score  float64
+}
+
+// Weights are the importance of each factor in the score of a magnet
+type Weights struct {
+	Quality  float64
+	Encoding float64
+	// Size favours smaller torrents
+	Size    float64
+	Seeders float64
+}
+
+// SortScore sorts the magnets by a weighted score from the best one, where each
+// factor is scaled between 0 and 1 before it is weighted
+func SortScore(w Weights) ProcessFunc {
+	return func(magnets []storage.Magnet) []storage.Magnet {
+		var maxSize uint64
+		for _, m := range magnets {
+			if m.Size > maxSize {
+				maxSize = m.Size
+			}
+		}
+
+		scored := make([]scoredMagnet, len(magnets))
+		for i, m := range magnets {
+			scored[i] = scoredMagnet{magnet: m, score: score(m, w, maxSize)}
+		}
+
+		sort.SliceStable(scored, func(i, j int) bool {
+			return scored[i].score > scored[j].score
+		})
+
+		for i := range scored {
+			magnets[i] = scored[i].magnet
+		}
+		return magnets
+	}
+}
+
+func score(m storage.Magnet, w Weights, maxSize uint64) float64 {
+	s := w.Quality * float64(qualityScore[m.Quality]) / float64(qualityScore[storage.Quality4K])
+	s += w.Encoding * float64(encodingScore[m.Encoding]) / float64(encodingScore[storage.Encodingx265])
+
+	if maxSize > 0 {
+		s += w.Size * (1 - float64(m.Size)/float64(maxSize))
+	}
+
+	// Health grows quickly with the first seeders, and flattens out afterwards
+	s += w.Seeders * float64(m.Seeders) / float64(m.Seeders+healthySeeders)
+
+	return s
+}
@@ -0,0 +1,66 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortScore(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		weights       magnet.Weights
+		magnets       []storage.Magnet
+		expectedOrder []string
+	}{
+		{
+			desc:    "quality wins over seeders",
+			weights: magnet.DefaultWeights,
+			magnets: []storage.Magnet{
+				{Location: "hd", Quality: storage.QualityHD, Encoding: storage.Encodingx264, Size: 1, Seeders: 500},
+				{Location: "fhd", Quality: storage.QualityFHD, Encoding: storage.Encodingx264, Size: 1, Seeders: 20},
+			},
+			expectedOrder: []string{"fhd", "hd"},
+		},
+		{
+			desc:    "dead torrent loses to a healthy one of the same quality",
+			weights: magnet.DefaultWeights,
+			magnets: []storage.Magnet{
+				{Location: "dead", Quality: storage.QualityFHD, Encoding: storage.Encodingx265, Size: 1, Seeders: 0},
+				{Location: "healthy", Quality: storage.QualityFHD, Encoding: storage.Encodingx264, Size: 1, Seeders: 50},
+			},
+			expectedOrder: []string{"healthy", "dead"},
+		},
+		{
+			desc:    "smaller is better with equal factors",
+			weights: magnet.DefaultWeights,
+			magnets: []storage.Magnet{
+				{Location: "big", Quality: storage.QualityFHD, Encoding: storage.Encodingx264, Size: 10, Seeders: 5},
+				{Location: "small", Quality: storage.QualityFHD, Encoding: storage.Encodingx264, Size: 5, Seeders: 5},
+			},
+			expectedOrder: []string{"small", "big"},
+		},
+		{
+			desc:    "only seeders matter",
+			weights: magnet.Weights{Seeders: 1},
+			magnets: []storage.Magnet{
+				{Location: "4k", Quality: storage.Quality4K, Seeders: 1},
+				{Location: "sd", Quality: storage.QualitySD, Seeders: 2},
+				{Location: "tie", Quality: storage.QualitySD, Seeders: 1},
+			},
+			expectedOrder: []string{"sd", "4k", "tie"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			var order []string
+			for _, m := range magnet.SortScore(test.weights)(test.magnets) {
+				order = append(order, m.Location)
+			}
+			assert.Equal(t, test.expectedOrder, order)
+		})
+	}
+}
@@ -1,10 +1,87 @@
 package magnet
 
 import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
 	"github.com/nenad/couch/pkg/media"
 	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
 )
 
 type Scraper interface {
 	Scrape(item media.SearchItem) ([]storage.Magnet, error)
 }
+
+// MultiScraper queries several scrapers in order of priority, and merges their results
+type MultiScraper struct {
+	scrapers []Scraper
+}
+
+func NewMultiScraper(scrapers ...Scraper) *MultiScraper {
+	return &MultiScraper{scrapers: scrapers}
+}
+
+// Scrape merges the magnets of all scrapers, where a torrent found by several of them is
+// kept only once, as returned by the first one. A failing scraper is skipped, and an error
+// is returned only if every scraper failed.
+func (s *MultiScraper) Scrape(item media.SearchItem) ([]storage.Magnet, error) {
+	var magnets []storage.Magnet
+	var errs []string
+	seen := make(map[string]bool)
+
+	for _, scraper := range s.scrapers {
+		results, err := scraper.Scrape(item)
+		if err != nil {
+			logrus.Warnf("could not scrape %q with %T: %s", item.Term, scraper, err)
+			errs = append(errs, fmt.Sprintf("%T: %s", scraper, err))
+			continue
+		}
+
+		for _, m := range results {
+			hash := InfoHash(m.Location)
+			if seen[hash] {
+				logrus.Debugf("skipping duplicate magnet %s for %q", m.Location, item.Term)
+				continue
+			}
+			seen[hash] = true
+			magnets = append(magnets, m)
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(s.scrapers) {
+		return nil, fmt.Errorf("all scrapers failed: %s", strings.Join(errs, "; "))
+	}
+
+	return magnets, nil
+}
+
+// InfoHash returns the lowercase hex info-hash of a magnet link. Locations which are
+// not magnet links are returned as they are.
+func InfoHash(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "magnet" {
+		return location
+	}
+
+	for _, xt := range u.Query()["xt"] {
+		if !strings.HasPrefix(xt, "urn:btih:") {
+			continue
+		}
+
+		hash := strings.TrimPrefix(xt, "urn:btih:")
+		// Older clients encode the hash in base32
+		if len(hash) == 32 {
+			if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+				return hex.EncodeToString(b)
+			}
+		}
+
+		return strings.ToLower(hash)
+	}
+
+	return location
+}
@@ -0,0 +1,127 @@
+package magnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// EZTVURL is the address of the public EZTV API
+const EZTVURL = "https://eztv.re/api"
+
+const (
+	eztvPageSize = 100
+	eztvMaxPages = 5
+)
+
+type (
+	// EZTVScraper finds TV shows on EZTV by their IMDb identifier
+	EZTVScraper struct {
+		client  *http.Client
+		baseURL string
+	}
+
+	eztvResponse struct {
+		TorrentsCount int           `json:"torrents_count"`
+		Torrents      []eztvTorrent `json:"torrents"`
+	}
+
+	eztvTorrent struct {
+		Title     string `json:"title"`
+		MagnetURL string `json:"magnet_url"`
+		Season    string `json:"season"`
+		Episode   string `json:"episode"`
+		Seeds     int    `json:"seeds"`
+		Peers     int    `json:"peers"`
+		SizeBytes string `json:"size_bytes"`
+	}
+)
+
+func NewEZTVScraper(client *http.Client, baseURL string) *EZTVScraper {
+	return &EZTVScraper{client: client, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (s *EZTVScraper) Scrape(item media.SearchItem) ([]storage.Magnet, error) {
+	// EZTV only has TV shows, and it can only be searched by IMDb
+	if item.Type == media.TypeMovie || item.IMDb == "" {
+		return nil, nil
+	}
+
+	season, episode := item.Episode()
+
+	var magnets []storage.Magnet
+	for page := 1; page <= eztvMaxPages; page++ {
+		resp, err := s.fetch(item.IMDb, page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range resp.Torrents {
+			if !eztvMatches(t, season, episode) {
+				continue
+			}
+
+			size, _ := strconv.ParseUint(t.SizeBytes, 10, 64)
+			release := ParseRelease(t.Title)
+			magnets = append(magnets, storage.Magnet{
+				Location: t.MagnetURL,
+				Name:     t.Title,
+				Quality:  release.Quality(),
+				Encoding: release.Encoding(),
+				Source:   release.Source,
+				Group:    release.Group,
+				Proper:   release.IsProper(),
+				Item:     item,
+				Size:     size,
+				Seeders:  t.Seeds,
+				Leechers: t.Peers,
+			})
+			logrus.Debugf("found magnet %s for %q", t.MagnetURL, item.Term)
+		}
+
+		if page*eztvPageSize >= resp.TorrentsCount {
+			break
+		}
+	}
+
+	return magnets, nil
+}
+
+func (s *EZTVScraper) fetch(imdb string, page int) (*eztvResponse, error) {
+	url := fmt.Sprintf("%s/get-torrents?imdb_id=%s&limit=%d&page=%d", s.baseURL, strings.TrimPrefix(imdb, "tt"), eztvPageSize, page)
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q from EZTV", resp.Status)
+	}
+
+	var r eztvResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("could not decode EZTV response: %s", err)
+	}
+
+	return &r, nil
+}
+
+// eztvMatches checks if the torrent is the wanted episode, or the whole season if
+// the episode is zero. EZTV marks season packs with episode zero.
+func eztvMatches(t eztvTorrent, season, episode int) bool {
+	s, err := strconv.Atoi(t.Season)
+	if err != nil || s != season {
+		return false
+	}
+
+	// Seasons match all of their episodes, so the packs can be told apart later
+	e, err := strconv.Atoi(t.Episode)
+	return err == nil && (episode == 0 || e == episode)
+}
@@ -0,0 +1,58 @@
+package magnet_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const eztvResponse = `{
+	"imdb_id": "0944947",
+	"torrents_count": 3,
+	"limit": 100,
+	"page": 1,
+	"torrents": [
+		{"title": "Show S01E02 1080p WEB H264", "magnet_url": "magnet:?xt=urn:btih:1", "season": "1", "episode": "2", "seeds": 10, "size_bytes": "1000"},
+		{"title": "Show S01E03 720p HEVC", "magnet_url": "magnet:?xt=urn:btih:2", "season": "1", "episode": "3", "seeds": 5, "size_bytes": "500"},
+		{"title": "Show S01 720p x265", "magnet_url": "magnet:?xt=urn:btih:3", "season": "1", "episode": "0", "seeds": 3, "size_bytes": "9000"}
+	]
+}`
+
+func TestEZTVScraper_Scrape(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		_, _ = w.Write([]byte(eztvResponse))
+	}))
+	defer server.Close()
+
+	scraper := magnet.NewEZTVScraper(server.Client(), server.URL)
+
+	episode := media.NewEpisode("Show", 1, 2, "tt0944947")
+	magnets, err := scraper.Scrape(episode)
+	assert.NoError(t, err)
+	assert.Equal(t, "imdb_id=0944947&limit=100&page=1", query)
+	assert.Equal(t, []storage.Magnet{{
+		Location: "magnet:?xt=urn:btih:1",
+		Name:     "Show S01E02 1080p WEB H264",
+		Quality:  storage.QualityFHD,
+		Encoding: storage.Encodingx264,
+		Source:   storage.SourceWEBDL,
+		Item:     episode,
+		Size:     1000,
+		Seeders:  10,
+	}}, magnets)
+
+	magnets, err = scraper.Scrape(media.NewSeason("Show", 1, "tt0944947"))
+	assert.NoError(t, err)
+	assert.Len(t, magnets, 3)
+
+	magnets, err = scraper.Scrape(media.NewMovie("Movie", 2019, "tt0944947"))
+	assert.NoError(t, err)
+	assert.Empty(t, magnets)
+}
@@ -2,7 +2,6 @@ package magnet
 
 import (
 	"fmt"
-	"regexp"
 
 	"github.com/nenad/couch/pkg/media"
 	"github.com/nenad/couch/pkg/storage"
@@ -70,12 +69,14 @@ func (s *RarbgScraper) Scrape(item media.SearchItem) ([]storage.Magnet, error) {
 	return magnets, nil
 }
 
+// filterByType keeps the releases of the season for seasons, both the packs and the single episodes
 func (s *RarbgScraper) filterByType(item media.SearchItem, results torrentapi.TorrentResults) []storage.Magnet {
 	var filteredResults torrentapi.TorrentResults
 
 	if item.Type == media.TypeSeason {
+		season, _ := item.Episode()
 		for _, r := range results {
-			if r.EpisodeInfo.EpisodeNum != "1000000" {
+			if !ParseRelease(r.Title).hasSeason(season) {
 				continue
 			}
 			filteredResults = append(filteredResults, r)
@@ -85,81 +86,21 @@ func (s *RarbgScraper) filterByType(item media.SearchItem, results torrentapi.To
 
 	magnets := make([]storage.Magnet, len(results))
 	for i, m := range results {
+		release := ParseRelease(m.Title)
 		magnets[i].Location = m.Download
-		magnets[i].Quality = parseQuality(m)
+		magnets[i].Name = m.Title
+		magnets[i].Quality = release.Quality()
 		magnets[i].Item = item
-		magnets[i].Encoding = parseEncoding(m)
+		magnets[i].Encoding = release.Encoding()
+		magnets[i].Source = release.Source
+		magnets[i].Group = release.Group
+		magnets[i].Proper = release.IsProper()
 		magnets[i].Size = m.Size
 		magnets[i].Seeders = m.Seeders
+		magnets[i].Leechers = m.Leechers
 
 		logrus.Debugf("found magnet %s for %q", m.Download, item.Term)
 	}
 
 	return magnets
 }
-
-var categoryQuality = map[string]storage.Quality{
-	"Movies/XVID":        storage.QualitySD,
-	"Movies/x264":        storage.QualitySD,
-	"Movies/x264/720":    storage.QualityHD,
-	"Movies/x264/1080":   storage.QualityFHD,
-	"Movies/x264/4k":     storage.Quality4K,
-	"Movies/x265/4k":     storage.Quality4K,
-	"Movies/x265/4k/HDR": storage.Quality4K,
-}
-
-var categoryEncoding = map[string]storage.Encoding{
-	"Movies/XVID":        storage.EncodingXVID,
-	"Movies/x264":        storage.Encodingx264,
-	"Movies/x264/720":    storage.Encodingx264,
-	"Movies/x264/1080":   storage.Encodingx264,
-	"Movies/x264/4k":     storage.Encodingx264,
-	"Movies/x265/4k":     storage.Encodingx265,
-	"Movies/x265/4k/HDR": storage.Encodingx265,
-}
-
-var qualityRegex = regexp.MustCompile("2160p|1080p|720p")
-var encodingRegexes = map[storage.Encoding]*regexp.Regexp{
-	storage.Encodingx264: regexp.MustCompile("[xXhH]264"),
-	storage.Encodingx265: regexp.MustCompile("[xXhH]265|hevc|HEVC"),
-	storage.EncodingXVID: regexp.MustCompile("[xX][vV][iI][dD]"),
-	storage.EncodingVC1:  regexp.MustCompile("vc1|VC1|VC-1|vc-1"),
-}
-
-func parseQuality(result torrentapi.TorrentResult) storage.Quality {
-	if q, ok := categoryQuality[result.Category]; ok {
-		return q
-	}
-
-	matches := qualityRegex.FindAllStringSubmatch(result.Title, -1)
-	if len(matches) != 1 {
-		return storage.QualitySD
-	}
-
-	qualityStr := matches[0][0]
-	switch qualityStr {
-	case "720p":
-		return storage.QualityHD
-	case "1080p":
-		return storage.QualityFHD
-	case "2160p":
-		return storage.Quality4K
-	default:
-		return storage.Quality(qualityStr)
-	}
-}
-
-func parseEncoding(result torrentapi.TorrentResult) storage.Encoding {
-	if q, ok := categoryEncoding[result.Category]; ok {
-		return q
-	}
-
-	for enc, regex := range encodingRegexes {
-		matches := regex.FindAllStringSubmatch(result.Title, -1)
-		if len(matches) >= 1 {
-			return enc
-		}
-	}
-
-	return storage.Encodingx264
-}
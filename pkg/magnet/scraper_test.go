@@ -0,0 +1,95 @@
+package magnet_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScraper struct {
+	magnets []storage.Magnet
+	err     error
+}
+
+func (s fakeScraper) Scrape(item media.SearchItem) ([]storage.Magnet, error) {
+	return s.magnets, s.err
+}
+
+func TestMultiScraper_Scrape(t *testing.T) {
+	first := fakeScraper{magnets: []storage.Magnet{
+		{Location: "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=first", Seeders: 1},
+		{Location: "magnet:?xt=urn:btih:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+	}}
+	second := fakeScraper{magnets: []storage.Magnet{
+		{Location: "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=second", Seeders: 2},
+		{Location: "magnet:?xt=urn:btih:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+	}}
+	failing := fakeScraper{err: fmt.Errorf("indexer is gone")}
+
+	testCases := []struct {
+		desc      string
+		scrapers  []magnet.Scraper
+		locations []string
+		err       bool
+	}{
+		{
+			desc:     "duplicates keep the first result",
+			scrapers: []magnet.Scraper{first, second},
+			locations: []string{
+				"magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=first",
+				"magnet:?xt=urn:btih:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"magnet:?xt=urn:btih:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			},
+		},
+		{
+			desc:     "failing scraper is skipped",
+			scrapers: []magnet.Scraper{failing, second},
+			locations: []string{
+				"magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=second",
+				"magnet:?xt=urn:btih:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			},
+		},
+		{
+			desc:     "all scrapers failing",
+			scrapers: []magnet.Scraper{failing, failing},
+			err:      true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			magnets, err := magnet.NewMultiScraper(test.scrapers...).Scrape(media.SearchItem{})
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			var locations []string
+			for _, m := range magnets {
+				locations = append(locations, m.Location)
+			}
+			assert.Equal(t, test.locations, locations)
+		})
+	}
+}
+
+func TestInfoHash(t *testing.T) {
+	testCases := []struct {
+		location string
+		hash     string
+	}{
+		{"magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=name", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"},
+		{"magnet:?dn=name&tr=udp://tracker&xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"},
+		{"magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"},
+		{"https://example.com/file.torrent", "https://example.com/file.torrent"},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.hash, magnet.InfoHash(test.location), test.location)
+	}
+}
@@ -0,0 +1,204 @@
+package magnet
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	torznabCategoryMovies = "2000"
+	torznabCategoryTV     = "5000"
+)
+
+type (
+	// TorznabScraper searches a Torznab endpoint, ex. an indexer in Jackett or Prowlarr
+	TorznabScraper struct {
+		client  *http.Client
+		baseURL string
+		apiKey  string
+	}
+
+	torznabFeed struct {
+		XMLName     xml.Name
+		Code        string        `xml:"code,attr"`
+		Description string        `xml:"description,attr"`
+		Items       []torznabItem `xml:"channel>item"`
+	}
+
+	torznabItem struct {
+		Title     string `xml:"title"`
+		Link      string `xml:"link"`
+		Size      uint64 `xml:"size"`
+		Enclosure struct {
+			URL    string `xml:"url,attr"`
+			Length uint64 `xml:"length,attr"`
+		} `xml:"enclosure"`
+		Attrs []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"attr"`
+	}
+)
+
+// NewTorznabScraper returns a scraper for the endpoint at baseURL, without the trailing "/api"
+func NewTorznabScraper(client *http.Client, baseURL, apiKey string) *TorznabScraper {
+	return &TorznabScraper{
+		client:  client,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+	}
+}
+
+func (s *TorznabScraper) Scrape(item media.SearchItem) ([]storage.Magnet, error) {
+	feed, err := s.search(s.query(item))
+	if err != nil {
+		return nil, fmt.Errorf("could not search %s: %s", s.baseURL, err)
+	}
+
+	var magnets []storage.Magnet
+	for _, i := range feed.Items {
+		location := i.magnet()
+		if location == "" {
+			logrus.Debugf("skipping %q from %s without a magnet link", i.Title, s.baseURL)
+			continue
+		}
+
+		seeders, leechers := i.health()
+		release := ParseRelease(i.Title)
+		magnets = append(magnets, storage.Magnet{
+			Location: location,
+			Name:     i.Title,
+			Quality:  release.Quality(),
+			Encoding: release.Encoding(),
+			Source:   release.Source,
+			Group:    release.Group,
+			Proper:   release.IsProper(),
+			Item:     item,
+			Size:     i.size(),
+			Seeders:  seeders,
+			Leechers: leechers,
+		})
+		logrus.Debugf("found magnet %s for %q", location, item.Term)
+	}
+
+	return magnets, nil
+}
+
+// query searches by IMDb identifier when it is known, and by the search term otherwise
+func (s *TorznabScraper) query(item media.SearchItem) url.Values {
+	q := url.Values{}
+	q.Set("apikey", s.apiKey)
+
+	switch item.Type {
+	case media.TypeMovie:
+		q.Set("t", "movie")
+		q.Set("cat", torznabCategoryMovies)
+		if item.IMDb != "" {
+			q.Set("imdbid", item.IMDb)
+		} else {
+			q.Set("q", item.Term)
+		}
+	case media.TypeEpisode, media.TypeSeason:
+		q.Set("t", "tvsearch")
+		q.Set("cat", torznabCategoryTV)
+		if item.IMDb != "" {
+			season, episode := item.Episode()
+			q.Set("imdbid", item.IMDb)
+			q.Set("season", strconv.Itoa(season))
+			if episode > 0 {
+				q.Set("ep", strconv.Itoa(episode))
+			}
+		} else {
+			q.Set("q", item.Term)
+		}
+	default:
+		q.Set("t", "search")
+		q.Set("q", item.Term)
+	}
+
+	return q
+}
+
+func (s *TorznabScraper) search(q url.Values) (*torznabFeed, error) {
+	resp, err := s.client.Get(s.baseURL + "/api?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var feed torznabFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("could not decode response with status %q: %s", resp.Status, err)
+	}
+
+	if feed.XMLName.Local == "error" {
+		return nil, fmt.Errorf("error %s: %s", feed.Code, feed.Description)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q", resp.Status)
+	}
+
+	return &feed, nil
+}
+
+func (i torznabItem) attr(name string) string {
+	for _, a := range i.Attrs {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// magnet returns the magnet link of the item, or builds it from the info-hash
+func (i torznabItem) magnet() string {
+	if m := i.attr("magneturl"); m != "" {
+		return m
+	}
+
+	if strings.HasPrefix(i.Link, "magnet:") {
+		return i.Link
+	}
+
+	if hash := i.attr("infohash"); hash != "" {
+		return "magnet:?xt=urn:btih:" + hash + "&dn=" + url.QueryEscape(i.Title)
+	}
+
+	return ""
+}
+
+func (i torznabItem) size() uint64 {
+	if i.Size > 0 {
+		return i.Size
+	}
+
+	if size, err := strconv.ParseUint(i.attr("size"), 10, 64); err == nil {
+		return size
+	}
+
+	return i.Enclosure.Length
+}
+
+// health returns the number of seeders and leechers, where the "peers" attribute
+// counts both of them
+func (i torznabItem) health() (seeders, leechers int) {
+	seeders, _ = strconv.Atoi(i.attr("seeders"))
+	if leechers, err := strconv.Atoi(i.attr("leechers")); err == nil {
+		return seeders, leechers
+	}
+
+	if peers, err := strconv.Atoi(i.attr("peers")); err == nil && peers > seeders {
+		leechers = peers - seeders
+	}
+
+	return seeders, leechers
+}
@@ -0,0 +1,133 @@
+package magnet_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const torznabResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+  <channel>
+    <title>Jackett</title>
+    <item>
+      <title>Show.S01E02.1080p.WEB.x265-GRP</title>
+      <link>http://localhost/dl/1.torrent</link>
+      <size>2000</size>
+      <enclosure url="http://localhost/dl/1.torrent" length="2000" type="application/x-bittorrent" />
+      <torznab:attr name="seeders" value="42" />
+      <torznab:attr name="peers" value="50" />
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:1" />
+    </item>
+    <item>
+      <title>Show S01E02 720p</title>
+      <link>http://localhost/dl/2.torrent</link>
+      <enclosure url="http://localhost/dl/2.torrent" length="1000" type="application/x-bittorrent" />
+      <torznab:attr name="seeders" value="3" />
+      <torznab:attr name="infohash" value="abcdef" />
+    </item>
+    <item>
+      <title>Show S01E02 without magnet</title>
+      <link>http://localhost/dl/3.torrent</link>
+    </item>
+  </channel>
+</rss>`
+
+func TestTorznabScraper_Scrape(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api", r.URL.Path)
+		query = r.URL.Query()
+		_, _ = w.Write([]byte(torznabResponse))
+	}))
+	defer server.Close()
+
+	scraper := magnet.NewTorznabScraper(server.Client(), server.URL+"/", "secret")
+
+	episode := media.NewEpisode("Show", 1, 2, "tt0944947")
+	magnets, err := scraper.Scrape(episode)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"apikey": {"secret"},
+		"t":      {"tvsearch"},
+		"cat":    {"5000"},
+		"imdbid": {"tt0944947"},
+		"season": {"1"},
+		"ep":     {"2"},
+	}, query)
+	assert.Equal(t, []storage.Magnet{
+		{
+			Location: "magnet:?xt=urn:btih:1",
+			Name:     "Show.S01E02.1080p.WEB.x265-GRP",
+			Quality:  storage.QualityFHD,
+			Encoding: storage.Encodingx265,
+			Source:   storage.SourceWEBDL,
+			Group:    "GRP",
+			Item:     episode,
+			Size:     2000,
+			Seeders:  42,
+			Leechers: 8,
+		},
+		{
+			Location: "magnet:?xt=urn:btih:abcdef&dn=Show+S01E02+720p",
+			Name:     "Show S01E02 720p",
+			Quality:  storage.QualityHD,
+			Encoding: storage.EncodingUnknown,
+			Item:     episode,
+			Size:     1000,
+			Seeders:  3,
+		},
+	}, magnets)
+}
+
+func TestTorznabScraper_Query(t *testing.T) {
+	testCases := []struct {
+		item  media.SearchItem
+		query url.Values
+	}{
+		{
+			item:  media.NewMovie("Movie", 2019, "tt0111161"),
+			query: url.Values{"apikey": {"secret"}, "t": {"movie"}, "cat": {"2000"}, "imdbid": {"tt0111161"}},
+		},
+		{
+			item:  media.NewMovie("Movie", 2019, ""),
+			query: url.Values{"apikey": {"secret"}, "t": {"movie"}, "cat": {"2000"}, "q": {"Movie 2019"}},
+		},
+		{
+			item:  media.NewSeason("Show", 3, "tt0944947"),
+			query: url.Values{"apikey": {"secret"}, "t": {"tvsearch"}, "cat": {"5000"}, "imdbid": {"tt0944947"}, "season": {"3"}},
+		},
+	}
+
+	for _, test := range testCases {
+		var query url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			_, _ = w.Write([]byte(`<rss><channel></channel></rss>`))
+		}))
+
+		magnets, err := magnet.NewTorznabScraper(server.Client(), server.URL, "secret").Scrape(test.item)
+		server.Close()
+
+		assert.NoError(t, err)
+		assert.Empty(t, magnets)
+		assert.Equal(t, test.query, query, test.item.Term)
+	}
+}
+
+func TestTorznabScraper_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><error code="100" description="Invalid API Key" />`))
+	}))
+	defer server.Close()
+
+	_, err := magnet.NewTorznabScraper(server.Client(), server.URL, "wrong").Scrape(media.NewMovie("Movie", 2019, ""))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid API Key")
+}
@@ -0,0 +1,43 @@
+package magnet
+
+import (
+	"sort"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// SeasonPacks separates the magnets of a season into the packs of the whole season, and
+// the numbers of the episodes which were released individually. Magnets whose name has
+// no episode are considered to be packs.
+func SeasonPacks(item media.SearchItem, magnets []storage.Magnet) (packs []storage.Magnet, episodes []int) {
+	season, _ := item.Episode()
+	found := make(map[int]bool)
+
+	for _, m := range magnets {
+		r := ParseRelease(m.Name)
+		if !r.hasSeason(season) {
+			continue
+		}
+
+		if r.Episode == 0 {
+			packs = append(packs, m)
+			continue
+		}
+
+		for e := r.Episode; e <= r.EpisodeEnd; e++ {
+			if !found[e] {
+				found[e] = true
+				episodes = append(episodes, e)
+			}
+		}
+	}
+
+	sort.Ints(episodes)
+	return packs, episodes
+}
+
+// hasSeason returns true if the release contains the season, or if it has no season at all
+func (r Release) hasSeason(season int) bool {
+	return r.Season == 0 || season == 0 || (season >= r.Season && season <= r.SeasonEnd)
+}
@@ -0,0 +1,33 @@
+package magnet_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeasonPacks(t *testing.T) {
+	season := media.NewSeason("Show", 2, "tt1")
+
+	pack := storage.Magnet{Name: "Show.S02.1080p.WEB.x264-GRP"}
+	complete := storage.Magnet{Name: "Show.S01-S03.Complete.720p"}
+	magnets := []storage.Magnet{
+		{Name: "Show.S02E03.1080p.WEB.x264-GRP"},
+		pack,
+		{Name: "Show.S01E01.1080p.WEB.x264-GRP"},
+		{Name: "Show.S02E01E02.720p.HDTV.x264"},
+		complete,
+		{Name: "Show.S02E03.720p.HDTV.x264"},
+	}
+
+	packs, episodes := magnet.SeasonPacks(season, magnets)
+	assert.Equal(t, []storage.Magnet{pack, complete}, packs)
+	assert.Equal(t, []int{1, 2, 3}, episodes)
+
+	packs, episodes = magnet.SeasonPacks(season, magnets[:1])
+	assert.Empty(t, packs)
+	assert.Equal(t, []int{3}, episodes)
+}
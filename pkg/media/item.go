@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -19,6 +22,10 @@ const (
 )
 
 var tvShowRegex = regexp.MustCompile("(.*) S([0-9]{2})")
+var episodeRegex = regexp.MustCompile(" S([0-9]{2})(?:E([0-9]{2}))?$")
+var imdbRegex = regexp.MustCompile(`(?i)\btt[0-9]{5,}\b`)
+var yearRegex = regexp.MustCompile(` \(?((?:19|20)[0-9]{2})\)?$`)
+var parseEpisodeRegex = regexp.MustCompile(`(?i) S([0-9]{1,2})(?:E([0-9]{1,3}))?$`)
 
 type (
 	// Type is the type of media
@@ -28,6 +35,12 @@ type (
 		Term string
 		IMDb string
 		Type Type
+		// Runtime is the length of the item, zero if the provider doesn't know it
+		Runtime time.Duration
+		// Episodes are the wanted episodes of a season, all of them are wanted if it is empty
+		Episodes []int
+		// EpisodeTitle is the title of an episode, empty if it is unknown
+		EpisodeTitle string
 	}
 )
 
@@ -46,6 +59,117 @@ func (s *SearchItem) Path(basePath, filePath string) string {
 	}
 }
 
+// EpisodePath returns the target download location of a file with the episodes of the
+// TV item, named after the episodes, ex. "Show/Season 1/Show S01E02-E03.mkv"
+func (s *SearchItem) EpisodePath(basePath, filePath string, episode, episodeEnd int) string {
+	season, _ := s.Episode()
+	name := fmt.Sprintf(FormatEpisode, s.Name(), season, episode)
+	if episodeEnd > episode {
+		name += fmt.Sprintf("-E%02d", episodeEnd)
+	}
+
+	return path.Join(basePath, fmt.Sprintf("%s/Season %d/%s%s", s.Name(), season, name, path.Ext(filePath)))
+}
+
+// Name returns the name of the TV show, or the search term for movies
+func (s *SearchItem) Name() string {
+	if s.Type != TypeEpisode && s.Type != TypeSeason {
+		return s.Term
+	}
+
+	matches := tvShowRegex.FindStringSubmatch(s.Term)
+	if matches == nil {
+		return s.Term
+	}
+
+	return matches[1]
+}
+
+// Episode returns the season and episode number of a TV item, where the
+// episode is zero for a whole season. Both are zero for movies.
+func (s *SearchItem) Episode() (season, episode int) {
+	if s.Type != TypeEpisode && s.Type != TypeSeason {
+		return 0, 0
+	}
+
+	matches := episodeRegex.FindStringSubmatch(s.Term)
+	if matches == nil {
+		return 0, 0
+	}
+
+	season, _ = strconv.Atoi(matches[1])
+	episode, _ = strconv.Atoi(matches[2])
+	return season, episode
+}
+
+// EpisodeItem returns the item of a single episode of the season
+func (s *SearchItem) EpisodeItem(episode int) SearchItem {
+	season, _ := s.Episode()
+	return NewEpisode(s.Name(), season, episode, s.IMDb)
+}
+
+// SeasonItem returns the item of the whole season which the episode belongs to
+func (s *SearchItem) SeasonItem() SearchItem {
+	season, _ := s.Episode()
+	return NewSeason(s.Name(), season, s.IMDb)
+}
+
+// WantsEpisode returns true if the episode is one of the wanted episodes of the season
+func (s *SearchItem) WantsEpisode(episode int) bool {
+	return len(s.Episodes) == 0 || contains(s.Episodes, episode)
+}
+
+// GroupEpisodes replaces the episodes of a season with a single season item, which
+// wants only those episodes, once there are at least min distinct episodes of the same season
+func GroupEpisodes(items []SearchItem, min int) []SearchItem {
+	episodes := make(map[string][]int)
+	for _, item := range items {
+		if item.Type != TypeEpisode {
+			continue
+		}
+
+		season := item.SeasonItem()
+		_, episode := item.Episode()
+		if !contains(episodes[season.Term], episode) {
+			episodes[season.Term] = append(episodes[season.Term], episode)
+		}
+	}
+
+	var grouped []SearchItem
+	added := make(map[string]bool)
+	for _, item := range items {
+		if item.Type != TypeEpisode {
+			grouped = append(grouped, item)
+			continue
+		}
+
+		season := item.SeasonItem()
+		wanted := episodes[season.Term]
+		if len(wanted) < min || len(wanted) < 2 {
+			grouped = append(grouped, item)
+			continue
+		}
+
+		if !added[season.Term] {
+			added[season.Term] = true
+			season.Episodes = wanted
+			sort.Ints(season.Episodes)
+			grouped = append(grouped, season)
+		}
+	}
+
+	return grouped
+}
+
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func NewMovie(title string, year int, imdb string) SearchItem {
 	return SearchItem{
 		Term: fmt.Sprintf(FormatMovie, title, year),
@@ -69,3 +193,73 @@ func NewSeason(title string, season int, imdb string) SearchItem {
 		IMDb: imdb,
 	}
 }
+
+// ParseItem returns the item described by the text, which is a movie with its year, ex. "Movie 2019", an
+// episode, ex. "Show S01E02", or a season, ex. "Show S01". The text may contain the IMDb id of the item,
+// which is only looked up by LookupItem.
+func ParseItem(text string) (SearchItem, error) {
+	imdb, title := splitIMDb(text)
+	if title == "" {
+		return SearchItem{}, fmt.Errorf("%q has no title, ex. \"Movie 2019\" or \"Show S01E02\"", text)
+	}
+
+	if matches := parseEpisodeRegex.FindStringSubmatch(title); matches != nil {
+		name := title[:len(title)-len(matches[0])]
+		season, _ := strconv.Atoi(matches[1])
+		if matches[2] == "" {
+			return NewSeason(name, season, imdb), nil
+		}
+		episode, _ := strconv.Atoi(matches[2])
+		return NewEpisode(name, season, episode, imdb), nil
+	}
+
+	if matches := yearRegex.FindStringSubmatch(title); matches != nil && len(matches[0]) < len(title) {
+		year, _ := strconv.Atoi(matches[1])
+		return NewMovie(title[:len(title)-len(matches[0])], year, imdb), nil
+	}
+
+	return SearchItem{}, fmt.Errorf("%q is neither a movie with its year nor an episode or a season", title)
+}
+
+// LookupItem returns the item described by the text like ParseItem, where the title can be left
+// out if the IMDb id is given, ex. "tt0133093" for a movie or "tt0944947 S01E02" for a show, in
+// which case the title is found by the id
+func LookupItem(text string, finder Finder) (SearchItem, error) {
+	imdb, title := splitIMDb(text)
+	matches := parseEpisodeRegex.FindStringSubmatch(" " + title)
+	if imdb == "" || finder == nil || (title != "" && (matches == nil || len(matches[0]) != len(title)+1)) {
+		return ParseItem(text)
+	}
+
+	found, err := finder.Find(imdb)
+	if err != nil {
+		return SearchItem{}, fmt.Errorf("could not find %s: %s", imdb, err)
+	}
+
+	if !found.Show {
+		if title != "" {
+			return SearchItem{}, fmt.Errorf("%s is the movie %q, which has no episodes", imdb, found.Name)
+		}
+		item := NewMovie(found.Name, found.Year, imdb)
+		item.Runtime = found.Runtime
+		return item, nil
+	}
+
+	if title == "" {
+		return SearchItem{}, fmt.Errorf("%s is the show %q, add the season or the episode, ex. \"%s S01\"", imdb, found.Name, imdb)
+	}
+	season, _ := strconv.Atoi(matches[1])
+	if matches[2] == "" {
+		return NewSeason(found.Name, season, imdb), nil
+	}
+	episode, _ := strconv.Atoi(matches[2])
+	item := NewEpisode(found.Name, season, episode, imdb)
+	item.Runtime = found.Runtime
+	return item, nil
+}
+
+// splitIMDb returns the IMDb id in the text, if there is one, and the rest of the text
+func splitIMDb(text string) (imdb, rest string) {
+	imdb = strings.ToLower(imdbRegex.FindString(text))
+	return imdb, strings.Join(strings.Fields(imdbRegex.ReplaceAllString(text, "")), " ")
+}
@@ -0,0 +1,127 @@
+package media_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupEpisodes(t *testing.T) {
+	movie := media.NewMovie("Movie", 2019, "tt1")
+	season := media.NewSeason("Other", 2, "tt3")
+
+	packed := media.NewSeason("Show", 1, "tt2")
+	packed.Episodes = []int{2, 3, 5}
+
+	items := []media.SearchItem{
+		movie,
+		media.NewEpisode("Show", 1, 5, "tt2"),
+		media.NewEpisode("Show", 1, 2, "tt2"),
+		media.NewEpisode("Show", 2, 1, "tt2"),
+		season,
+		media.NewEpisode("Show", 1, 3, "tt2"),
+		media.NewEpisode("Show", 1, 3, "tt2"),
+	}
+
+	expected := []media.SearchItem{
+		movie,
+		packed,
+		media.NewEpisode("Show", 2, 1, "tt2"),
+		season,
+	}
+
+	assert.Equal(t, expected, media.GroupEpisodes(items, 2))
+	assert.Equal(t, items, media.GroupEpisodes(items, 4))
+}
+
+func TestSearchItem_EpisodeItem(t *testing.T) {
+	season := media.NewSeason("Show", 3, "tt2")
+	assert.Equal(t, media.NewEpisode("Show", 3, 7, "tt2"), season.EpisodeItem(7))
+
+	episode := media.NewEpisode("Show", 3, 7, "tt2")
+	assert.Equal(t, season, episode.SeasonItem())
+}
+
+func TestSearchItem_EpisodePath(t *testing.T) {
+	season := media.NewSeason("Show", 1, "tt2")
+	assert.Equal(t, "/tv/Show/Season 1/Show S01E05.mkv", season.EpisodePath("/tv", "Show.S01.1080p/Show.105.mkv", 5, 5))
+	assert.Equal(t, "/tv/Show/Season 1/Show S01E05-E06.mp4", season.EpisodePath("/tv", "https://host/d/Show.S01E05E06.mp4", 5, 6))
+}
+
+func TestParseItem(t *testing.T) {
+	testCases := []struct {
+		text string
+		item media.SearchItem
+		err  bool
+	}{
+		{text: "The Matrix 1999", item: media.NewMovie("The Matrix", 1999, "")},
+		{text: "The Matrix (1999) tt0133093", item: media.NewMovie("The Matrix", 1999, "tt0133093")},
+		{text: "Blade Runner 2049 2017", item: media.NewMovie("Blade Runner 2049", 2017, "")},
+		{text: "Show s1e2", item: media.NewEpisode("Show", 1, 2, "")},
+		{text: "TT0944947 Game of Thrones S08E06", item: media.NewEpisode("Game of Thrones", 8, 6, "tt0944947")},
+		{text: " Show  S03 ", item: media.NewSeason("Show", 3, "")},
+		{text: "tt0133093", err: true},
+		{text: " tt0133093 ", err: true},
+		{text: "The Matrix", err: true},
+		{text: "2019", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			item, err := media.ParseItem(tc.text)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.item, item)
+		})
+	}
+}
+
+// finder finds the titles by their IMDb id
+type finder map[string]media.Title
+
+func (f finder) Find(imdb string) (media.Title, error) {
+	title, ok := f[imdb]
+	if !ok {
+		return media.Title{}, fmt.Errorf("%s was not found", imdb)
+	}
+	return title, nil
+}
+
+func TestLookupItem(t *testing.T) {
+	titles := finder{
+		"tt0133093": {Name: "The Matrix", Year: 1999, Runtime: 136 * time.Minute},
+		"tt0944947": {Name: "Game of Thrones", Year: 2011, Show: true, Runtime: 57 * time.Minute},
+	}
+
+	movie := media.NewMovie("The Matrix", 1999, "tt0133093")
+	movie.Runtime = 136 * time.Minute
+	episode := media.NewEpisode("Game of Thrones", 8, 6, "tt0944947")
+	episode.Runtime = 57 * time.Minute
+
+	testCases := []struct {
+		text   string
+		finder media.Finder
+		item   media.SearchItem
+		err    bool
+	}{
+		{text: "tt0133093", finder: titles, item: movie},
+		{text: "TT0944947 s8e6", finder: titles, item: episode},
+		{text: "tt0944947 S08", finder: titles, item: media.NewSeason("Game of Thrones", 8, "tt0944947")},
+		{text: "tt0944947 Other Show S01", finder: titles, item: media.NewSeason("Other Show", 1, "tt0944947")},
+		{text: "Show S01E02", finder: titles, item: media.NewEpisode("Show", 1, 2, "")},
+		{text: "tt0944947", finder: titles, err: true},
+		{text: "tt0133093 S01", finder: titles, err: true},
+		{text: "tt0000001", finder: titles, err: true},
+		{text: "tt0133093", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			item, err := media.LookupItem(tc.text, tc.finder)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.item, item)
+		})
+	}
+}
@@ -8,3 +8,16 @@ type Provider interface {
 	Poll() ([]SearchItem, error)
 	Interval() time.Duration
 }
+
+// Finder finds the movies and the shows by their IMDb id
+type Finder interface {
+	Find(imdb string) (Title, error)
+}
+
+// Title is the movie or the show which was found, where the runtime of a show is the one of its episodes
+type Title struct {
+	Name    string
+	Year    int
+	Show    bool
+	Runtime time.Duration
+}
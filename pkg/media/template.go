@@ -0,0 +1,139 @@
+package media
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultMovieTemplate keeps every movie in a folder named after it and its year
+	DefaultMovieTemplate = "{Title} ({Year})/{Title} ({Year}).{ext}"
+	// DefaultEpisodeTemplate keeps the episodes in a folder of their season
+	DefaultEpisodeTemplate = "{Show}/Season {Season:00}/{Show} - S{Season:00}E{Episode:00} - {Title}.{ext}"
+)
+
+var (
+	fieldRegex = regexp.MustCompile(`\{([A-Za-z]+)(?::(0+))?\}`)
+	movieRegex = regexp.MustCompile(`^(.*) (\d{4})$`)
+	// invalidChars can't be used in file names on some of the file systems
+	invalidChars = strings.NewReplacer("/", " ", "\\", " ", ":", "", "*", "", "?", "", "\"", "", "<", "", ">", "", "|", "")
+	// emptyParts and repeatedDashes are left behind by fields without a value, ex. the title of an unknown episode
+	emptyParts     = regexp.MustCompile(`\s*(?:\(\s*\)|\[\s*\])|(?:\s+-)+\s*$|^\s*(?:-\s+)+`)
+	repeatedDashes = regexp.MustCompile(`(?:\s+-)+\s+-\s+`)
+)
+
+var templateFields = map[string]bool{"Show": true, "Title": true, "Year": true, "Season": true, "Episode": true, "Quality": true, "ext": true}
+
+type (
+	// Template is the path of a file relative to the download folder, where the fields in curly
+	// braces are replaced by the values of the file, ex. "{Show}/Season {Season}/{Show} S{Season:00}E{Episode:00}.{ext}".
+	// Numbers are padded with zeros to the number of zeros after the colon.
+	Template struct {
+		pattern string
+	}
+
+	// Fields are the values of a file which can be used in a template
+	Fields struct {
+		// Show is the name of the TV show, and Title is the title of the episode or the movie
+		Show  string
+		Title string
+		Year  int
+		// Episode and EpisodeEnd are the range of episodes in the file
+		Season     int
+		Episode    int
+		EpisodeEnd int
+		Quality    string
+		// Ext is the extension without the dot, ex. "mkv" or "en.srt"
+		Ext string
+	}
+)
+
+// ParseTemplate returns the template, or an error if it has an unknown field
+func ParseTemplate(pattern string) (*Template, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, fmt.Errorf("template is empty")
+	}
+	for _, m := range fieldRegex.FindAllStringSubmatch(pattern, -1) {
+		if !templateFields[m[1]] {
+			return nil, fmt.Errorf("unknown field %q in template %q", m[1], pattern)
+		}
+	}
+
+	return &Template{pattern: pattern}, nil
+}
+
+// Execute returns the path of the file, where the parts of fields without a value are removed
+func (t *Template) Execute(f Fields) string {
+	rendered := fieldRegex.ReplaceAllStringFunc(t.pattern, func(field string) string {
+		m := fieldRegex.FindStringSubmatch(field)
+		width := len(m[2])
+		switch m[1] {
+		case "Show":
+			return invalidChars.Replace(f.Show)
+		case "Title":
+			return invalidChars.Replace(f.Title)
+		case "Year":
+			if f.Year == 0 {
+				return ""
+			}
+			return pad(f.Year, width)
+		case "Season":
+			return pad(f.Season, width)
+		case "Episode":
+			if f.EpisodeEnd > f.Episode {
+				return pad(f.Episode, width) + "-E" + pad(f.EpisodeEnd, width)
+			}
+			return pad(f.Episode, width)
+		case "Quality":
+			return f.Quality
+		case "ext":
+			return f.Ext
+		}
+		return field
+	})
+
+	parts := strings.Split(rendered, "/")
+	for i, p := range parts {
+		ext := ""
+		if i == len(parts)-1 && f.Ext != "" {
+			ext = "." + f.Ext
+			p = strings.TrimSuffix(p, ext)
+		}
+		p = repeatedDashes.ReplaceAllString(p, " - ")
+		p = strings.Join(strings.Fields(emptyParts.ReplaceAllString(p, "")), " ")
+		// Names ending with a dot aren't allowed on Windows shares
+		parts[i] = strings.TrimRight(p, ".") + ext
+	}
+	return path.Join(parts...)
+}
+
+// Fields returns the values of a file of the item, which contains the episodes of a season
+func (s *SearchItem) Fields(file string, episodes []int) Fields {
+	f := Fields{Ext: strings.TrimPrefix(path.Ext(file), ".")}
+
+	switch s.Type {
+	case TypeEpisode, TypeSeason:
+		f.Show = s.Name()
+		f.Season, f.Episode = s.Episode()
+		f.EpisodeEnd = f.Episode
+		f.Title = s.EpisodeTitle
+		if len(episodes) > 0 {
+			f.Episode, f.EpisodeEnd = episodes[0], episodes[len(episodes)-1]
+		}
+	default:
+		f.Title = s.Term
+		if m := movieRegex.FindStringSubmatch(s.Term); m != nil {
+			f.Title = m[1]
+			f.Year, _ = strconv.Atoi(m[2])
+		}
+	}
+
+	return f
+}
+
+func pad(n, width int) string {
+	return fmt.Sprintf("%0*d", width, n)
+}
@@ -0,0 +1,66 @@
+package media_test
+
+import (
+	"testing"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate_Execute(t *testing.T) {
+	episode := media.NewEpisode("Marvel's Agents of S.H.I.E.L.D.", 1, 2, "tt1")
+	episode.EpisodeTitle = "0-8-4"
+	season := media.NewSeason("Show", 2, "tt2")
+	movie := media.NewMovie("Mission: Impossible", 1996, "tt3")
+
+	testCases := []struct {
+		desc     string
+		template string
+		fields   media.Fields
+		expected string
+	}{
+		{
+			desc:     "episode",
+			template: media.DefaultEpisodeTemplate,
+			fields:   episode.Fields("Show.S01E02.1080p.WEB.x264-GRP.mkv", nil),
+			expected: "Marvel's Agents of S.H.I.E.L.D/Season 01/Marvel's Agents of S.H.I.E.L.D. - S01E02 - 0-8-4.mkv",
+		},
+		{
+			desc:     "episodes of a season without titles",
+			template: media.DefaultEpisodeTemplate,
+			fields:   season.Fields("https://host/d/Show.S02E03E04.mkv", []int{3, 4}),
+			expected: "Show/Season 02/Show - S02E03-E04.mkv",
+		},
+		{
+			desc:     "subtitles",
+			template: "{Show}/Season {Season}/{Show} {Season}x{Episode:00}.{ext}",
+			fields:   media.Fields{Show: "Show", Season: 2, Episode: 3, EpisodeEnd: 3, Ext: "en.srt"},
+			expected: "Show/Season 2/Show 2x03.en.srt",
+		},
+		{
+			desc:     "movie",
+			template: media.DefaultMovieTemplate,
+			fields:   movie.Fields("Mission.Impossible.1996.1080p.mkv", nil),
+			expected: "Mission Impossible (1996)/Mission Impossible (1996).mkv",
+		},
+		{
+			desc:     "movie without a year",
+			template: "{Title} ({Year}) [{Quality}]/{Title}.{ext}",
+			fields:   media.Fields{Title: "Movie", Ext: "mp4"},
+			expected: "Movie/Movie.mp4",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			template, err := media.ParseTemplate(test.template)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, template.Execute(test.fields))
+		})
+	}
+}
+
+func TestParseTemplate_UnknownField(t *testing.T) {
+	_, err := media.ParseTemplate("{Show}/{Resolution}.{ext}")
+	assert.Error(t, err)
+}
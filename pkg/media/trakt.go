@@ -1,6 +1,12 @@
 package media
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/nenad/trakt"
@@ -15,44 +21,85 @@ type TraktProvider struct {
 	trakt *trakt.Client
 }
 
+type (
+	// The runtimes are only sent along with the extended info, in minutes per episode for shows
+	traktEpisode struct {
+		trakt.Episode
+		Runtime int `json:"runtime"`
+	}
+
+	traktMovie struct {
+		trakt.Movie
+		Runtime int `json:"runtime"`
+	}
+
+	traktShow struct {
+		trakt.Show
+		Runtime int `json:"runtime"`
+	}
+
+	traktSeason struct {
+		trakt.Season
+		EpisodeCount int `json:"episode_count"`
+	}
+
+	traktShowEpisode struct {
+		Show    traktShow    `json:"show"`
+		Episode traktEpisode `json:"episode"`
+	}
+
+	traktMetadataMovie struct {
+		Movie traktMovie `json:"movie"`
+	}
+
+	traktMetadataSeason struct {
+		Show   traktShow   `json:"show"`
+		Season traktSeason `json:"season"`
+	}
+)
+
 func (p *TraktProvider) Poll() (metadata []SearchItem, err error) {
 	var removeMeta trakt.FullMetadata
 
 	today := time.Now().Format("2006-01-02")
-	episodes, err := p.trakt.Calendar(today, 1)
-	if err != nil {
+	var episodes []traktShowEpisode
+	if err := p.get(fmt.Sprintf("/calendars/my/shows/%s/%d", today, 1), &episodes); err != nil {
 		return nil, err
 	}
 	for _, e := range episodes {
-		metadata = append(metadata, NewEpisode(e.Show.Title, e.Episode.Season, e.Episode.Number, e.Show.IDs.IMDb))
-		removeMeta.Episodes = append(removeMeta.Episodes, e.Episode)
+		metadata = append(metadata, episodeItem(e))
+		removeMeta.Episodes = append(removeMeta.Episodes, e.Episode.Episode)
 	}
 
-	watchEpisodes, err := p.trakt.WatchlistEpisodes()
-	if err != nil {
+	var watchEpisodes []traktShowEpisode
+	if err := p.get("/sync/watchlist/episodes", &watchEpisodes); err != nil {
 		return nil, err
 	}
 	for _, e := range watchEpisodes {
-		metadata = append(metadata, NewEpisode(e.Show.Title, e.Episode.Season, e.Episode.Number, e.Show.IDs.IMDb))
-		removeMeta.Episodes = append(removeMeta.Episodes, e.Episode)
+		metadata = append(metadata, episodeItem(e))
+		removeMeta.Episodes = append(removeMeta.Episodes, e.Episode.Episode)
 	}
 
-	movies, err := p.trakt.WatchlistMovies()
-	if err != nil {
+	var movies []traktMetadataMovie
+	if err := p.get("/sync/watchlist/movies", &movies); err != nil {
 		return nil, err
 	}
 	for _, m := range movies {
-		metadata = append(metadata, NewMovie(m.Movie.Title, m.Movie.Year, m.Movie.IDs.IMDb))
-		removeMeta.Movies = append(removeMeta.Movies, m.Movie)
+		item := NewMovie(m.Movie.Title, m.Movie.Year, m.Movie.IDs.IMDb)
+		item.Runtime = time.Duration(m.Movie.Runtime) * time.Minute
+		metadata = append(metadata, item)
+		removeMeta.Movies = append(removeMeta.Movies, m.Movie.Movie)
 	}
 
-	seasons, err := p.trakt.WatchlistSeasons()
-	if err != nil {
+	var seasons []traktMetadataSeason
+	if err := p.get("/sync/watchlist/seasons", &seasons); err != nil {
 		return nil, err
 	}
 	for _, s := range seasons {
-		metadata = append(metadata, NewSeason(s.Show.Title, s.Season.Number, s.Show.IDs.IMDb))
-		removeMeta.Seasons = append(removeMeta.Seasons, s.Season)
+		item := NewSeason(s.Show.Title, s.Season.Number, s.Show.IDs.IMDb)
+		item.Runtime = time.Duration(s.Show.Runtime*s.Season.EpisodeCount) * time.Minute
+		metadata = append(metadata, item)
+		removeMeta.Seasons = append(removeMeta.Seasons, s.Season.Season)
 	}
 
 	if err := p.trakt.RemoveFromWatchlist(removeMeta); err != nil {
@@ -66,3 +113,57 @@ func (p *TraktProvider) Poll() (metadata []SearchItem, err error) {
 func (p *TraktProvider) Interval() time.Duration {
 	return time.Minute * 15
 }
+
+// episodeItem returns the item of the episode, whose runtime is the one of the episode,
+// or otherwise the usual runtime of the episodes of the show
+func episodeItem(e traktShowEpisode) SearchItem {
+	item := NewEpisode(e.Show.Title, e.Episode.Season, e.Episode.Number, e.Show.IDs.IMDb)
+	item.EpisodeTitle = e.Episode.Title
+	item.Runtime = time.Duration(e.Episode.Runtime) * time.Minute
+	if item.Runtime == 0 {
+		item.Runtime = time.Duration(e.Show.Runtime) * time.Minute
+	}
+	return item
+}
+
+// Find returns the movie or the show with the IMDb id
+func (p *TraktProvider) Find(imdb string) (Title, error) {
+	var results []struct {
+		Type  string     `json:"type"`
+		Movie traktMovie `json:"movie"`
+		Show  traktShow  `json:"show"`
+	}
+	if err := p.get("/search/imdb/"+url.PathEscape(imdb)+"?type=movie,show", &results); err != nil {
+		return Title{}, err
+	}
+	if len(results) == 0 {
+		return Title{}, fmt.Errorf("no movie or show has the IMDb id %s", imdb)
+	}
+
+	r := results[0]
+	if r.Type == "show" {
+		return Title{Name: r.Show.Title, Year: r.Show.Year, Show: true, Runtime: time.Duration(r.Show.Runtime) * time.Minute}, nil
+	}
+	return Title{Name: r.Movie.Title, Year: r.Movie.Year, Runtime: time.Duration(r.Movie.Runtime) * time.Minute}, nil
+}
+
+// get requests the extended info of the path from the API, as the client only requests the minimal info
+func (p *TraktProvider) get(path string, response interface{}) error {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	resp, err := p.trakt.HttpClient.Get(trakt.ApiUrl + path + separator + "extended=full")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("non-successful response received: %s - status code: %d", body, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
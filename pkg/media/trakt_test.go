@@ -0,0 +1,99 @@
+package media_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/trakt"
+	"github.com/stretchr/testify/assert"
+)
+
+// traktAPI answers the requests to the API with the responses of their paths
+type traktAPI struct {
+	responses map[string]string
+	queries   []string
+}
+
+func (a *traktAPI) RoundTrip(r *http.Request) (*http.Response, error) {
+	a.queries = append(a.queries, r.URL.RawQuery)
+
+	status, body := http.StatusOK, "[]"
+	if r.Method == http.MethodGet {
+		response, ok := a.responses[r.URL.Path]
+		if !ok {
+			status = http.StatusNotFound
+		}
+		body = response
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func TestTraktProvider_Poll(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+	api := &traktAPI{responses: map[string]string{
+		"/calendars/my/shows/" + today + "/1": `[{"show": {"title": "Show", "runtime": 45, "ids": {"imdb": "tt1"}},
+			"episode": {"season": 2, "number": 3, "title": "Pilot", "runtime": 52}}]`,
+		"/sync/watchlist/episodes": `[{"show": {"title": "Other", "runtime": 22, "ids": {"imdb": "tt2"}},
+			"episode": {"season": 1, "number": 1, "title": "First"}}]`,
+		"/sync/watchlist/movies": `[{"movie": {"title": "Movie", "year": 2019, "runtime": 136, "ids": {"imdb": "tt3"}}},
+			{"movie": {"title": "Unknown", "year": 2020, "ids": {"imdb": "tt4"}}}]`,
+		"/sync/watchlist/seasons": `[{"show": {"title": "Show", "runtime": 45, "ids": {"imdb": "tt1"}},
+			"season": {"number": 1, "episode_count": 10}}]`,
+	}}
+	provider := media.NewTraktProvider(&trakt.Client{HttpClient: &http.Client{Transport: api}})
+
+	episode := media.NewEpisode("Show", 2, 3, "tt1")
+	episode.EpisodeTitle = "Pilot"
+	episode.Runtime = 52 * time.Minute
+	other := media.NewEpisode("Other", 1, 1, "tt2")
+	other.EpisodeTitle = "First"
+	other.Runtime = 22 * time.Minute
+	movie := media.NewMovie("Movie", 2019, "tt3")
+	movie.Runtime = 136 * time.Minute
+	season := media.NewSeason("Show", 1, "tt1")
+	season.Runtime = 450 * time.Minute
+
+	items, err := provider.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, []media.SearchItem{episode, other, movie, media.NewMovie("Unknown", 2020, "tt4"), season}, items)
+	assert.Equal(t, []string{"extended=full", "extended=full", "extended=full", "extended=full", ""}, api.queries)
+}
+
+func TestTraktProvider_Poll_Error(t *testing.T) {
+	provider := media.NewTraktProvider(&trakt.Client{HttpClient: &http.Client{Transport: &traktAPI{}}})
+
+	items, err := provider.Poll()
+	assert.Error(t, err)
+	assert.Empty(t, items)
+}
+
+func TestTraktProvider_Find(t *testing.T) {
+	api := &traktAPI{responses: map[string]string{
+		"/search/imdb/tt0133093": `[{"type": "movie", "movie": {"title": "The Matrix", "year": 1999, "runtime": 136}}]`,
+		"/search/imdb/tt0944947": `[{"type": "show", "show": {"title": "Game of Thrones", "year": 2011, "runtime": 57}}]`,
+		"/search/imdb/tt0000001": `[]`,
+	}}
+	provider := media.NewTraktProvider(&trakt.Client{HttpClient: &http.Client{Transport: api}})
+
+	movie, err := provider.Find("tt0133093")
+	assert.NoError(t, err)
+	assert.Equal(t, media.Title{Name: "The Matrix", Year: 1999, Runtime: 136 * time.Minute}, movie)
+
+	show, err := provider.Find("tt0944947")
+	assert.NoError(t, err)
+	assert.Equal(t, media.Title{Name: "Game of Thrones", Year: 2011, Show: true, Runtime: 57 * time.Minute}, show)
+
+	_, err = provider.Find("tt0000001")
+	assert.Error(t, err)
+	assert.Equal(t, "type=movie,show&extended=full", api.queries[0])
+}
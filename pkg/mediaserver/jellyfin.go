@@ -0,0 +1,57 @@
+package mediaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type (
+	// Jellyfin reports the changed folder to Jellyfin or Emby, which share the API
+	Jellyfin struct {
+		client  *http.Client
+		baseURL string
+		apiKey  string
+	}
+
+	jellyfinUpdate struct {
+		Path       string `json:"Path"`
+		UpdateType string `json:"UpdateType"`
+	}
+)
+
+func NewJellyfin(client *http.Client, baseURL, apiKey string) *Jellyfin {
+	return &Jellyfin{
+		client:  client,
+		baseURL: baseURL,
+		apiKey:  apiKey,
+	}
+}
+
+func (j *Jellyfin) Refresh(folder string) error {
+	body, err := json.Marshal(map[string][]jellyfinUpdate{
+		"Updates": {{Path: folder, UpdateType: "Created"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, j.baseURL+"/Library/Media/Updated", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Emby-Token", j.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not report %s: %s", folder, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("could not report %s: status %d", folder, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package mediaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Kodi scans the folder through the JSON-RPC API
+	Kodi struct {
+		client   *http.Client
+		baseURL  string
+		username string
+		password string
+	}
+
+	kodiRequest struct {
+		JSONRPC string            `json:"jsonrpc"`
+		Method  string            `json:"method"`
+		Params  map[string]string `json:"params"`
+		ID      int               `json:"id"`
+	}
+
+	kodiResponse struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+)
+
+func NewKodi(client *http.Client, baseURL, username, password string) *Kodi {
+	return &Kodi{
+		client:   client,
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+	}
+}
+
+func (k *Kodi) Refresh(folder string) error {
+	// Kodi only matches the folder against its sources with a trailing slash
+	body, err := json.Marshal(kodiRequest{
+		JSONRPC: "2.0",
+		Method:  "VideoLibrary.Scan",
+		Params:  map[string]string{"directory": strings.TrimRight(folder, "/") + "/"},
+		ID:      1,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, k.baseURL+"/jsonrpc", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if k.username != "" {
+		req.SetBasicAuth(k.username, k.password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not scan %s: %s", folder, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not scan %s: status %d", folder, resp.StatusCode)
+	}
+
+	var result kodiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("could not decode the scan result: %s", err)
+	}
+	if result.Error != nil {
+		return fmt.Errorf("could not scan %s: %s", folder, result.Error.Message)
+	}
+	return nil
+}
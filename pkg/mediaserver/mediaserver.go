@@ -0,0 +1,103 @@
+package mediaserver
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	TypePlex     = "plex"
+	TypeJellyfin = "jellyfin"
+	TypeEmby     = "emby"
+	TypeKodi     = "kodi"
+)
+
+// Server is a media server whose library can be refreshed
+type Server interface {
+	// Refresh scans the folder for new or changed files
+	Refresh(folder string) error
+}
+
+// Config holds how to reach a media server
+type Config struct {
+	// Type is TypePlex, TypeJellyfin, TypeEmby or TypeKodi
+	Type string
+	URL  string
+	// Token is the X-Plex-Token of Plex, or the API key of Jellyfin and Emby
+	Token string
+	// Username and Password are used by Kodi
+	Username string
+	Password string
+	// Paths maps the prefixes of local paths to the paths the server sees
+	Paths map[string]string
+}
+
+// New returns the client of the configured media server
+func New(client *http.Client, conf Config) (Server, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("no url for %s", conf.Type)
+	}
+	baseURL := strings.TrimRight(conf.URL, "/")
+
+	var s Server
+	switch conf.Type {
+	case TypePlex:
+		s = NewPlex(client, baseURL, conf.Token)
+	case TypeJellyfin, TypeEmby:
+		s = NewJellyfin(client, baseURL, conf.Token)
+	case TypeKodi:
+		s = NewKodi(client, baseURL, conf.Username, conf.Password)
+	default:
+		return nil, fmt.Errorf("unknown media server %q", conf.Type)
+	}
+
+	if len(conf.Paths) == 0 {
+		return s, nil
+	}
+	return &mappedServer{Server: s, paths: conf.Paths}, nil
+}
+
+// Folders returns the distinct folders of the files, in the order of the files
+func Folders(files []string) []string {
+	var folders []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		dir := path.Dir(f)
+		if !seen[dir] {
+			seen[dir] = true
+			folders = append(folders, dir)
+		}
+	}
+	return folders
+}
+
+// mappedServer refreshes the folders by the paths the server sees
+type mappedServer struct {
+	Server
+	paths map[string]string
+}
+
+func (s *mappedServer) Refresh(folder string) error {
+	return s.Server.Refresh(MapPath(s.paths, folder))
+}
+
+// MapPath replaces the longest local prefix of the folder which is in the paths with its remote path
+func MapPath(paths map[string]string, folder string) string {
+	local, remote, found := "", "", false
+	for l, r := range paths {
+		prefix := strings.TrimRight(l, "/")
+		if folder != prefix && !strings.HasPrefix(folder, prefix+"/") {
+			continue
+		}
+		if !found || len(prefix) > len(local) {
+			local, remote, found = prefix, strings.TrimRight(r, "/"), true
+		}
+	}
+	if !found {
+		return folder
+	}
+
+	return remote + strings.TrimPrefix(folder, local)
+}
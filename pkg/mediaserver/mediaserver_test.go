@@ -0,0 +1,158 @@
+package mediaserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nenad/couch/pkg/mediaserver"
+	"github.com/stretchr/testify/assert"
+)
+
+const plexSections = `{"MediaContainer": {"Directory": [
+	{"key": "1", "Location": [{"path": "/data/movies"}]},
+	{"key": "2", "Location": [{"path": "/data/tv"}, {"path": "/data/tv2/"}]}
+]}}`
+
+func TestPlex_Refresh(t *testing.T) {
+	var refreshed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("X-Plex-Token"))
+		switch r.URL.Path {
+		case "/library/sections":
+			_, _ = w.Write([]byte(plexSections))
+		case "/library/sections/1/refresh", "/library/sections/2/refresh":
+			refreshed = append(refreshed, r.URL.Path+" "+r.URL.Query().Get("path"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	plex := mediaserver.NewPlex(server.Client(), server.URL, "token")
+	assert.NoError(t, plex.Refresh("/data/tv2/Show/Season 01"))
+	assert.NoError(t, plex.Refresh("/data/movies/Movie (2019)"))
+	assert.Error(t, plex.Refresh("/data/tv3/Show"))
+	assert.Equal(t, []string{
+		"/library/sections/2/refresh /data/tv2/Show/Season 01",
+		"/library/sections/1/refresh /data/movies/Movie (2019)",
+	}, refreshed)
+}
+
+func TestJellyfin_Refresh(t *testing.T) {
+	var body struct {
+		Updates []struct {
+			Path       string
+			UpdateType string
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/Library/Media/Updated", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("X-Emby-Token"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	jellyfin := mediaserver.NewJellyfin(server.Client(), server.URL, "key")
+	assert.NoError(t, jellyfin.Refresh("/data/tv/Show/Season 01"))
+	assert.Len(t, body.Updates, 1)
+	assert.Equal(t, "/data/tv/Show/Season 01", body.Updates[0].Path)
+	assert.Equal(t, "Created", body.Updates[0].UpdateType)
+}
+
+func TestKodi_Refresh(t *testing.T) {
+	testCases := []struct {
+		name     string
+		response string
+		err      bool
+	}{
+		{
+			name:     "scanned",
+			response: `{"id": 1, "jsonrpc": "2.0", "result": "OK"}`,
+		},
+		{
+			name:     "error",
+			response: `{"id": 1, "jsonrpc": "2.0", "error": {"code": -32602, "message": "Invalid params."}}`,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body struct {
+				Method string
+				Params map[string]string
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, pass, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "kodi", user)
+				assert.Equal(t, "secret", pass)
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			defer server.Close()
+
+			kodi := mediaserver.NewKodi(server.Client(), server.URL, "kodi", "secret")
+			err := kodi.Refresh("/data/movies/Movie (2019)")
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, "VideoLibrary.Scan", body.Method)
+			assert.Equal(t, "/data/movies/Movie (2019)/", body.Params["directory"])
+		})
+	}
+}
+
+func TestNew_MapsPaths(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Updates []struct{ Path string }
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		path = body.Updates[0].Path
+	}))
+	defer server.Close()
+
+	s, err := mediaserver.New(server.Client(), mediaserver.Config{
+		Type:  mediaserver.TypeEmby,
+		URL:   server.URL + "/",
+		Paths: map[string]string{"/mnt/media": "/media", "/mnt/media/tv": "/tv"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Refresh("/mnt/media/tv/Show/Season 01"))
+	assert.Equal(t, "/tv/Show/Season 01", path)
+
+	_, err = mediaserver.New(server.Client(), mediaserver.Config{Type: "mythtv", URL: server.URL})
+	assert.Error(t, err)
+}
+
+func TestMapPath(t *testing.T) {
+	paths := map[string]string{"/mnt/media/": "/media", "/mnt/media/tv": "/tv"}
+
+	testCases := []struct {
+		folder   string
+		expected string
+	}{
+		{folder: "/mnt/media/movies/Movie (2019)", expected: "/media/movies/Movie (2019)"},
+		{folder: "/mnt/media/tv/Show", expected: "/tv/Show"},
+		{folder: "/mnt/media", expected: "/media"},
+		{folder: "/mnt/mediaserver/Show", expected: "/mnt/mediaserver/Show"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.folder, func(t *testing.T) {
+			assert.Equal(t, tc.expected, mediaserver.MapPath(paths, tc.folder))
+		})
+	}
+}
+
+func TestFolders(t *testing.T) {
+	folders := mediaserver.Folders([]string{
+		"/tv/Show/Season 01/Show - S01E01.mkv",
+		"/tv/Show/Season 01/Show - S01E01.en.srt",
+		"/tv/Show/Season 02/Show - S02E01.mkv",
+	})
+	assert.Equal(t, []string{"/tv/Show/Season 01", "/tv/Show/Season 02"}, folders)
+}
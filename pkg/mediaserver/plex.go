@@ -0,0 +1,94 @@
+package mediaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	// Plex refreshes only the part of the library section which contains the folder
+	Plex struct {
+		client  *http.Client
+		baseURL string
+		token   string
+	}
+
+	plexSections struct {
+		MediaContainer struct {
+			Directory []struct {
+				Key      string `json:"key"`
+				Location []struct {
+					Path string `json:"path"`
+				} `json:"Location"`
+			} `json:"Directory"`
+		} `json:"MediaContainer"`
+	}
+)
+
+func NewPlex(client *http.Client, baseURL, token string) *Plex {
+	return &Plex{
+		client:  client,
+		baseURL: baseURL,
+		token:   token,
+	}
+}
+
+func (p *Plex) Refresh(folder string) error {
+	key, err := p.section(folder)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.get(fmt.Sprintf("/library/sections/%s/refresh?path=%s", key, url.QueryEscape(folder)))
+	if err != nil {
+		return fmt.Errorf("could not refresh section %s: %s", key, err)
+	}
+	return resp.Body.Close()
+}
+
+// section returns the key of the library section which has a location containing the folder
+func (p *Plex) section(folder string) (string, error) {
+	resp, err := p.get("/library/sections")
+	if err != nil {
+		return "", fmt.Errorf("could not get library sections: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var sections plexSections
+	if err := json.NewDecoder(resp.Body).Decode(&sections); err != nil {
+		return "", fmt.Errorf("could not decode library sections: %s", err)
+	}
+
+	for _, d := range sections.MediaContainer.Directory {
+		for _, l := range d.Location {
+			location := strings.TrimRight(l.Path, "/")
+			if folder == location || strings.HasPrefix(folder, location+"/") {
+				return d.Key, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no library section contains %s", folder)
+}
+
+func (p *Plex) get(endpoint string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Plex-Token", p.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
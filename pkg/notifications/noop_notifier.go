@@ -1,6 +1,8 @@
 package notifications
 
 import (
+	"time"
+
 	"github.com/nenad/couch/pkg/media"
 )
 
@@ -14,3 +16,27 @@ func (n *NoopNotifier) OnQueued(item media.SearchItem) error {
 func (n *NoopNotifier) OnFinish(item media.SearchItem) error {
 	return nil
 }
+
+func (n *NoopNotifier) OnReplace(item media.SearchItem, reason string) error {
+	return nil
+}
+
+func (n *NoopNotifier) OnHookFailed(item media.SearchItem, hook, reason string) error {
+	return nil
+}
+
+func (n *NoopNotifier) OnFailed(item media.SearchItem, reason string) error {
+	return nil
+}
+
+func (n *NoopNotifier) OnNoResults(item media.SearchItem) error {
+	return nil
+}
+
+func (n *NoopNotifier) OnRetry(item media.SearchItem, attempt int, reason string, at time.Time) error {
+	return nil
+}
+
+func (n *NoopNotifier) OnProgress(item media.SearchItem, file string, percent int) error {
+	return nil
+}
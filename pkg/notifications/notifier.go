@@ -0,0 +1,205 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Events of the Notifier, which backends can be filtered by
+	EventQueued     = "queued"
+	EventDownloaded = "downloaded"
+	EventReplaced   = "replaced"
+	EventHookFailed = "hook_failed"
+	EventFailed     = "failed"
+	EventNoResults  = "no_results"
+	EventRetried    = "retried"
+	EventProgress   = "progress"
+)
+
+// Events are all events of the Notifier
+var Events = []string{
+	EventQueued, EventDownloaded, EventReplaced, EventHookFailed, EventFailed, EventNoResults, EventRetried, EventProgress,
+}
+
+type (
+	Notifier interface {
+		OnQueued(item media.SearchItem) error
+		OnFinish(item media.SearchItem) error
+		// OnReplace is called when the downloaded files of the item were replaced by better ones
+		OnReplace(item media.SearchItem, reason string) error
+		// OnHookFailed is called when a hook run on an event of the item failed
+		OnHookFailed(item media.SearchItem, hook, reason string) error
+		// OnFailed is called when the item failed after all retries were used
+		OnFailed(item media.SearchItem, reason string) error
+		// OnNoResults is called when scraping found no magnets for the item
+		OnNoResults(item media.SearchItem) error
+		// OnRetry is called when a failed stage of the item is retried at the given time
+		OnRetry(item media.SearchItem, attempt int, reason string, at time.Time) error
+		// OnProgress is called when the download of a file of the item passes a milestone, in percent
+		OnProgress(item media.SearchItem, file string, percent int) error
+	}
+
+	// EventListener is told about the events in the lifecycle of the items
+	EventListener interface {
+		OnEvent(e state.Event)
+	}
+
+	// Fanout dispatches every notification to each backend which wants its event
+	Fanout struct {
+		backends []backend
+	}
+
+	backend struct {
+		notifier Notifier
+		events   map[string]bool
+	}
+)
+
+func NewFanout() *Fanout {
+	return &Fanout{}
+}
+
+// Add adds the backend, which is notified about the given events, or all of them if there are none.
+// Backends which are an EventListener can also be notified about the stage events of the runner.
+func (f *Fanout) Add(n Notifier, events []string) error {
+	known := Events
+	if _, ok := n.(EventListener); ok {
+		known = listenerEvents()
+	}
+
+	b := backend{notifier: n, events: make(map[string]bool)}
+	for _, e := range events {
+		if !contains(known, e) {
+			return fmt.Errorf("unknown event %q", e)
+		}
+		b.events[e] = true
+	}
+	if len(events) == 0 {
+		for _, e := range known {
+			b.events[e] = true
+		}
+	}
+
+	f.backends = append(f.backends, b)
+	return nil
+}
+
+// listenerEvents returns the events of the Notifier along with the stage events of the runner
+func listenerEvents() []string {
+	events := append([]string(nil), Events...)
+	for _, e := range state.Events {
+		if !contains(events, string(e)) {
+			events = append(events, string(e))
+		}
+	}
+	return events
+}
+
+// notify calls every backend which wants the event, even when some of them fail
+func (f *Fanout) notify(event string, fn func(n Notifier) error) error {
+	var errs []string
+	for _, b := range f.backends {
+		if !b.events[event] {
+			continue
+		}
+		if err := fn(b.notifier); err != nil {
+			errs = append(errs, fmt.Sprintf("%T: %s", b.notifier, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// OnEvent notifies about the failures of the items, and passes the stage events which the
+// Notifier doesn't have to the backends which listen to them
+func (f *Fanout) OnEvent(e state.Event) {
+	var err error
+	switch e.Type {
+	case state.EventFailed:
+		err = f.OnFailed(e.Item, e.Error.Error())
+	case state.EventNoResults:
+		err = f.OnNoResults(e.Item)
+	case state.EventRetried:
+		err = f.OnRetry(e.Item, e.Attempt, e.Error.Error(), e.RetryAt)
+	default:
+		// The downloads are notified about through OnFinish
+		if contains(Events, string(e.Type)) {
+			break
+		}
+		for _, b := range f.backends {
+			if l, ok := b.notifier.(EventListener); ok && b.events[string(e.Type)] {
+				l.OnEvent(e)
+			}
+		}
+	}
+
+	if err != nil {
+		logrus.Warnf("could not notify about %s of %q: %s", e.Type, e.Item.Term, err)
+	}
+}
+
+func (f *Fanout) OnQueued(item media.SearchItem) error {
+	return f.notify(EventQueued, func(n Notifier) error {
+		return n.OnQueued(item)
+	})
+}
+
+func (f *Fanout) OnFinish(item media.SearchItem) error {
+	return f.notify(EventDownloaded, func(n Notifier) error {
+		return n.OnFinish(item)
+	})
+}
+
+func (f *Fanout) OnReplace(item media.SearchItem, reason string) error {
+	return f.notify(EventReplaced, func(n Notifier) error {
+		return n.OnReplace(item, reason)
+	})
+}
+
+func (f *Fanout) OnHookFailed(item media.SearchItem, hook, reason string) error {
+	return f.notify(EventHookFailed, func(n Notifier) error {
+		return n.OnHookFailed(item, hook, reason)
+	})
+}
+
+func (f *Fanout) OnFailed(item media.SearchItem, reason string) error {
+	return f.notify(EventFailed, func(n Notifier) error {
+		return n.OnFailed(item, reason)
+	})
+}
+
+func (f *Fanout) OnNoResults(item media.SearchItem) error {
+	return f.notify(EventNoResults, func(n Notifier) error {
+		return n.OnNoResults(item)
+	})
+}
+
+func (f *Fanout) OnRetry(item media.SearchItem, attempt int, reason string, at time.Time) error {
+	return f.notify(EventRetried, func(n Notifier) error {
+		return n.OnRetry(item, attempt, reason, at)
+	})
+}
+
+func (f *Fanout) OnProgress(item media.SearchItem, file string, percent int) error {
+	return f.notify(EventProgress, func(n Notifier) error {
+		return n.OnProgress(item, file, percent)
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package notifications_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder records the notifications it receives
+type recorder struct {
+	notifications.NoopNotifier
+	err    error
+	events []string
+}
+
+func (r *recorder) OnFinish(item media.SearchItem) error {
+	r.events = append(r.events, "downloaded "+item.Term)
+	return r.err
+}
+
+func (r *recorder) OnFailed(item media.SearchItem, reason string) error {
+	r.events = append(r.events, "failed "+item.Term+": "+reason)
+	return r.err
+}
+
+func (r *recorder) OnRetry(item media.SearchItem, attempt int, reason string, at time.Time) error {
+	r.events = append(r.events, fmt.Sprintf("retried %s %d", item.Term, attempt))
+	return r.err
+}
+
+func (r *recorder) OnProgress(item media.SearchItem, file string, percent int) error {
+	r.events = append(r.events, fmt.Sprintf("progress %s %d", file, percent))
+	return r.err
+}
+
+func TestFanout(t *testing.T) {
+	item := media.NewMovie("Movie", 2019, "tt0123")
+	all, failures, broken := &recorder{}, &recorder{}, &recorder{err: fmt.Errorf("bot is down")}
+
+	fanout := notifications.NewFanout()
+	assert.NoError(t, fanout.Add(all, nil))
+	assert.NoError(t, fanout.Add(failures, []string{"failed", "retried"}))
+	assert.NoError(t, fanout.Add(broken, []string{"downloaded"}))
+	assert.Error(t, fanout.Add(&recorder{}, []string{"finished"}))
+
+	assert.Error(t, fanout.OnFinish(item))
+	assert.NoError(t, fanout.OnRetry(item, 2, "no magnets", time.Now()))
+	assert.NoError(t, fanout.OnFailed(item, "no magnets"))
+	assert.NoError(t, fanout.OnProgress(item, "movie.mkv", 50))
+
+	assert.Equal(t, []string{
+		"downloaded Movie 2019",
+		"retried Movie 2019 2",
+		"failed Movie 2019: no magnets",
+		"progress movie.mkv 50",
+	}, all.events)
+	assert.Equal(t, []string{"retried Movie 2019 2", "failed Movie 2019: no magnets"}, failures.events)
+	assert.Equal(t, []string{"downloaded Movie 2019"}, broken.events)
+}
@@ -3,28 +3,55 @@ package notifications
 import (
 	"database/sql"
 	"fmt"
+	"path"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
 	"github.com/sirupsen/logrus"
 )
 
-type Notifier interface {
-	OnQueued(item media.SearchItem) error
-	OnFinish(item media.SearchItem) error
-}
-
 type Telegram struct {
 	bot *tgbotapi.BotAPI
 	db  *sql.DB
+	// chats may manage the items, and are the only ones which may subscribe if there are any
+	chats map[int64]bool
+
+	repo    *storage.MediaRepository
+	manager Manager
+	// finder looks up the items which are given by their IMDb id alone, if it is set
+	finder media.Finder
+
+	mu       sync.Mutex
+	searches map[int64]search
+	sequence int
 }
 
-func NewTelegramClient(bot *tgbotapi.BotAPI, db *sql.DB) *Telegram {
+// NewTelegramClient returns the client of the bot, where only the allowed chats may manage the items
+func NewTelegramClient(bot *tgbotapi.BotAPI, db *sql.DB, allowed []int64) *Telegram {
+	chats := make(map[int64]bool)
+	for _, id := range allowed {
+		chats[id] = true
+	}
+
 	return &Telegram{
-		bot: bot,
-		db:  db,
+		bot:      bot,
+		db:       db,
+		chats:    chats,
+		searches: make(map[int64]search),
 	}
 }
+
+// Manage enables the commands which manage the items and their downloads, where the finder may be
+// nil if the items can't be looked up by their IMDb id. It must be called before the listener is started.
+func (t *Telegram) Manage(repo *storage.MediaRepository, manager Manager, finder media.Finder) {
+	t.repo = repo
+	t.manager = manager
+	t.finder = finder
+}
+
 func (t *Telegram) OnQueued(item media.SearchItem) error {
 	for _, s := range t.GetSubscribedChats() {
 		if _, err := t.bot.Send(tgbotapi.NewMessage(s, fmt.Sprintf("%q was queued for downloading.", item.Term))); err != nil {
@@ -43,6 +70,40 @@ func (t *Telegram) OnFinish(item media.SearchItem) error {
 	return nil
 }
 
+func (t *Telegram) OnReplace(item media.SearchItem, reason string) error {
+	for _, s := range t.GetSubscribedChats() {
+		if _, err := t.bot.Send(tgbotapi.NewMessage(s, fmt.Sprintf("%q was %s.", item.Term, reason))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Telegram) OnHookFailed(item media.SearchItem, hook, reason string) error {
+	for _, s := range t.GetSubscribedChats() {
+		if _, err := t.bot.Send(tgbotapi.NewMessage(s, fmt.Sprintf("Hook %q failed for %q: %s", hook, item.Term, reason))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Telegram) OnFailed(item media.SearchItem, reason string) error {
+	return t.UpdateSubscribers(fmt.Sprintf("%q failed: %s", item.Term, reason))
+}
+
+func (t *Telegram) OnNoResults(item media.SearchItem) error {
+	return t.UpdateSubscribers(fmt.Sprintf("No magnets were found for %q.", item.Term))
+}
+
+func (t *Telegram) OnRetry(item media.SearchItem, attempt int, reason string, at time.Time) error {
+	return t.UpdateSubscribers(fmt.Sprintf("%q will be retried at %s (attempt %d): %s", item.Term, at.Format("2006-01-02 15:04"), attempt, reason))
+}
+
+func (t *Telegram) OnProgress(item media.SearchItem, file string, percent int) error {
+	return t.UpdateSubscribers(fmt.Sprintf("%s of %q is %d%% downloaded.", path.Base(file), item.Term, percent))
+}
+
 func (t *Telegram) GetSubscribedChats() (ids []int64) {
 	rows, err := t.db.Query("SELECT id FROM telegram")
 	if err != nil {
@@ -97,36 +158,48 @@ func (t *Telegram) StartListener() error {
 	logrus.Infof("started listener")
 	for update := range updates {
 		logrus.Infof("received message")
-		if update.Message == nil {
-			continue
-		}
+		t.Handle(update)
+	}
+	logrus.Infof("ended listener")
 
-		if !update.Message.IsCommand() {
-			continue
-		}
+	return nil
+}
 
-		switch update.Message.Command() {
-		case "subscribe":
-			if err := t.RegisterChat(update.Message.Chat.ID); err != nil {
-				logrus.Warnf("error while registering chat: %s", err)
-			}
-		case "unsubscribe":
-			if err := t.UnregisterChat(update.Message.Chat.ID); err != nil {
-				logrus.Warnf("error while unregistering chat: %s", err)
-			}
-		default:
-			continue
-		}
+// Handle replies to the commands and the picked buttons of the update
+func (t *Telegram) Handle(update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil:
+		t.handleCallback(update.CallbackQuery)
+	case update.Message != nil && update.Message.IsCommand():
+		t.handleCommand(update.Message)
+	}
+}
 
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("You have been successfully %sd", update.Message.Command()))
-		msg.ReplyToMessageID = update.Message.MessageID
+// subscribe registers or unregisters the chat of the message for the notifications
+func (t *Telegram) subscribe(msg *tgbotapi.Message) string {
+	if len(t.chats) > 0 && !t.chats[msg.Chat.ID] {
+		return notAllowed(msg.Chat.ID)
+	}
 
-		_, err := t.bot.Send(msg)
-		if err != nil {
-			logrus.Warnf("error while sending a message: %s", err)
-		}
+	var err error
+	if msg.Command() == "subscribe" {
+		err = t.RegisterChat(msg.Chat.ID)
+	} else {
+		err = t.UnregisterChat(msg.Chat.ID)
+	}
+	if err != nil {
+		logrus.Warnf("error while %sing chat: %s", msg.Command(), err)
+		return fmt.Sprintf("Could not %s: %s", msg.Command(), err)
 	}
-	logrus.Infof("ended listener")
 
-	return nil
+	return fmt.Sprintf("You have been successfully %sd", msg.Command())
+}
+
+func (t *Telegram) reply(msg *tgbotapi.Message, text string) {
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyToMessageID = msg.MessageID
+
+	if _, err := t.bot.Send(reply); err != nil {
+		logrus.Warnf("error while sending a message: %s", err)
+	}
 }
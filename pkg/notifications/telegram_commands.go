@@ -0,0 +1,398 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxCandidates is the number of magnets which can be picked after a search
+	maxCandidates = 8
+	// maxMatches is the number of items listed when a query matches several of them
+	maxMatches = 5
+)
+
+const usage = `/add <title> - download an item, ex. "Movie 2019", "Show S01E02" or "Show S01", or one given by its IMDb id, ex. "tt0133093" or "tt0944947 S01"
+/search <title> - pick the magnet of an item from its candidates
+/status [item] - show the number of items in each state, or the state of an item
+/queue - show the files which are being downloaded
+/retry <item> - start a failed or cancelled item over
+/cancel <item> - stop an item which is in progress
+/pause - pause all downloads
+/resume - resume the paused downloads
+/subscribe, /unsubscribe - get notified about the items`
+
+type (
+	// Manager carries out the commands which manage the items and their downloads
+	Manager interface {
+		// Add starts the flow of a new item
+		Add(item media.SearchItem) error
+		// Search returns the candidate magnets of the item, the best rated first
+		Search(item media.SearchItem) ([]storage.Magnet, error)
+		// Grab downloads the item from the given magnet, instead of the best rated one
+		Grab(item media.SearchItem, m storage.Magnet) error
+		Retry(title string) error
+		Cancel(title string) error
+		Pause()
+		Resume()
+		Paused() bool
+		// Progress returns the downloaded percentage of the active downloads, by their remote location
+		Progress() map[string]int
+	}
+
+	// search holds the candidates of the last search of a chat, until one of them is picked
+	search struct {
+		sequence int
+		item     media.SearchItem
+		magnets  []storage.Magnet
+	}
+)
+
+// handleCommand replies to the commands of the allowed chats
+func (t *Telegram) handleCommand(msg *tgbotapi.Message) {
+	command, args := msg.Command(), strings.TrimSpace(msg.CommandArguments())
+
+	switch command {
+	case "subscribe", "unsubscribe":
+		t.reply(msg, t.subscribe(msg))
+		return
+	case "start", "help":
+		t.reply(msg, usage)
+		return
+	}
+
+	if !t.chats[msg.Chat.ID] {
+		logrus.Warnf("chat %d is not allowed to use /%s", msg.Chat.ID, command)
+		t.reply(msg, notAllowed(msg.Chat.ID))
+		return
+	}
+	if t.manager == nil {
+		t.reply(msg, "Managing the items is not available.")
+		return
+	}
+
+	var reply string
+	var err error
+	switch command {
+	case "add":
+		reply, err = t.add(args)
+	case "search":
+		err = t.search(msg, args)
+	case "status":
+		reply, err = t.status(args)
+	case "queue":
+		reply, err = t.queue()
+	case "retry":
+		reply, err = t.retry(args)
+	case "cancel":
+		reply, err = t.cancel(args)
+	case "pause":
+		t.manager.Pause()
+		reply = "Downloads were paused."
+	case "resume":
+		t.manager.Resume()
+		reply = "Downloads were resumed."
+	default:
+		reply = usage
+	}
+
+	if err != nil {
+		logrus.Warnf("could not handle /%s %s: %s", command, args, err)
+		reply = fmt.Sprintf("Could not %s: %s", command, err)
+	}
+	if reply != "" {
+		t.reply(msg, reply)
+	}
+}
+
+func (t *Telegram) add(args string) (string, error) {
+	item, err := media.LookupItem(args, t.finder)
+	if err != nil {
+		return "", err
+	}
+
+	m, err := t.repo.Fetch(item.Term)
+	if err == nil {
+		return fmt.Sprintf("%q is already %s.", item.Term, describeState(m)), nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	if err := t.manager.Add(item); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q was added.", item.Term), nil
+}
+
+// search replies with the candidates of the item, which can be picked by the buttons under them
+func (t *Telegram) search(msg *tgbotapi.Message, args string) error {
+	item, err := media.LookupItem(args, t.finder)
+	if err != nil {
+		return err
+	}
+	if m, err := t.repo.Fetch(item.Term); err == nil {
+		item = m.Item
+	}
+
+	magnets, err := t.manager.Search(item)
+	if err != nil {
+		return err
+	}
+	if len(magnets) == 0 {
+		t.reply(msg, fmt.Sprintf("No magnets were found for %q.", item.Term))
+		return nil
+	}
+	if len(magnets) > maxCandidates {
+		magnets = magnets[:maxCandidates]
+	}
+
+	t.mu.Lock()
+	t.sequence++
+	sequence := t.sequence
+	t.searches[msg.Chat.ID] = search{sequence: sequence, item: item, magnets: magnets}
+	t.mu.Unlock()
+
+	lines := []string{fmt.Sprintf("Candidates for %q:", item.Term)}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, m := range magnets {
+		lines = append(lines, fmt.Sprintf("%d. %s (%s)", i+1, m.Name, describeMagnet(m)))
+		data := fmt.Sprintf("grab:%d:%d", sequence, i)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d. %s", i+1, describeMagnet(m)), data)))
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, strings.Join(lines, "\n"))
+	reply.ReplyToMessageID = msg.MessageID
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, err = t.bot.Send(reply)
+	return err
+}
+
+// handleCallback grabs the magnet picked by a button of a search
+func (t *Telegram) handleCallback(q *tgbotapi.CallbackQuery) {
+	if q.Message == nil {
+		return
+	}
+
+	chat := q.Message.Chat.ID
+	text := notAllowed(chat)
+	if t.chats[chat] && t.manager != nil {
+		text = t.grab(chat, q.Data)
+	}
+
+	if _, err := t.bot.AnswerCallbackQuery(tgbotapi.NewCallback(q.ID, "")); err != nil {
+		logrus.Warnf("error while answering a callback: %s", err)
+	}
+	if _, err := t.bot.Send(tgbotapi.NewEditMessageText(chat, q.Message.MessageID, text)); err != nil {
+		logrus.Warnf("error while editing a message: %s", err)
+	}
+}
+
+// grab downloads the candidate of the callback data, ex. "grab:3:1", if it is from the last search of the chat
+func (t *Telegram) grab(chat int64, data string) string {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != "grab" {
+		return fmt.Sprintf("Unknown choice %q.", data)
+	}
+	sequence, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Sprintf("Unknown choice %q.", data)
+	}
+	index, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Sprintf("Unknown choice %q.", data)
+	}
+
+	t.mu.Lock()
+	s, ok := t.searches[chat]
+	if ok && s.sequence == sequence {
+		delete(t.searches, chat)
+	}
+	t.mu.Unlock()
+
+	if !ok || s.sequence != sequence || index < 0 || index >= len(s.magnets) {
+		return "This search is outdated, search again."
+	}
+
+	m := s.magnets[index]
+	if err := t.manager.Grab(s.item, m); err != nil {
+		logrus.Warnf("could not grab %s for %q: %s", m.Location, s.item.Term, err)
+		return fmt.Sprintf("Could not grab %s: %s", m.Name, err)
+	}
+	return fmt.Sprintf("Grabbing %s for %q.", m.Name, s.item.Term)
+}
+
+// status describes the item, or the number of items in each state if there is none
+func (t *Telegram) status(args string) (string, error) {
+	if args != "" {
+		m, err := t.find(args)
+		if err != nil {
+			return "", err
+		}
+		return t.describeItem(m)
+	}
+
+	states, err := t.repo.States()
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{fmt.Sprintf("Downloads are %s, %d are active.", pausedState(t.manager.Paused()), len(t.manager.Progress()))}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %d", name, states[name]))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// describeItem returns the state of the item, along with its retries and the progress of its files
+func (t *Telegram) describeItem(m storage.Media) (string, error) {
+	lines := []string{fmt.Sprintf("%q is %s.", m.Item.Term, describeState(m))}
+	if m.LastError != "" {
+		lines = append(lines, fmt.Sprintf("Last error: %s", m.LastError))
+	}
+	if m.Attempts > 0 && !m.RetryAt.IsZero() {
+		lines = append(lines, fmt.Sprintf("Retry %d is at %s.", m.Attempts, m.RetryAt.Local().Format("2006-01-02 15:04")))
+	}
+
+	downloads, err := t.repo.Downloads(m.Item.Term)
+	if err != nil {
+		return "", err
+	}
+	progress := t.manager.Progress()
+	for _, dl := range downloads {
+		lines = append(lines, describeDownload(dl, progress))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// queue lists the files which are being downloaded, grouped by their item
+func (t *Telegram) queue() (string, error) {
+	downloads, err := t.repo.Queued()
+	if err != nil {
+		return "", err
+	}
+	if len(downloads) == 0 {
+		return "Nothing is being downloaded.", nil
+	}
+
+	var lines []string
+	if t.manager.Paused() {
+		lines = append(lines, "Downloads are paused.")
+	}
+
+	progress := t.manager.Progress()
+	for i, dl := range downloads {
+		if i == 0 || downloads[i-1].Item.Term != dl.Item.Term {
+			lines = append(lines, fmt.Sprintf("%q", dl.Item.Term))
+		}
+		lines = append(lines, describeDownload(dl, progress))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (t *Telegram) retry(args string) (string, error) {
+	m, err := t.find(args)
+	if err != nil {
+		return "", err
+	}
+
+	if err := t.manager.Retry(m.Item.Term); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q is retried.", m.Item.Term), nil
+}
+
+func (t *Telegram) cancel(args string) (string, error) {
+	m, err := t.find(args)
+	if err != nil {
+		return "", err
+	}
+
+	if err := t.manager.Cancel(m.Item.Term); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q is cancelled.", m.Item.Term), nil
+}
+
+// find returns the item whose title is the query, or the only item which matches it
+func (t *Telegram) find(query string) (storage.Media, error) {
+	if query == "" {
+		return storage.Media{}, fmt.Errorf("no item was given")
+	}
+
+	items, err := t.repo.FindItems(query, maxMatches)
+	if err != nil {
+		return storage.Media{}, err
+	}
+	if len(items) == 0 {
+		return storage.Media{}, fmt.Errorf("no item matches %q", query)
+	}
+	if len(items) > 1 && !strings.EqualFold(items[0].Item.Term, query) {
+		var titles []string
+		for _, m := range items {
+			titles = append(titles, fmt.Sprintf("%q", m.Item.Term))
+		}
+		return storage.Media{}, fmt.Errorf("%q matches %s", query, strings.Join(titles, ", "))
+	}
+
+	// The listed items don't have the state of their retries
+	return t.repo.Fetch(items[0].Item.Term)
+}
+
+// notAllowed tells the ID of the chat, so it can be added to the allowed ones
+func notAllowed(chat int64) string {
+	return fmt.Sprintf("This chat (%d) is not allowed to do that.", chat)
+}
+
+func describeState(m storage.Media) string {
+	if m.State == "" {
+		return strings.ToLower(string(m.Status))
+	}
+	return strings.ToLower(m.State)
+}
+
+func describeMagnet(m storage.Magnet) string {
+	parts := []string{string(m.Quality)}
+	if m.Encoding != storage.EncodingUnknown {
+		parts = append(parts, string(m.Encoding))
+	}
+	if m.Source != "" {
+		parts = append(parts, string(m.Source))
+	}
+	parts = append(parts, fmt.Sprintf("%.1f GB", float64(m.Size)/1e9), fmt.Sprintf("%d seeders", m.Seeders))
+	return strings.Join(parts, " ")
+}
+
+func describeDownload(dl storage.Download, progress map[string]int) string {
+	status := "waiting"
+	if percent, ok := progress[dl.Remote]; ok {
+		status = fmt.Sprintf("%d%%", percent)
+	}
+	if dl.Paused {
+		status = "paused"
+	}
+	return fmt.Sprintf("  %s: %s", path.Base(dl.Local), status)
+}
+
+func pausedState(paused bool) string {
+	if paused {
+		return "paused"
+	}
+	return "running"
+}
@@ -0,0 +1,382 @@
+package notifications_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// botAPI records the requests to the Bot API, and answers all of them successfully
+type botAPI struct {
+	mu       sync.Mutex
+	requests []botRequest
+}
+
+type botRequest struct {
+	method string
+	params map[string]string
+}
+
+func (b *botAPI) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	req := botRequest{method: path.Base(r.URL.Path), params: make(map[string]string)}
+	for key := range r.PostForm {
+		req.params[key] = r.PostForm.Get(key)
+	}
+
+	b.mu.Lock()
+	b.requests = append(b.requests, req)
+	b.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"ok":true,"result":{"message_id":1}}`)),
+		Request:    r,
+	}, nil
+}
+
+// texts returns the texts of the sent and edited messages
+func (b *botAPI) texts() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var texts []string
+	for _, r := range b.requests {
+		if text, ok := r.params["text"]; ok {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// choices returns the callback data of the buttons of the last sent message
+func (b *botAPI) choices(t *testing.T) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var markup tgbotapi.InlineKeyboardMarkup
+	for _, r := range b.requests {
+		if r.method == "sendMessage" && r.params["reply_markup"] != "" {
+			if err := json.Unmarshal([]byte(r.params["reply_markup"]), &markup); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var data []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			data = append(data, *button.CallbackData)
+		}
+	}
+	return data
+}
+
+// manager records the calls of the commands
+type manager struct {
+	magnets []storage.Magnet
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (m *manager) call(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, name)
+}
+
+func (m *manager) Add(item media.SearchItem) error {
+	m.call("add " + item.Term)
+	return nil
+}
+
+func (m *manager) Search(item media.SearchItem) ([]storage.Magnet, error) {
+	m.call("search " + item.Term)
+	return m.magnets, nil
+}
+
+func (m *manager) Grab(item media.SearchItem, mag storage.Magnet) error {
+	m.call("grab " + mag.Location)
+	return nil
+}
+
+func (m *manager) Retry(title string) error {
+	m.call("retry " + title)
+	return nil
+}
+
+func (m *manager) Cancel(title string) error {
+	m.call("cancel " + title)
+	return nil
+}
+
+func (m *manager) Pause()  { m.call("pause") }
+func (m *manager) Resume() { m.call("resume") }
+
+func (m *manager) Paused() bool {
+	m.call("paused")
+	return false
+}
+
+func (m *manager) Progress() map[string]int {
+	m.call("progress")
+	return nil
+}
+
+// finder finds the titles by their IMDb id
+type finder map[string]media.Title
+
+func (f finder) Find(imdb string) (media.Title, error) {
+	title, ok := f[imdb]
+	if !ok {
+		return media.Title{}, fmt.Errorf("%s was not found", imdb)
+	}
+	return title, nil
+}
+
+// newTelegram returns a client of the bot on a new database, which is removed by the returned func
+func newTelegram(t *testing.T, allowed []int64, mgr notifications.Manager) (*notifications.Telegram, *botAPI, func()) {
+	db, cleanup := storagetest.NewDatabase(t)
+
+	api := &botAPI{}
+	bot := &tgbotapi.BotAPI{Token: "token", Client: &http.Client{Transport: api}}
+	telegram := notifications.NewTelegramClient(bot, db, allowed)
+
+	repo := storage.NewMediaRepository(db)
+	if err := repo.StoreItem(media.NewMovie("Movie", 2019, "tt0123")); err != nil {
+		t.Fatal(err)
+	}
+	telegram.Manage(repo, mgr, finder{"tt0133093": {Name: "The Matrix", Year: 1999}})
+
+	return telegram, api, cleanup
+}
+
+func command(chat int64, text string) tgbotapi.Update {
+	length := len(text)
+	if i := strings.Index(text, " "); i != -1 {
+		length = i
+	}
+
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 1,
+		Chat:      &tgbotapi.Chat{ID: chat},
+		Text:      text,
+		Entities:  &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}},
+	}}
+}
+
+func callback(chat int64, data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "1",
+		Message: &tgbotapi.Message{MessageID: 2, Chat: &tgbotapi.Chat{ID: chat}},
+		Data:    data,
+	}}
+}
+
+func TestTelegram_Handle_NotAllowed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		allowed []int64
+		update  tgbotapi.Update
+	}{
+		{name: "add", allowed: []int64{1}, update: command(2, "/add Movie 2019")},
+		{name: "search", allowed: []int64{1}, update: command(2, "/search Movie 2019")},
+		{name: "status", allowed: []int64{1}, update: command(2, "/status")},
+		{name: "status of an item", allowed: []int64{1}, update: command(2, "/status Movie")},
+		{name: "queue", allowed: []int64{1}, update: command(2, "/queue")},
+		{name: "retry", allowed: []int64{1}, update: command(2, "/retry Movie")},
+		{name: "cancel", allowed: []int64{1}, update: command(2, "/cancel Movie")},
+		{name: "pause", allowed: []int64{1}, update: command(2, "/pause")},
+		{name: "resume", allowed: []int64{1}, update: command(2, "/resume")},
+		{name: "grab", allowed: []int64{1}, update: callback(2, "grab:1:0")},
+		{name: "subscribe", allowed: []int64{1}, update: command(2, "/subscribe")},
+		{name: "no allowed chats", update: command(2, "/pause")},
+		{name: "grab without allowed chats", update: callback(2, "grab:1:0")},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := &manager{}
+			telegram, api, cleanup := newTelegram(t, tt.allowed, mgr)
+			defer cleanup()
+
+			telegram.Handle(tt.update)
+
+			assert.Equal(t, []string{"This chat (2) is not allowed to do that."}, api.texts())
+			assert.Empty(t, mgr.calls)
+			assert.Empty(t, telegram.GetSubscribedChats())
+		})
+	}
+}
+
+func TestTelegram_Handle_Subscribe(t *testing.T) {
+	testCases := []struct {
+		name       string
+		allowed    []int64
+		commands   []string
+		subscribed []int64
+	}{
+		{
+			name:       "no allowed chats",
+			commands:   []string{"/subscribe"},
+			subscribed: []int64{2},
+		},
+		{
+			name:       "allowed chat",
+			allowed:    []int64{2},
+			commands:   []string{"/subscribe"},
+			subscribed: []int64{2},
+		},
+		{
+			name:     "unsubscribed",
+			commands: []string{"/subscribe", "/unsubscribe"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, cleanup := newTelegram(t, tt.allowed, &manager{})
+			defer cleanup()
+
+			for _, c := range tt.commands {
+				telegram.Handle(command(2, c))
+			}
+
+			assert.Equal(t, tt.subscribed, telegram.GetSubscribedChats())
+		})
+	}
+}
+
+func TestTelegram_Handle_Grab(t *testing.T) {
+	magnets := []storage.Magnet{
+		{Location: "magnet-1", Name: "Movie.2019.1080p", Quality: storage.QualityFHD},
+		{Location: "magnet-2", Name: "Movie.2019.720p", Quality: storage.QualityHD},
+	}
+
+	testCases := []struct {
+		name     string
+		searches int
+		// picks are indexes into the buttons of each search
+		picks   [][2]int
+		grabbed []string
+		reply   string
+	}{
+		{
+			name:     "picked",
+			searches: 1,
+			picks:    [][2]int{{0, 1}},
+			grabbed:  []string{"grab magnet-2"},
+			reply:    `Grabbing Movie.2019.720p for "Movie 2019".`,
+		},
+		{
+			name:     "picked twice",
+			searches: 1,
+			picks:    [][2]int{{0, 0}, {0, 1}},
+			grabbed:  []string{"grab magnet-1"},
+			reply:    "This search is outdated, search again.",
+		},
+		{
+			name:     "previous search",
+			searches: 2,
+			picks:    [][2]int{{0, 0}},
+			reply:    "This search is outdated, search again.",
+		},
+		{
+			name:     "last search",
+			searches: 2,
+			picks:    [][2]int{{1, 0}},
+			grabbed:  []string{"grab magnet-1"},
+			reply:    `Grabbing Movie.2019.1080p for "Movie 2019".`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := &manager{magnets: magnets}
+			telegram, api, cleanup := newTelegram(t, []int64{2}, mgr)
+			defer cleanup()
+
+			var searches [][]string
+			for i := 0; i < tt.searches; i++ {
+				telegram.Handle(command(2, "/search Movie 2019"))
+				searches = append(searches, api.choices(t))
+			}
+			for _, p := range tt.picks {
+				telegram.Handle(callback(2, searches[p[0]][p[1]]))
+			}
+
+			var grabbed []string
+			for _, c := range mgr.calls {
+				if strings.HasPrefix(c, "grab ") {
+					grabbed = append(grabbed, c)
+				}
+			}
+			assert.Equal(t, tt.grabbed, grabbed)
+
+			texts := api.texts()
+			assert.Equal(t, tt.reply, texts[len(texts)-1])
+		})
+	}
+}
+
+func TestTelegram_Handle_Add(t *testing.T) {
+	testCases := []struct {
+		name  string
+		text  string
+		calls []string
+		reply string
+	}{
+		{
+			name:  "added",
+			text:  "/add Other 2020",
+			calls: []string{"add Other 2020"},
+			reply: `"Other 2020" was added.`,
+		},
+		{
+			name:  "stored",
+			text:  "/add Movie 2019",
+			reply: `"Movie 2019" is already pending.`,
+		},
+		{
+			name:  "IMDb id alone",
+			text:  "/add tt0133093",
+			calls: []string{"add The Matrix 1999"},
+			reply: `"The Matrix 1999" was added.`,
+		},
+		{
+			name:  "unknown IMDb id",
+			text:  "/add tt0111161",
+			reply: "Could not add: could not find tt0111161: tt0111161 was not found",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := &manager{}
+			telegram, api, cleanup := newTelegram(t, []int64{2}, mgr)
+			defer cleanup()
+
+			telegram.Handle(command(2, tt.text))
+
+			assert.Equal(t, tt.calls, mgr.calls)
+			assert.Equal(t, []string{tt.reply}, api.texts())
+		})
+	}
+}
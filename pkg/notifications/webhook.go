@@ -0,0 +1,289 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader holds the HMAC-SHA256 of the body, ex. "sha256=<hex>"
+	SignatureHeader = "X-Couch-Signature"
+	EventHeader     = "X-Couch-Event"
+	DeliveryHeader  = "X-Couch-Delivery"
+)
+
+// DefaultWebhookRetry is used for the webhooks which don't have a retry policy
+var DefaultWebhookRetry = state.RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     time.Second * 10,
+	MaxBackoff:  time.Minute * 10,
+	Jitter:      0.2,
+}
+
+type (
+	// DeliveryLog stores the attempts to deliver the events
+	DeliveryLog interface {
+		AddDelivery(d storage.Delivery) error
+	}
+
+	// WebhookConfig holds where the events are posted, and how they are signed
+	WebhookConfig struct {
+		URL string
+		// Secret signs the payloads with HMAC-SHA256, they are not signed if it is empty
+		Secret string
+		// Retry is how failed deliveries are retried, DefaultWebhookRetry if it has no attempts
+		Retry state.RetryPolicy
+	}
+
+	// Webhook posts the events in the lifecycle of the items as JSON to an URL. The stage events
+	// of the runner arrive through OnEvent, and the others through the methods of the Notifier.
+	// It posts every event it gets, the Fanout decides which ones it wants.
+	Webhook struct {
+		client *http.Client
+		url    string
+		secret string
+		retry  state.RetryPolicy
+		log    DeliveryLog
+	}
+
+	// WebhookEvent is what a payload tells about the item, where only the type, the item and
+	// the time are set for every event
+	WebhookEvent struct {
+		Type    string
+		Item    media.SearchItem
+		Time    time.Time
+		Magnets int
+		Error   string
+		Attempt int
+		RetryAt time.Time
+		Reason  string
+		Hook    string
+		File    string
+		Percent int
+	}
+
+	webhookPayload struct {
+		ID      string      `json:"id"`
+		Event   string      `json:"event"`
+		Time    time.Time   `json:"time"`
+		Item    webhookItem `json:"item"`
+		Magnets int         `json:"magnets,omitempty"`
+		Error   string      `json:"error,omitempty"`
+		Attempt int         `json:"attempt,omitempty"`
+		RetryAt *time.Time  `json:"retry_at,omitempty"`
+		Reason  string      `json:"reason,omitempty"`
+		Hook    string      `json:"hook,omitempty"`
+		File    string      `json:"file,omitempty"`
+		Percent int         `json:"percent,omitempty"`
+	}
+
+	webhookItem struct {
+		Term     string `json:"term"`
+		Type     string `json:"type"`
+		IMDb     string `json:"imdb"`
+		Episodes []int  `json:"episodes,omitempty"`
+	}
+)
+
+// NewWebhook returns the webhook of the config, which stores its deliveries in the log
+func NewWebhook(client *http.Client, conf WebhookConfig, log DeliveryLog) (*Webhook, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("webhook has no url")
+	}
+	retry := conf.Retry
+	if retry.MaxAttempts == 0 {
+		retry = DefaultWebhookRetry
+	}
+
+	return &Webhook{
+		client: client,
+		url:    conf.URL,
+		secret: conf.Secret,
+		retry:  retry,
+		log:    log,
+	}, nil
+}
+
+// OnEvent delivers the stage events of the runner, which the Notifier doesn't have
+func (w *Webhook) OnEvent(e state.Event) {
+	w.send(WebhookEvent{Type: string(e.Type), Item: e.Item, Time: e.Time, Magnets: e.Magnets})
+}
+
+func (w *Webhook) OnQueued(item media.SearchItem) error {
+	w.send(WebhookEvent{Type: EventQueued, Item: item})
+	return nil
+}
+
+func (w *Webhook) OnFinish(item media.SearchItem) error {
+	w.send(WebhookEvent{Type: EventDownloaded, Item: item})
+	return nil
+}
+
+func (w *Webhook) OnReplace(item media.SearchItem, reason string) error {
+	w.send(WebhookEvent{Type: EventReplaced, Item: item, Reason: reason})
+	return nil
+}
+
+func (w *Webhook) OnHookFailed(item media.SearchItem, hook, reason string) error {
+	w.send(WebhookEvent{Type: EventHookFailed, Item: item, Hook: hook, Error: reason})
+	return nil
+}
+
+func (w *Webhook) OnFailed(item media.SearchItem, reason string) error {
+	w.send(WebhookEvent{Type: EventFailed, Item: item, Error: reason})
+	return nil
+}
+
+func (w *Webhook) OnNoResults(item media.SearchItem) error {
+	w.send(WebhookEvent{Type: EventNoResults, Item: item})
+	return nil
+}
+
+func (w *Webhook) OnRetry(item media.SearchItem, attempt int, reason string, at time.Time) error {
+	w.send(WebhookEvent{Type: EventRetried, Item: item, Error: reason, Attempt: attempt, RetryAt: at})
+	return nil
+}
+
+func (w *Webhook) OnProgress(item media.SearchItem, file string, percent int) error {
+	w.send(WebhookEvent{Type: EventProgress, Item: item, File: file, Percent: percent})
+	return nil
+}
+
+// send delivers the event in the background
+func (w *Webhook) send(e WebhookEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	go func() {
+		if err := w.Deliver(e); err != nil {
+			logrus.Warnf("could not deliver %s of %q to %s: %s", e.Type, e.Item.Term, w.url, err)
+		}
+	}()
+}
+
+// Deliver posts the event, and retries until it is delivered or all attempts are used. Every
+// attempt is stored in the delivery log.
+func (w *Webhook) Deliver(e WebhookEvent) error {
+	id, err := deliveryID()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(newWebhookPayload(id, e))
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		code, err := w.post(id, e.Type, body)
+
+		d := storage.Delivery{
+			ID:          id,
+			URL:         w.url,
+			Event:       e.Type,
+			Title:       e.Item.Term,
+			Payload:     string(body),
+			Attempt:     attempt,
+			StatusCode:  code,
+			DeliveredAt: time.Now(),
+		}
+		if err != nil {
+			d.Error = err.Error()
+		}
+		if err := w.log.AddDelivery(d); err != nil {
+			logrus.Errorf("could not store the delivery of %s to %s: %s", e.Type, w.url, err)
+		}
+
+		if err == nil {
+			return nil
+		}
+		if !retryable(code) || attempt > w.retry.MaxAttempts {
+			return err
+		}
+		time.Sleep(w.retry.Delay(attempt))
+	}
+}
+
+// post sends the body, and returns the status code of the response, which is zero if there was none
+func (w *Webhook) post(id string, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "couch v1")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, id)
+	if w.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature of the body, as sent in the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable returns false for the responses which won't change by sending the event again
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+func deliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newWebhookPayload(id string, e WebhookEvent) webhookPayload {
+	p := webhookPayload{
+		ID:    id,
+		Event: e.Type,
+		Time:  e.Time.UTC(),
+		Item: webhookItem{
+			Term:     e.Item.Term,
+			Type:     string(e.Item.Type),
+			IMDb:     e.Item.IMDb,
+			Episodes: e.Item.Episodes,
+		},
+		Magnets: e.Magnets,
+		Error:   e.Error,
+		Attempt: e.Attempt,
+		Reason:  e.Reason,
+		Hook:    e.Hook,
+		File:    e.File,
+		Percent: e.Percent,
+	}
+	if !e.RetryAt.IsZero() {
+		at := e.RetryAt.UTC()
+		p.RetryAt = &at
+	}
+	return p
+}
@@ -0,0 +1,160 @@
+package notifications_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/notifications"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type deliveryLog struct {
+	mu         sync.Mutex
+	deliveries []storage.Delivery
+}
+
+func (l *deliveryLog) AddDelivery(d storage.Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, d)
+	return nil
+}
+
+func (l *deliveryLog) all() []storage.Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]storage.Delivery(nil), l.deliveries...)
+}
+
+func TestWebhook_Deliver(t *testing.T) {
+	retry := state.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+	event := notifications.WebhookEvent{
+		Type:    notifications.EventRetried,
+		Item:    media.NewMovie("Movie", 2019, "tt0123"),
+		Time:    time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC),
+		Error:   "torrent is dead",
+		Attempt: 1,
+		RetryAt: time.Date(2019, 7, 1, 10, 1, 0, 0, time.UTC),
+	}
+
+	testCases := []struct {
+		name     string
+		statuses []int
+		attempts int
+		err      bool
+	}{
+		{
+			name:     "delivered",
+			statuses: []int{http.StatusNoContent},
+			attempts: 1,
+		},
+		{
+			name:     "delivered after retries",
+			statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			attempts: 3,
+		},
+		{
+			name:     "all attempts fail",
+			statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			attempts: 3,
+			err:      true,
+		},
+		{
+			name:     "rejected is not retried",
+			statuses: []int{http.StatusBadRequest},
+			attempts: 1,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				raw, _ := ioutil.ReadAll(r.Body)
+				assert.Equal(t, notifications.Sign("secret", raw), r.Header.Get(notifications.SignatureHeader))
+				assert.Equal(t, "retried", r.Header.Get(notifications.EventHeader))
+				assert.NoError(t, json.Unmarshal(raw, &body))
+
+				w.WriteHeader(tc.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			log := &deliveryLog{}
+			webhook, err := notifications.NewWebhook(server.Client(), notifications.WebhookConfig{URL: server.URL, Secret: "secret", Retry: retry}, log)
+			assert.NoError(t, err)
+
+			err = webhook.Deliver(event)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.attempts, requests)
+
+			deliveries := log.all()
+			assert.Len(t, deliveries, tc.attempts)
+			for i, d := range deliveries {
+				assert.Equal(t, i+1, d.Attempt)
+				assert.Equal(t, deliveries[0].ID, d.ID)
+				assert.Equal(t, tc.statuses[i], d.StatusCode)
+				assert.Equal(t, "Movie 2019", d.Title)
+			}
+			assert.Equal(t, tc.err, deliveries[len(deliveries)-1].Error != "")
+
+			assert.Equal(t, "retried", body["event"])
+			assert.Equal(t, "torrent is dead", body["error"])
+			assert.Equal(t, "2019-07-01T10:01:00Z", body["retry_at"])
+			assert.Equal(t, map[string]interface{}{"term": "Movie 2019", "type": "Movie", "imdb": "tt0123"}, body["item"])
+		})
+	}
+}
+
+func TestFanout_OnEvent(t *testing.T) {
+	delivered := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(notifications.SignatureHeader))
+		delivered <- r.Header.Get(notifications.EventHeader)
+	}))
+	defer server.Close()
+
+	webhook, err := notifications.NewWebhook(server.Client(), notifications.WebhookConfig{URL: server.URL}, &deliveryLog{})
+	assert.NoError(t, err)
+	fanout := notifications.NewFanout()
+	assert.NoError(t, fanout.Add(webhook, []string{"scraped", "downloaded", "failed"}))
+
+	item := media.NewMovie("Movie", 2019, "tt0123")
+	fanout.OnEvent(state.Event{Type: state.EventAdded, Item: item})
+	fanout.OnEvent(state.Event{Type: state.EventScraped, Item: item, Magnets: 3})
+	// Delivered through the Notifier instead
+	fanout.OnEvent(state.Event{Type: state.EventDownloaded, Item: item})
+	assert.NoError(t, fanout.OnFinish(item))
+	assert.NoError(t, fanout.OnQueued(item))
+
+	var events []string
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-delivered:
+			events = append(events, e)
+		case <-time.After(time.Second):
+			t.Fatal("event was not delivered")
+		}
+	}
+	assert.ElementsMatch(t, []string{"scraped", "downloaded"}, events)
+	select {
+	case e := <-delivered:
+		t.Fatalf("unwanted event %s was delivered", e)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	assert.NoError(t, fanout.Add(webhook, []string{"progress", "added"}))
+	assert.Error(t, fanout.Add(webhook, []string{"finished"}))
+	// Only listeners get the stage events
+	assert.Error(t, fanout.Add(&recorder{}, []string{"added"}))
+}
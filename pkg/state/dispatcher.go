@@ -11,6 +11,9 @@ type (
 	ScrapeResult struct {
 		Value []storage.Magnet
 		Error error
+		// Split replaces the item with the given items instead, ex. a season without
+		// a season pack with its episodes
+		Split []media.SearchItem
 	}
 
 	ExtractResult struct {
@@ -85,13 +88,13 @@ func (d *Dispatcher) AfterDownload(f func([]media.SearchItem) []media.SearchItem
 }
 
 // Scrape invokes all registered hooks through OnScrape in the order
-// they were registered. If a callback returns error, this function
-// will return the result of the errored callback and won't run the after hooks.
+// they were registered. If a callback returns error or splits the item, this
+// function will return the result of that callback and won't run the after hooks.
 func (d *Dispatcher) Scrape(item media.SearchItem) ScrapeResult {
 	var magnets []storage.Magnet
 	for _, f := range d.scrapeCallbacks {
 		result := f(item)
-		if result.Error != nil {
+		if result.Error != nil || len(result.Split) > 0 {
 			return result
 		}
 
@@ -103,7 +106,7 @@ func (d *Dispatcher) Scrape(item media.SearchItem) ScrapeResult {
 		magnets = c(magnets)
 	}
 
-	return ScrapeResult{magnets, nil}
+	return ScrapeResult{Value: magnets}
 }
 
 // Extract invokes all registered hooks through OnExtract in the order
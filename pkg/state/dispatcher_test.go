@@ -61,6 +61,26 @@ func TestDispatcher_ScrapeError(t *testing.T) {
 	}, res)
 }
 
+func TestDispatcher_ScrapeSplit(t *testing.T) {
+	d := state.NewDispatcher()
+	season := media.NewSeason("Superman", 1, "tSuperman")
+	split := []media.SearchItem{season.EpisodeItem(1), season.EpisodeItem(2)}
+
+	d.OnScrape(func(item media.SearchItem) state.ScrapeResult {
+		return state.ScrapeResult{Split: split}
+	})
+	d.OnScrape(func(item media.SearchItem) state.ScrapeResult {
+		t.Error("scraped after the item was split")
+		return state.ScrapeResult{}
+	})
+	d.AfterScrape(func(magnets []storage.Magnet) []storage.Magnet {
+		t.Error("after hook invoked for a split item")
+		return magnets
+	})
+
+	assert.Equal(t, state.ScrapeResult{Split: split}, d.Scrape(season))
+}
+
 func TestDispatcher_Extract(t *testing.T) {
 	d := state.NewDispatcher()
 
@@ -0,0 +1,52 @@
+package state
+
+import (
+	"time"
+
+	"github.com/dyrkin/fsm"
+	"github.com/nenad/couch/pkg/media"
+)
+
+const (
+	// Events in the lifecycle of an item
+	EventAdded       EventType = "added"
+	EventScraped     EventType = "scraped"
+	EventNoResults   EventType = "no_results"
+	EventExtracting  EventType = "extracting"
+	EventDownloading EventType = "downloading"
+	EventDownloaded  EventType = "downloaded"
+	EventFailed      EventType = "failed"
+	EventRetried     EventType = "retried"
+	EventCancelled   EventType = "cancelled"
+)
+
+// Events are all events in the lifecycle of an item
+var Events = []EventType{
+	EventAdded, EventScraped, EventNoResults, EventExtracting, EventDownloading, EventDownloaded, EventFailed, EventRetried, EventCancelled,
+}
+
+type (
+	EventType string
+
+	// Event is a change in the lifecycle of an item
+	Event struct {
+		Type EventType
+		Item media.SearchItem
+		Time time.Time
+		// Magnets is the number of magnets found by scraping
+		Magnets int
+		// Error is why a stage of a retried or failed item failed
+		Error error
+		// Attempt and RetryAt are when a retried item is retried
+		Attempt int
+		RetryAt time.Time
+	}
+)
+
+// transitionEvents are the events of entering a stage
+var transitionEvents = map[fsm.State]EventType{
+	ExtractingState:  EventExtracting,
+	DownloadingState: EventDownloading,
+	DownloadedState:  EventDownloaded,
+	CancelledState:   EventCancelled,
+}
@@ -1,6 +1,9 @@
 package state
 
 import (
+	"sync"
+	"time"
+
 	"github.com/dyrkin/fsm"
 	"github.com/nenad/couch/pkg/media"
 	"github.com/nenad/couch/pkg/storage"
@@ -16,8 +19,16 @@ const (
 	DownloadingState      = fsm.State("Downloading")
 	DownloadingErrorState = fsm.State("DownloadingError")
 	DownloadedState       = fsm.State("Downloaded")
+	FailedState           = fsm.State("Failed")
+	// SplitState ends the flow of an item which was replaced by other items
+	SplitState = fsm.State("Split")
+	// CancelledState ends the flow of an item which was stopped by hand
+	CancelledState = fsm.State("Cancelled")
 )
 
+// cancelMessage moves a cancelled flow to CancelledState, unless it already ended
+type cancelMessage struct{}
+
 type Flow struct {
 	item         media.SearchItem
 	scrapeFunc   func(item media.SearchItem) ScrapeResult
@@ -28,6 +39,18 @@ type Flow struct {
 	scrapeDone   chan ScrapeResult
 	extractDone  chan ExtractResult
 	downloadDone chan DownloadResult
+
+	transitionFuncs []func(item media.SearchItem, from, to fsm.State)
+	retryFuncs      []func(item media.SearchItem, attempt int, err error, at time.Time)
+	failFuncs       []func(item media.SearchItem, err error)
+
+	retryMu  sync.Mutex
+	policies map[fsm.State]RetryPolicy
+	attempts int
+	failed   chan struct{}
+
+	cancelOnce sync.Once
+	cancelled  chan struct{}
 }
 
 func (f *Flow) SetScrapeFunc(scraper func(item media.SearchItem) ScrapeResult) {
@@ -42,6 +65,54 @@ func (f *Flow) SetDownloadFunc(downloader func(downloads []storage.Download) Dow
 	f.downloadFunc = downloader
 }
 
+// OnTransition registers a callback to be invoked every time the flow changes its state
+func (f *Flow) OnTransition(fn func(item media.SearchItem, from, to fsm.State)) {
+	f.transitionFuncs = append(f.transitionFuncs, fn)
+}
+
+// OnRetry registers a callback to be invoked when a failed stage is scheduled to be retried
+func (f *Flow) OnRetry(fn func(item media.SearchItem, attempt int, err error, at time.Time)) {
+	f.retryFuncs = append(f.retryFuncs, fn)
+}
+
+// OnFail registers a callback to be invoked when the item fails, after all retries were used
+func (f *Flow) OnFail(fn func(item media.SearchItem, err error)) {
+	f.failFuncs = append(f.failFuncs, fn)
+}
+
+// SetRetryPolicy sets how the stage is retried once it fails
+func (f *Flow) SetRetryPolicy(stage fsm.State, policy RetryPolicy) {
+	f.retryMu.Lock()
+	defer f.retryMu.Unlock()
+	f.policies[stage] = policy
+}
+
+// SetAttempts sets the number of retries which were already made for the
+// current stage, used when resuming a flow
+func (f *Flow) SetAttempts(attempts int) {
+	f.retryMu.Lock()
+	defer f.retryMu.Unlock()
+	f.attempts = attempts
+}
+
+// Cancel ends the flow once its current stage returns, instead of moving on or retrying
+func (f *Flow) Cancel() {
+	f.cancelOnce.Do(func() {
+		close(f.cancelled)
+		go f.fsm.Send(cancelMessage{})
+	})
+}
+
+// isCancelled returns true once the flow was cancelled
+func (f *Flow) isCancelled() bool {
+	select {
+	case <-f.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
 func (f *Flow) Begin() {
 	f.Resume(PendingState, f.item)
 	f.update()
@@ -66,6 +137,13 @@ func New(item media.SearchItem) *Flow {
 		scrapeDone:   make(chan ScrapeResult, 1),
 		extractDone:  make(chan ExtractResult, 1),
 		downloadDone: make(chan DownloadResult, 1),
+		failed:       make(chan struct{}),
+		cancelled:    make(chan struct{}),
+		policies: map[fsm.State]RetryPolicy{
+			ScrapingState:    DefaultRetryPolicy,
+			ExtractingState:  DefaultRetryPolicy,
+			DownloadingState: DefaultRetryPolicy,
+		},
 		scrapeFunc: func(item media.SearchItem) ScrapeResult {
 			return ScrapeResult{}
 		},
@@ -79,6 +157,9 @@ func New(item media.SearchItem) *Flow {
 
 	f.OnTransition(func(from fsm.State, to fsm.State) {
 		logrus.Debugf("%s: Moving from %q to %q", item.Term, from, to)
+		for _, fn := range flow.transitionFuncs {
+			fn(item, from, to)
+		}
 	})
 
 	f.SetDefaultHandler(func(event *fsm.Event) *fsm.NextState {
@@ -89,50 +170,81 @@ func New(item media.SearchItem) *Flow {
 	f.StartWith(PendingState, item)
 
 	f.When(PendingState)(func(event *fsm.Event) *fsm.NextState {
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
 		return f.Goto(ScrapingState).With(event.Data)
 	})
 
 	f.When(ScrapingState)(func(event *fsm.Event) *fsm.NextState {
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
 		item := event.Data.(media.SearchItem)
 
 		result := flow.scrapeFunc(item)
 		flow.scrapeDone <- result
 
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
+
 		if result.Error != nil {
-			return f.Goto(ScrapingErrorState).With(result.Error)
+			return f.Goto(ScrapingErrorState).With(failure{err: result.Error, input: item})
+		}
+
+		if len(result.Split) > 0 {
+			return f.Goto(SplitState).With(result.Split)
 		}
 
 		return f.Goto(ExtractingState).With(result.Value)
 	})
 
 	f.When(ExtractingState)(func(event *fsm.Event) *fsm.NextState {
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
 		magnets := event.Data.([]storage.Magnet)
 
 		result := flow.extractFunc(magnets)
 		flow.extractDone <- result
 
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
+
 		if result.Error != nil {
-			return f.Goto(ExtractingErrorState).With(result.Error)
+			return f.Goto(ExtractingErrorState).With(failure{err: result.Error, input: magnets})
 		}
 
 		return f.Goto(DownloadingState).With(result.Value)
 	})
 
 	f.When(DownloadingState)(func(event *fsm.Event) *fsm.NextState {
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
 		item := event.Data.([]storage.Download)
 
 		result := flow.downloadFunc(item)
 		flow.downloadDone <- result
 
+		if flow.isCancelled() {
+			return f.Goto(CancelledState)
+		}
+
 		if result.Error != nil {
-			return f.Goto(DownloadingErrorState).With(result.Error)
+			return f.Goto(DownloadingErrorState).With(failure{err: result.Error, input: item})
 		}
 
 		return f.Goto(DownloadedState)
 	})
 
 	f.When(DownloadedState)(func(event *fsm.Event) *fsm.NextState {
-		i := event.Message.(media.SearchItem)
+		i, ok := event.Message.(media.SearchItem)
+		if !ok {
+			return f.Stay()
+		}
 		close(flow.scrapeDone)
 		close(flow.extractDone)
 		close(flow.downloadDone)
@@ -140,40 +252,49 @@ func New(item media.SearchItem) *Flow {
 		return f.Stay()
 	})
 
-	f.When(ScrapingErrorState)(func(event *fsm.Event) *fsm.NextState {
-		logrus.Errorf("Scraping failed: %#v", event.Data)
+	f.When(SplitState)(func(event *fsm.Event) *fsm.NextState {
+		i, ok := event.Message.(media.SearchItem)
+		if !ok {
+			return f.Stay()
+		}
+		logrus.Infof("Split %q into %d items", i.Term, len(event.Data.([]media.SearchItem)))
 		return f.Stay()
 	})
-	f.When(ExtractingErrorState)(func(event *fsm.Event) *fsm.NextState {
-		logrus.Errorf("Extracting failed: %#v", event.Data)
+
+	f.When(ScrapingErrorState)(flow.retry(ScrapingState))
+	f.When(ExtractingErrorState)(flow.retry(ExtractingState))
+	f.When(DownloadingErrorState)(flow.retry(DownloadingState))
+
+	f.When(FailedState)(func(event *fsm.Event) *fsm.NextState {
 		return f.Stay()
 	})
-	f.When(DownloadingErrorState)(func(event *fsm.Event) *fsm.NextState {
-		logrus.Errorf("Downloading failed: %#v", event.Data)
+
+	f.When(CancelledState)(func(event *fsm.Event) *fsm.NextState {
 		return f.Stay()
 	})
 
 	// Set up listeners for state changes
 	go func() {
-	outer:
 		for {
 			select {
 			case r := <-flow.scrapeDone:
-				if r.Error != nil {
-					flow.fsm.Goto(ScrapingErrorState) // TODO Retry after timeout
-				}
+				flow.resetAttempts(r.Error)
 				flow.update()
-			case r := <-flow.extractDone:
-				if r.Error != nil {
-					flow.fsm.Goto(ExtractingErrorState) // TODO Retry after timeout
+				if len(r.Split) > 0 {
+					return
 				}
+			case r := <-flow.extractDone:
+				flow.resetAttempts(r.Error)
 				flow.update()
 			case r := <-flow.downloadDone:
-				if r.Error != nil {
-					flow.fsm.Goto(DownloadingErrorState) // TODO Retry after timeout
-				}
 				flow.update()
-				break outer
+				if r.Error == nil {
+					return
+				}
+			case <-flow.failed:
+				return
+			case <-flow.cancelled:
+				return
 			}
 		}
 	}()
@@ -181,6 +302,62 @@ func New(item media.SearchItem) *Flow {
 	return flow
 }
 
+// retry returns the handler of an error state, which schedules the failed stage
+// to run again, or fails the item once all attempts were used
+func (f *Flow) retry(stage fsm.State) fsm.StateFunction {
+	return func(event *fsm.Event) *fsm.NextState {
+		if f.isCancelled() {
+			return f.fsm.Goto(CancelledState)
+		}
+
+		fail := event.Data.(failure)
+		if _, ok := event.Message.(retryMessage); ok {
+			return f.fsm.Goto(stage).With(fail.input)
+		}
+
+		logrus.Errorf("%s failed for %q: %s", stage, f.item.Term, fail.err)
+
+		f.retryMu.Lock()
+		policy := f.policies[stage]
+		f.attempts++
+		attempt := f.attempts
+		f.retryMu.Unlock()
+
+		if attempt > policy.MaxAttempts {
+			logrus.Errorf("giving up on %q after %d attempts", f.item.Term, policy.MaxAttempts)
+			close(f.failed)
+			for _, fn := range f.failFuncs {
+				fn(f.item, fail.err)
+			}
+			return f.fsm.Goto(FailedState).With(fail.err)
+		}
+
+		delay := policy.Delay(attempt)
+		logrus.Infof("retrying %s of %q in %s (attempt %d/%d)", stage, f.item.Term, delay, attempt, policy.MaxAttempts)
+		for _, fn := range f.retryFuncs {
+			fn(f.item, attempt, fail.err, time.Now().Add(delay))
+		}
+
+		time.AfterFunc(delay, func() {
+			f.fsm.Send(retryMessage{})
+			f.update()
+		})
+
+		return f.fsm.Stay()
+	}
+}
+
+// resetAttempts starts counting the retries from zero once a stage succeeds
+func (f *Flow) resetAttempts(err error) {
+	if err != nil {
+		return
+	}
+
+	f.retryMu.Lock()
+	f.attempts = 0
+	f.retryMu.Unlock()
+}
+
 func (f *Flow) update() {
 	f.fsm.Send(f.item)
 }
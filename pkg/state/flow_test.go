@@ -1,6 +1,8 @@
 package state_test
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -132,3 +134,168 @@ func TestFlow_ResumeScenarios(t *testing.T) {
 		assert.Equal(t, state.DownloadedState, f.Status())
 	}
 }
+
+func TestFlow_OnTransition(t *testing.T) {
+	item := media.NewMovie("Batman", 2010, "tBadman")
+	f := state.New(item)
+
+	var mu sync.Mutex
+	var states []fsm.State
+	f.OnTransition(func(i media.SearchItem, from, to fsm.State) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, item, i)
+		if from != to {
+			states = append(states, to)
+		}
+	})
+	f.Begin()
+	time.Sleep(time.Millisecond * 50)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []fsm.State{
+		state.ScrapingState,
+		state.ExtractingState,
+		state.DownloadingState,
+		state.DownloadedState,
+	}, states)
+}
+
+func TestFlow_Split(t *testing.T) {
+	item := media.NewSeason("Gotham", 1, "tGotham")
+	f := state.New(item)
+
+	f.SetScrapeFunc(func(item media.SearchItem) state.ScrapeResult {
+		return state.ScrapeResult{Split: []media.SearchItem{item.EpisodeItem(1)}}
+	})
+	f.SetExtractFunc(func(magnets []storage.Magnet) state.ExtractResult {
+		t.Error("extracted a split item")
+		return state.ExtractResult{}
+	})
+
+	f.Begin()
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, state.SplitState, f.Status())
+}
+
+func TestFlow_RetriesFailedStage(t *testing.T) {
+	item := media.NewMovie("Batman", 2010, "tBadman")
+	f := state.New(item)
+	f.SetRetryPolicy(state.ScrapingState, state.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	var mu sync.Mutex
+	calls := 0
+	f.SetScrapeFunc(func(item media.SearchItem) state.ScrapeResult {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			return state.ScrapeResult{Error: fmt.Errorf("indexer is down")}
+		}
+		return state.ScrapeResult{}
+	})
+
+	var attempts []int
+	f.OnRetry(func(i media.SearchItem, attempt int, err error, at time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, attempt)
+	})
+
+	f.Begin()
+	time.Sleep(time.Millisecond * 100)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.Equal(t, state.DownloadedState, f.Status())
+}
+
+func TestFlow_FailsAfterMaxAttempts(t *testing.T) {
+	item := media.NewMovie("Batman", 2010, "tBadman")
+	f := state.New(item)
+	f.SetRetryPolicy(state.ExtractingState, state.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+
+	var mu sync.Mutex
+	calls := 0
+	f.SetExtractFunc(func(magnets []storage.Magnet) state.ExtractResult {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return state.ExtractResult{Error: fmt.Errorf("torrent is dead")}
+	})
+
+	var failed []error
+	f.OnFail(func(i media.SearchItem, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, err)
+	})
+
+	f.Begin()
+	time.Sleep(time.Millisecond * 100)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, state.FailedState, f.Status())
+	assert.Equal(t, []error{fmt.Errorf("torrent is dead")}, failed)
+}
+
+func TestFlow_Cancel(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy state.RetryPolicy
+		err    error
+	}{
+		{
+			name: "while downloading",
+		},
+		{
+			name:   "while waiting for a retry",
+			policy: state.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour},
+			err:    fmt.Errorf("tracker is down"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			item := media.NewMovie("Batman", 2010, "tBadman")
+			f := state.New(item)
+			f.SetRetryPolicy(state.DownloadingState, tc.policy)
+
+			started := make(chan struct{})
+			stop := make(chan struct{})
+			f.SetDownloadFunc(func(downloads []storage.Download) state.DownloadResult {
+				close(started)
+				<-stop
+				return state.DownloadResult{Error: tc.err}
+			})
+
+			f.Begin()
+			<-started
+			f.Cancel()
+			close(stop)
+			time.Sleep(time.Millisecond * 50)
+
+			assert.Equal(t, state.CancelledState, f.Status())
+		})
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := state.RetryPolicy{Backoff: time.Second, MaxBackoff: time.Second * 5}
+
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, time.Second*2, p.Delay(2))
+	assert.Equal(t, time.Second*4, p.Delay(3))
+	assert.Equal(t, time.Second*5, p.Delay(4))
+
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := p.Delay(2)
+		assert.True(t, d >= time.Second && d <= time.Second*3, "delay %s out of jitter range", d)
+	}
+}
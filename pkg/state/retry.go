@@ -0,0 +1,56 @@
+package state
+
+import (
+	"math/rand"
+	"time"
+)
+
+// DefaultRetryPolicy is used for the stages which don't have a policy set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     time.Minute,
+	MaxBackoff:  time.Hour * 6,
+	Jitter:      0.2,
+}
+
+type (
+	// RetryPolicy describes how many times and how often a failed stage is retried
+	RetryPolicy struct {
+		// MaxAttempts is the number of retries before the item is marked as failed
+		MaxAttempts int
+		// Backoff is the delay before the first retry, and it doubles with every next one
+		Backoff time.Duration
+		// MaxBackoff caps the delay between two retries
+		MaxBackoff time.Duration
+		// Jitter randomizes the delay by the given fraction, ex. 0.2 is ±20%
+		Jitter float64
+	}
+
+	// failure is the data of an error state, which keeps the input of the
+	// failed stage so it can be retried
+	failure struct {
+		err   error
+		input interface{}
+	}
+
+	// retryMessage moves the flow from an error state back to the failed stage
+	retryMessage struct{}
+)
+
+// Delay returns how long to wait before the given attempt, starting from 1
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration(float64(delay) * p.Jitter * (rand.Float64()*2 - 1))
+	}
+
+	return delay
+}
@@ -0,0 +1,417 @@
+package state
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dyrkin/fsm"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// Items stored before flows were persisted only have a status
+var statusStates = map[storage.Status]fsm.State{
+	storage.StatusPending:     PendingState,
+	storage.StatusScraped:     ExtractingState,
+	storage.StatusExtracting:  ExtractingState,
+	storage.StatusDownloading: DownloadingState,
+	storage.StatusError:       DownloadingState,
+}
+
+// Runner drives a flow for every item, and persists the state of the flows
+// so they can be resumed after a restart
+type Runner struct {
+	repo       *storage.MediaRepository
+	dispatcher *Dispatcher
+	policies   map[fsm.State]RetryPolicy
+
+	eventFuncs []func(e Event)
+
+	mu    sync.Mutex
+	flows map[string]*Flow
+}
+
+// NewRunner returns a runner whose flows retry the stages by the given policies,
+// keyed by the stage state. Stages without a policy use DefaultRetryPolicy.
+func NewRunner(repo *storage.MediaRepository, dispatcher *Dispatcher, policies map[fsm.State]RetryPolicy) *Runner {
+	return &Runner{
+		repo:       repo,
+		dispatcher: dispatcher,
+		policies:   policies,
+		flows:      make(map[string]*Flow),
+	}
+}
+
+// OnEvent registers a callback to be invoked on every event in the lifecycle of an item. It must
+// be registered before any flow begins.
+func (r *Runner) OnEvent(fn func(e Event)) {
+	r.eventFuncs = append(r.eventFuncs, fn)
+}
+
+func (r *Runner) emit(e Event) {
+	e.Time = time.Now()
+	for _, fn := range r.eventFuncs {
+		fn(e)
+	}
+}
+
+// Add stores the item and begins its flow. Items which were already picked
+// up before are skipped, as well as episodes wanted by a season item.
+func (r *Runner) Add(item media.SearchItem) error {
+	switch item.Type {
+	case media.TypeEpisode:
+		covered, err := r.covered(item)
+		if err != nil {
+			return err
+		}
+		if covered {
+			logrus.Infof("skipping %q, it is a part of the season", item.Term)
+			return nil
+		}
+	case media.TypeSeason:
+		if len(item.Episodes) > 0 {
+			return r.addEpisodes(item)
+		}
+	}
+
+	m, err := r.repo.Fetch(item.Term)
+	switch {
+	case err == sql.ErrNoRows:
+		if err := r.repo.StoreItem(item); err != nil {
+			return fmt.Errorf("could not store %q: %s", item.Term, err)
+		}
+		r.emit(Event{Type: EventAdded, Item: item})
+	case err != nil:
+		return err
+	case m.Status != storage.StatusPending:
+		logrus.Infof("skipping %q for scraping, already in database", item.Term)
+		return nil
+	}
+
+	logrus.Infof("pushing %q for scraping", item.Term)
+	r.start(item, func(f *Flow) {
+		f.Begin()
+	})
+
+	return nil
+}
+
+// addEpisodes adds the season for the wanted episodes which were not downloaded yet. If the
+// season was already added before, the episodes are added individually instead.
+func (r *Runner) addEpisodes(season media.SearchItem) error {
+	var episodes []int
+	for _, e := range season.Episodes {
+		m, err := r.repo.Fetch(season.EpisodeItem(e).Term)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == sql.ErrNoRows || m.Status == storage.StatusPending {
+			episodes = append(episodes, e)
+		}
+	}
+
+	_, err := r.repo.Fetch(season.Term)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err == sql.ErrNoRows && len(episodes) > 1 {
+		season.Episodes = episodes
+		if err := r.repo.StoreItem(season); err != nil {
+			return fmt.Errorf("could not store %q: %s", season.Term, err)
+		}
+		r.emit(Event{Type: EventAdded, Item: season})
+
+		logrus.Infof("pushing %q for scraping with episodes %v", season.Term, episodes)
+		r.start(season, func(f *Flow) {
+			f.Begin()
+		})
+		return nil
+	}
+
+	for _, e := range episodes {
+		if err := r.Add(season.EpisodeItem(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// covered returns true if the episode is wanted by its season item, unless the season was
+// split into episodes or it failed
+func (r *Runner) covered(episode media.SearchItem) (bool, error) {
+	m, err := r.repo.Fetch(episode.SeasonItem().Term)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch fsm.State(m.State) {
+	case SplitState, FailedState:
+		return false, nil
+	}
+
+	_, e := episode.Episode()
+	return m.Item.WantsEpisode(e), nil
+}
+
+// Retry starts the flow of a failed or cancelled item over, from scraping
+func (r *Runner) Retry(title string) error {
+	m, err := r.stopped(title)
+	if err != nil {
+		return err
+	}
+
+	switch fsm.State(m.State) {
+	case FailedState, CancelledState:
+	default:
+		return fmt.Errorf("%q has neither failed nor was it cancelled", title)
+	}
+
+	if err := r.repo.ResetRetries(title); err != nil {
+		return err
+	}
+	if err := r.repo.SaveState(title, string(ScrapingState)); err != nil {
+		return err
+	}
+
+	logrus.Infof("retrying %q", title)
+	r.start(m.Item, func(f *Flow) {
+		f.Resume(ScrapingState, m.Item)
+	})
+	return nil
+}
+
+// Grab downloads the item from the given magnet instead of the best rated one. The item is stored
+// if it is new, and otherwise it must not be in progress or downloaded.
+func (r *Runner) Grab(item media.SearchItem, magnet storage.Magnet) error {
+	m, err := r.stopped(item.Term)
+	switch {
+	case err == sql.ErrNoRows:
+		if err := r.repo.StoreItem(item); err != nil {
+			return fmt.Errorf("could not store %q: %s", item.Term, err)
+		}
+		r.emit(Event{Type: EventAdded, Item: item})
+	case err != nil:
+		return err
+	case fsm.State(m.State) == DownloadedState || m.Status == storage.StatusDownloaded:
+		return fmt.Errorf("%q was already downloaded", item.Term)
+	default:
+		item = m.Item
+	}
+
+	magnet.Item = item
+	if err := r.repo.AddTorrent(magnet); err != nil {
+		return err
+	}
+	if err := r.repo.PinMagnet(item.Term, magnet.Location); err != nil {
+		return err
+	}
+	if err := r.repo.ResetRetries(item.Term); err != nil {
+		return err
+	}
+	if err := r.repo.SaveState(item.Term, string(ExtractingState)); err != nil {
+		return err
+	}
+
+	logrus.Infof("grabbing %s for %q", magnet.Location, item.Term)
+	r.start(item, func(f *Flow) {
+		f.Resume(ExtractingState, []storage.Magnet{magnet})
+	})
+	return nil
+}
+
+// Cancel stops the flow of the item once its current stage returns. An item which is not in
+// progress, ex. after a restart, is only marked as cancelled.
+func (r *Runner) Cancel(title string) error {
+	r.mu.Lock()
+	f, ok := r.flows[title]
+	r.mu.Unlock()
+	if ok {
+		logrus.Infof("cancelling %q", title)
+		f.Cancel()
+		return nil
+	}
+
+	m, err := r.repo.Fetch(title)
+	if err != nil {
+		return err
+	}
+	switch fsm.State(m.State) {
+	case DownloadedState, FailedState, SplitState, CancelledState:
+		return fmt.Errorf("%q is not in progress", title)
+	}
+	if m.Status == storage.StatusDownloaded {
+		return fmt.Errorf("%q is not in progress", title)
+	}
+
+	if err := r.repo.SaveState(title, string(CancelledState)); err != nil {
+		return err
+	}
+	r.emit(Event{Type: EventCancelled, Item: m.Item})
+	return nil
+}
+
+// Running returns true if the flow of the item is in progress
+func (r *Runner) Running(title string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.flows[title]
+	return ok
+}
+
+// stopped returns the stored item, unless its flow is in progress
+func (r *Runner) stopped(title string) (storage.Media, error) {
+	if r.Running(title) {
+		return storage.Media{}, fmt.Errorf("%q is in progress, cancel it first", title)
+	}
+	return r.repo.Fetch(title)
+}
+
+// ResumeAll continues the flows of all unfinished items from their last persisted state
+func (r *Runner) ResumeAll() error {
+	items, err := r.repo.Unfinished()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range items {
+		state, data, err := r.resumeData(m)
+		if err != nil {
+			logrus.Errorf("could not resume %q: %s", m.Item.Term, err)
+			continue
+		}
+
+		delay := time.Until(m.RetryAt)
+		if delay < 0 {
+			delay = 0
+		}
+
+		logrus.Infof("resuming %q from %q in %s", m.Item.Term, state, delay)
+		attempts := m.Attempts
+		r.start(m.Item, func(f *Flow) {
+			f.SetAttempts(attempts)
+			time.Sleep(delay)
+			f.Resume(state, data)
+		})
+	}
+
+	return nil
+}
+
+func (r *Runner) start(item media.SearchItem, run func(f *Flow)) {
+	r.mu.Lock()
+	if _, ok := r.flows[item.Term]; ok {
+		r.mu.Unlock()
+		logrus.Debugf("skipped %q as it is in progress", item.Term)
+		return
+	}
+
+	f := r.newFlow(item)
+	r.flows[item.Term] = f
+	r.mu.Unlock()
+
+	go run(f)
+}
+
+func (r *Runner) newFlow(item media.SearchItem) *Flow {
+	f := New(item)
+
+	var split []media.SearchItem
+	f.SetScrapeFunc(func(item media.SearchItem) ScrapeResult {
+		result := r.dispatcher.Scrape(item)
+		switch {
+		case result.Error == nil && len(result.Value) == 0 && len(result.Split) == 0:
+			result.Error = fmt.Errorf("no magnets found for %q", item.Term)
+			r.emit(Event{Type: EventNoResults, Item: item})
+		case result.Error == nil && len(result.Value) > 0:
+			r.emit(Event{Type: EventScraped, Item: item, Magnets: len(result.Value)})
+		}
+		split = result.Split
+		return result
+	})
+	f.SetExtractFunc(r.dispatcher.Extract)
+	f.SetDownloadFunc(r.dispatcher.Download)
+
+	for stage, policy := range r.policies {
+		f.SetRetryPolicy(stage, policy)
+	}
+
+	f.OnTransition(func(item media.SearchItem, from, to fsm.State) {
+		if err := r.repo.SaveState(item.Term, string(to)); err != nil {
+			logrus.Errorf("could not save state of %q: %s", item.Term, err)
+		}
+
+		// A stage succeeded, so the retries start over
+		if from != to && (to == ExtractingState || to == DownloadingState || to == DownloadedState) {
+			if err := r.repo.ResetRetries(item.Term); err != nil {
+				logrus.Errorf("could not reset retries of %q: %s", item.Term, err)
+			}
+		}
+
+		if to == DownloadedState || to == FailedState || to == SplitState || to == CancelledState {
+			r.mu.Lock()
+			delete(r.flows, item.Term)
+			r.mu.Unlock()
+		}
+
+		if e, ok := transitionEvents[to]; ok && from != to {
+			r.emit(Event{Type: e, Item: item})
+		}
+
+		// The split items are added once the state is saved, so they are not covered by the item
+		if from != to && to == SplitState {
+			for _, i := range split {
+				if err := r.Add(i); err != nil {
+					logrus.Errorf("could not add %q: %s", i.Term, err)
+				}
+			}
+		}
+	})
+
+	f.OnFail(func(item media.SearchItem, err error) {
+		r.emit(Event{Type: EventFailed, Item: item, Error: err})
+	})
+
+	f.OnRetry(func(item media.SearchItem, attempt int, err error, at time.Time) {
+		if err := r.repo.SaveRetry(item.Term, attempt, err.Error(), at); err != nil {
+			logrus.Errorf("could not save retry of %q: %s", item.Term, err)
+		}
+		r.emit(Event{Type: EventRetried, Item: item, Error: err, Attempt: attempt, RetryAt: at})
+	})
+
+	return f
+}
+
+// resumeData returns the state from which the flow continues, along with the
+// data which that state expects
+func (r *Runner) resumeData(m storage.Media) (fsm.State, interface{}, error) {
+	state := fsm.State(m.State)
+	if state == "" {
+		state = statusStates[m.Status]
+	}
+
+	switch state {
+	case PendingState, ScrapingState, ScrapingErrorState:
+		return ScrapingState, m.Item, nil
+	case ExtractingState, ExtractingErrorState:
+		magnets, err := r.repo.Torrents(m.Item.Term)
+		for i := range magnets {
+			magnets[i].Item = m.Item
+		}
+		return ExtractingState, magnets, err
+	case DownloadingState, DownloadingErrorState:
+		downloads, err := r.repo.Downloads(m.Item.Term)
+		for i := range downloads {
+			downloads[i].Item = m.Item
+		}
+		return DownloadingState, downloads, err
+	}
+
+	return "", nil, fmt.Errorf("unknown state %q", state)
+}
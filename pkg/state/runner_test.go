@@ -0,0 +1,173 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/dyrkin/fsm"
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/state"
+	"github.com/nenad/couch/pkg/storage"
+	"github.com/nenad/couch/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// storedItem is an item which was added before, in the given state of its flow
+type storedItem struct {
+	item   media.SearchItem
+	status storage.Status
+	state  fsm.State
+}
+
+func season(episodes ...int) media.SearchItem {
+	s := media.NewSeason("Show", 1, "tt0123")
+	s.Episodes = episodes
+	return s
+}
+
+func episode(e int) media.SearchItem {
+	return media.NewEpisode("Show", 1, e, "tt0123")
+}
+
+func TestRunner_Add_Episodes(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stored []storedItem
+		add    media.SearchItem
+		// started are the items whose flows were begun
+		started []string
+		// episodes are the wanted episodes of the stored season
+		episodes []int
+	}{
+		{
+			name:     "season for the wanted episodes",
+			add:      season(1, 2, 3),
+			started:  []string{"Show S01"},
+			episodes: []int{1, 2, 3},
+		},
+		{
+			name: "season without downloaded episodes",
+			stored: []storedItem{
+				{item: episode(1), status: storage.StatusDownloaded, state: state.DownloadedState},
+			},
+			add:      season(1, 2, 3),
+			started:  []string{"Show S01"},
+			episodes: []int{2, 3},
+		},
+		{
+			name: "pending episodes are wanted",
+			stored: []storedItem{
+				{item: episode(1), status: storage.StatusPending},
+			},
+			add:      season(1, 2),
+			started:  []string{"Show S01"},
+			episodes: []int{1, 2},
+		},
+		{
+			name: "last episode alone",
+			stored: []storedItem{
+				{item: episode(1), status: storage.StatusDownloaded, state: state.DownloadedState},
+				{item: episode(2), status: storage.StatusDownloading, state: state.DownloadingState},
+			},
+			add:     season(1, 2, 3),
+			started: []string{"Show S01E03"},
+		},
+		{
+			name:   "all episodes downloaded",
+			stored: []storedItem{{item: episode(1), status: storage.StatusDownloaded, state: state.DownloadedState}},
+			add:    season(1),
+		},
+		{
+			name: "season added before",
+			stored: []storedItem{
+				{item: season(1, 2), status: storage.StatusDownloaded, state: state.DownloadedState},
+			},
+			add:      season(3, 4),
+			started:  []string{"Show S01E03", "Show S01E04"},
+			episodes: []int{1, 2},
+		},
+		{
+			name: "episode covered by the season",
+			stored: []storedItem{
+				{item: season(1, 2), status: storage.StatusDownloading, state: state.DownloadingState},
+			},
+			add:      episode(2),
+			episodes: []int{1, 2},
+		},
+		{
+			name: "episode covered by the whole season",
+			stored: []storedItem{
+				{item: season(), status: storage.StatusDownloaded, state: state.DownloadedState},
+			},
+			add: episode(5),
+		},
+		{
+			name: "episode not wanted by the season",
+			stored: []storedItem{
+				{item: season(1, 2), status: storage.StatusDownloading, state: state.DownloadingState},
+			},
+			add:      episode(3),
+			started:  []string{"Show S01E03"},
+			episodes: []int{1, 2},
+		},
+		{
+			name: "episode of a split season",
+			stored: []storedItem{
+				{item: season(1, 2), status: storage.StatusScraped, state: state.SplitState},
+			},
+			add:      episode(2),
+			started:  []string{"Show S01E02"},
+			episodes: []int{1, 2},
+		},
+		{
+			name: "episode of a failed season",
+			stored: []storedItem{
+				{item: season(1, 2), status: storage.StatusError, state: state.FailedState},
+			},
+			add:      episode(2),
+			started:  []string{"Show S01E02"},
+			episodes: []int{1, 2},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := storagetest.NewDatabase(t)
+			defer cleanup()
+			repo := storage.NewMediaRepository(db)
+
+			for _, s := range tt.stored {
+				assert.NoError(t, repo.StoreItem(s.item))
+				assert.NoError(t, repo.Status(s.item.Term, s.status))
+				if s.state != "" {
+					assert.NoError(t, repo.SaveState(s.item.Term, string(s.state)))
+				}
+			}
+
+			// The flows stay in scraping, so the started ones can be told apart
+			block := make(chan struct{})
+			dispatcher := state.NewDispatcher()
+			dispatcher.OnScrape(func(item media.SearchItem) state.ScrapeResult {
+				<-block
+				return state.ScrapeResult{}
+			})
+			runner := state.NewRunner(repo, &dispatcher, nil)
+
+			assert.NoError(t, runner.Add(tt.add))
+
+			var started []string
+			for _, title := range []string{"Show S01", "Show S01E01", "Show S01E02", "Show S01E03", "Show S01E04", "Show S01E05"} {
+				if runner.Running(title) {
+					started = append(started, title)
+				}
+			}
+			assert.Equal(t, tt.started, started)
+
+			m, err := repo.Fetch("Show S01")
+			if tt.episodes == nil && err != nil {
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.episodes, m.Item.Episodes)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nenad/couch/pkg/media"
@@ -25,6 +27,19 @@ const (
 	Encodingx264 Encoding = "x264"
 	Encodingx265 Encoding = "x265"
 	EncodingVC1  Encoding = "VC-1"
+	// EncodingUnknown is stored as NULL
+	EncodingUnknown Encoding = ""
+
+	// Possible sources of a release, from the worst to the best
+	SourceCAM      Source = "CAM"
+	SourceTelesync Source = "TS"
+	SourceTelecine Source = "TC"
+	SourceScreener Source = "SCR"
+	SourceDVD      Source = "DVD"
+	SourceHDTV     Source = "HDTV"
+	SourceWEBRip   Source = "WEBRip"
+	SourceWEBDL    Source = "WEB-DL"
+	SourceBluRay   Source = "BluRay"
 )
 
 type (
@@ -38,6 +53,16 @@ type (
 		CreatedAt time.Time
 		UpdatedAt time.Time
 		Status    Status
+		// State is the last persisted state of the item's flow
+		State string
+		// Attempts is the number of retries of the currently failing stage
+		Attempts int
+		// LastError is the reason of the last failure
+		LastError string
+		// RetryAt is when the failed stage will be retried, zero if it isn't scheduled
+		RetryAt time.Time
+		// DownloadedAt is when the files were last downloaded, zero if it is unknown
+		DownloadedAt time.Time
 	}
 
 	// Quality is the quality of the media
@@ -45,31 +70,119 @@ type (
 
 	Encoding string
 
+	// Source is the medium from which the release was made, empty if unknown
+	Source string
+
 	Magnet struct {
 		Location string
+		// Name is the name of the release
+		Name     string
 		Quality  Quality
 		Encoding Encoding
+		Source   Source
+		// Group is the release group, empty if unknown
+		Group string
+		// Proper is set for PROPER and REPACK releases, which fix a broken release
+		Proper   bool
 		Item     media.SearchItem
 		Size     uint64 // Size in bytes
 		Rating   int
 		Seeders  int
+		Leechers int
+		// FailedReason is set once the magnet turned out to be unusable
+		FailedReason string
+		// RejectedReason is set if the magnet was filtered out before it was rated
+		RejectedReason string
 	}
 
 	MediaRepository struct {
 		db *sql.DB
 	}
 
+	// Seed is a file of a torrent which is seeded from the staging folder
+	Seed struct {
+		// File is the location of the file in the staging folder
+		File     string
+		Magnet   string
+		Size     int64
+		Uploaded int64
+		// StartedAt is when the file was completed
+		StartedAt time.Time
+	}
+
+	// HookRun is the result of a script which was run on an event of the item
+	HookRun struct {
+		Title string
+		Hook  string
+		Event string
+		// File is the downloaded file which the hook was run for, if any
+		File     string
+		ExitCode int
+		Output   string
+		// Error is why the hook failed, empty if it succeeded
+		Error     string
+		StartedAt time.Time
+		Duration  time.Duration
+	}
+
+	// Delivery is an attempt to deliver an event to a webhook
+	Delivery struct {
+		// ID is the same for all attempts to deliver the event to the webhook
+		ID      string
+		URL     string
+		Event   string
+		Title   string
+		Payload string
+		Attempt int
+		// StatusCode is zero if there was no response
+		StatusCode int
+		// Error is why the attempt failed, empty if the event was delivered
+		Error       string
+		DeliveredAt time.Time
+	}
+
 	// A Download stores the remote and local locations of a file
 	Download struct {
 		// Remote is the location where the original file resides (ex. URL)
-		Remote      string
+		Remote string
 		// Local is the location where the file will be downloaded
 		Local string
 		// Item is the metadata about the downloaded file
-		Item        media.SearchItem
+		Item media.SearchItem
+		// Paused is set when the download was suspended outside of a download window
+		Paused bool
+		// Magnet is the location of the magnet which contains the file
+		Magnet string
+		// Episodes are the episodes of a season which the file contains
+		Episodes []int
+	}
+
+	// An Upgrade records that the files of an item were replaced by the ones of a better magnet
+	Upgrade struct {
+		Title       string
+		From        string
+		To          string
+		FromQuality Quality
+		ToQuality   Quality
+		UpgradedAt  time.Time
 	}
 )
 
+// Sources are all known sources, from the worst to the best
+var Sources = []Source{
+	SourceCAM, SourceTelesync, SourceTelecine, SourceScreener,
+	SourceDVD, SourceHDTV, SourceWEBRip, SourceWEBDL, SourceBluRay,
+}
+
+// IsCinema returns true for sources recorded or leaked in cinemas, before the release
+func (s Source) IsCinema() bool {
+	switch s {
+	case SourceCAM, SourceTelesync, SourceTelecine, SourceScreener:
+		return true
+	}
+	return false
+}
+
 func NewMediaRepository(db *sql.DB) *MediaRepository {
 	return &MediaRepository{db}
 }
@@ -81,8 +194,8 @@ func (r *MediaRepository) StoreItem(item media.SearchItem) error {
 		return err
 	}
 	_, err = tx.Exec(
-		"INSERT INTO search_items (title, type, imdb, created_at, updated_at, status) VALUES (?, ?, ?, ?, ?, ?)",
-		item.Term, item.Type, item.IMDb, now, now, StatusPending,
+		"INSERT INTO search_items (title, type, imdb, runtime, episodes, episode_title, created_at, updated_at, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		item.Term, item.Type, item.IMDb, int(item.Runtime/time.Minute), joinEpisodes(item.Episodes), item.EpisodeTitle, now, now, StatusPending,
 	)
 	if err != nil {
 		return err
@@ -98,11 +211,13 @@ func (r *MediaRepository) AddDownload(download Download) error {
 	}
 
 	_, err = tx.Exec(
-		"INSERT OR IGNORE INTO downloads (title, url, destination, status) VALUES (?, ?, ?, ?)",
+		"INSERT OR IGNORE INTO downloads (title, url, destination, status, magnet, episodes) VALUES (?, ?, ?, ?, ?, ?)",
 		download.Item.Term,
 		download.Remote,
 		download.Local,
 		"Downloading",
+		download.Magnet,
+		joinEpisodes(download.Episodes),
 	)
 	if err != nil {
 		return err
@@ -112,8 +227,14 @@ func (r *MediaRepository) AddDownload(download Download) error {
 }
 
 func (r *MediaRepository) AddTorrent(t Magnet) error {
-	_, err := r.db.Exec(`INSERT OR IGNORE INTO torrents (title, url, quality, encoding, rating, size) VALUES (?, ?, ?, ?, ?, ?)`,
-		t.Item.Term, t.Location, t.Quality, t.Encoding, t.Rating, t.Size)
+	// Unknown encodings are stored as NULL, because of the constraint on the column
+	var encoding *Encoding
+	if t.Encoding != EncodingUnknown {
+		encoding = &t.Encoding
+	}
+
+	_, err := r.db.Exec(`INSERT OR IGNORE INTO torrents (title, url, name, quality, encoding, source, release_group, proper, rating, size, seeders, leechers, rejected_reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Item.Term, t.Location, t.Name, t.Quality, encoding, t.Source, t.Group, t.Proper, t.Rating, t.Size, t.Seeders, t.Leechers, t.RejectedReason)
 
 	return err
 }
@@ -123,63 +244,251 @@ func (r *MediaRepository) Delete(title string) error {
 	return err
 }
 
+// Fetch returns the item along with the state of its flow
 func (r *MediaRepository) Fetch(title string) (m Media, err error) {
-	row := r.db.QueryRow("SELECT title, type, status, imdb, created_at, updated_at FROM search_items WHERE title = ?", title)
-	err = row.Scan(&m.Item.Term, &m.Item.Type, &m.Status, &m.Item.IMDb, &m.CreatedAt, &m.UpdatedAt)
+	row := r.db.QueryRow(`SELECT s.title, s.type, s.status, s.imdb, s.runtime, s.episodes, s.episode_title, s.created_at, s.updated_at,
+       COALESCE(f.state, ''), COALESCE(f.attempts, 0), COALESCE(f.last_error, ''), f.retry_at
+FROM search_items s
+LEFT JOIN flows f on f.title = s.title
+WHERE s.title = ?`, title)
+
+	var runtime int
+	var episodes string
+	var retryAt *time.Time
+	err = row.Scan(&m.Item.Term, &m.Item.Type, &m.Status, &m.Item.IMDb, &runtime, &episodes, &m.Item.EpisodeTitle, &m.CreatedAt, &m.UpdatedAt,
+		&m.State, &m.Attempts, &m.LastError, &retryAt)
+	m.Item.Runtime = time.Duration(runtime) * time.Minute
+	m.Item.Episodes = splitEpisodes(episodes)
+	if retryAt != nil {
+		m.RetryAt = *retryAt
+	}
 	return m, err
 }
 
+// FindItems returns the items whose title contains the query, or whose IMDb id is the query. The
+// item with exactly the query as its title comes first.
+func (r *MediaRepository) FindItems(query string, limit int) (items []Media, err error) {
+	rows, err := r.db.Query(`SELECT s.title, s.type, s.imdb, s.status, s.created_at, s.updated_at, COALESCE(f.state, '')
+FROM search_items s
+LEFT JOIN flows f on f.title = s.title
+WHERE s.title LIKE '%' || ? || '%'
+OR s.imdb = ? COLLATE NOCASE
+ORDER BY s.title = ? COLLATE NOCASE DESC, s.created_at DESC
+LIMIT ?;`, query, query, query, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Media
+		err = rows.Scan(&m.Item.Term, &m.Item.Type, &m.Item.IMDb, &m.Status, &m.CreatedAt, &m.UpdatedAt, &m.State)
+		if err != nil {
+			return
+		}
+		items = append(items, m)
+	}
+	return items, rows.Err()
+}
+
+// States returns the number of items in each state of their flow, or in their status if they have no flow
+func (r *MediaRepository) States() (states map[string]int, err error) {
+	rows, err := r.db.Query(`SELECT COALESCE(f.state, s.status), count(*)
+FROM search_items s
+LEFT JOIN flows f on f.title = s.title
+GROUP BY 1;`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	states = make(map[string]int)
+	for rows.Next() {
+		var state string
+		var count int
+		if err = rows.Scan(&state, &count); err != nil {
+			return
+		}
+		states[state] = count
+	}
+	return states, rows.Err()
+}
+
 func (r *MediaRepository) Status(title string, status Status) error {
 	_, err := r.db.Exec("UPDATE search_items SET status = ? WHERE title = ?", status, title)
 	return err
 }
 
-func (r *MediaRepository) InProgressDownloads() (downloads []Download, err error) {
-	query := `SELECT m.title, m.type, l.url, l.destination FROM search_items m
+// Torrents returns all stored magnets for the item, the best rated first and the rejected ones last
+func (r *MediaRepository) Torrents(title string) (torrents []Magnet, err error) {
+	query := `SELECT m.title, m.type, m.imdb, t.url, t.name, t.size, t.quality, COALESCE(t.encoding, ''), t.source, t.release_group, t.proper, t.rating, t.seeders, t.leechers, t.failed_reason, t.rejected_reason
+FROM search_items m
+JOIN torrents t on t.title = m.title
+WHERE m.title = ?
+ORDER BY t.rejected_reason != '', t.rating ASC;
+`
+
+	rows, err := r.db.Query(query, title)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Magnet
+		err = rows.Scan(&t.Item.Term, &t.Item.Type, &t.Item.IMDb, &t.Location, &t.Name, &t.Size, &t.Quality, &t.Encoding, &t.Source, &t.Group, &t.Proper, &t.Rating, &t.Seeders, &t.Leechers, &t.FailedReason, &t.RejectedReason)
+		if err != nil {
+			return
+		}
+		torrents = append(torrents, t)
+	}
+	return torrents, rows.Err()
+}
+
+// Queued returns the files of all items which are being downloaded or wait for their turn
+func (r *MediaRepository) Queued() (downloads []Download, err error) {
+	query := `SELECT m.title, m.type, m.imdb, l.url, l.destination, l.paused, l.magnet, l.episodes FROM search_items m
 JOIN downloads l on l.title = m.title
-WHERE m.status in ('Extracting', 'Downloading', 'Error')
-AND l.status in ('Error', 'Downloading');
+JOIN flows f on f.title = m.title
+WHERE l.status = 'Downloading'
+AND f.state = 'Downloading'
+ORDER BY m.title, l.destination;
 `
 
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var d Download
-		err = rows.Scan(&d.Item.Term, &d.Item.Type, &d.Remote, &d.Local)
+		var episodes string
+		err = rows.Scan(&d.Item.Term, &d.Item.Type, &d.Item.IMDb, &d.Remote, &d.Local, &d.Paused, &d.Magnet, &episodes)
 		if err != nil {
 			return
 		}
+		d.Episodes = splitEpisodes(episodes)
 		downloads = append(downloads, d)
 	}
-	return downloads, nil
+	return downloads, rows.Err()
 }
 
-func (r *MediaRepository) NonExtractedTorrents() (torrents []Magnet, err error) {
-	query := `SELECT m.title, m.type, t.url, t.size, t.quality, t.encoding, t.rating FROM search_items m
-JOIN torrents t on t.title = m.title
-WHERE m.status in ('Extracting', 'Scraped', 'Pending')
-AND m.title NOT IN (SELECT l.title FROM downloads l)
-GROUP BY t.title
-ORDER BY t.rating ASC;
+// Downloads returns the files of the item which are not downloaded yet
+func (r *MediaRepository) Downloads(title string) (downloads []Download, err error) {
+	query := `SELECT m.title, m.type, m.imdb, l.url, l.destination, l.paused, l.magnet, l.episodes FROM search_items m
+JOIN downloads l on l.title = m.title
+WHERE m.title = ?
+AND l.status in ('Error', 'Downloading');
+`
+
+	rows, err := r.db.Query(query, title)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Download
+		var episodes string
+		err = rows.Scan(&d.Item.Term, &d.Item.Type, &d.Item.IMDb, &d.Remote, &d.Local, &d.Paused, &d.Magnet, &episodes)
+		if err != nil {
+			return
+		}
+		d.Episodes = splitEpisodes(episodes)
+		downloads = append(downloads, d)
+	}
+	return downloads, rows.Err()
+}
+
+// SaveState persists the state of the item's flow
+func (r *MediaRepository) SaveState(title string, state string) error {
+	now := time.Now().UTC().Format(ISO8601)
+	_, err := r.db.Exec(
+		`INSERT INTO flows (title, state, updated_at) VALUES (?, ?, ?)
+ON CONFLICT(title) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at`,
+		title, state, now,
+	)
+	return err
+}
+
+// SaveRetry persists a scheduled retry of the item's failed stage
+func (r *MediaRepository) SaveRetry(title string, attempts int, lastError string, retryAt time.Time) error {
+	_, err := r.db.Exec(
+		"UPDATE flows SET attempts = ?, last_error = ?, retry_at = ? WHERE title = ?",
+		attempts, lastError, retryAt.UTC().Format(ISO8601), title,
+	)
+	return err
+}
+
+// ResetRetries clears the attempts once a stage succeeds, while keeping the last error
+func (r *MediaRepository) ResetRetries(title string) error {
+	_, err := r.db.Exec("UPDATE flows SET attempts = 0, retry_at = NULL WHERE title = ?", title)
+	return err
+}
+
+// Unfinished returns all items which were neither downloaded nor failed, along
+// with the state of their flow. Items without a flow have an empty state.
+func (r *MediaRepository) Unfinished() (items []Media, err error) {
+	query := `SELECT s.title, s.type, s.imdb, s.runtime, s.episodes, s.episode_title, s.status, s.created_at, s.updated_at,
+       COALESCE(f.state, ''), COALESCE(f.attempts, 0), COALESCE(f.last_error, ''), f.retry_at
+FROM search_items s
+LEFT JOIN flows f on f.title = s.title
+WHERE s.status != 'Downloaded'
+AND COALESCE(f.state, '') NOT IN ('Downloaded', 'Failed', 'Split', 'Cancelled');
 `
 
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var t Magnet
-		err = rows.Scan(&t.Item.Term, &t.Item.Type, &t.Location, &t.Size, &t.Quality, &t.Encoding, &t.Rating)
+		var m Media
+		var runtime int
+		var episodes string
+		var retryAt *time.Time
+		err = rows.Scan(&m.Item.Term, &m.Item.Type, &m.Item.IMDb, &runtime, &episodes, &m.Item.EpisodeTitle, &m.Status, &m.CreatedAt, &m.UpdatedAt,
+			&m.State, &m.Attempts, &m.LastError, &retryAt)
 		if err != nil {
 			return
 		}
-		torrents = append(torrents, t)
+		m.Item.Runtime = time.Duration(runtime) * time.Minute
+		m.Item.Episodes = splitEpisodes(episodes)
+		if retryAt != nil {
+			m.RetryAt = *retryAt
+		}
+		items = append(items, m)
+	}
+	return items, rows.Err()
+}
+
+// Recent returns the latest items, the newest first
+func (r *MediaRepository) Recent(limit int) (items []Media, err error) {
+	query := `SELECT s.title, s.type, s.imdb, s.status, s.created_at, s.updated_at,
+       COALESCE(f.state, ''), COALESCE(f.last_error, '')
+FROM search_items s
+LEFT JOIN flows f on f.title = s.title
+ORDER BY s.created_at DESC
+LIMIT ?;
+`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return
 	}
-	return torrents, nil
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Media
+		err = rows.Scan(&m.Item.Term, &m.Item.Type, &m.Item.IMDb, &m.Status, &m.CreatedAt, &m.UpdatedAt, &m.State, &m.LastError)
+		if err != nil {
+			return
+		}
+		items = append(items, m)
+	}
+	return items, rows.Err()
 }
 
 func (r *MediaRepository) UpdateDownload(term, url string, isDone bool, err error) error {
@@ -227,11 +536,239 @@ FROM downloads WHERE title = ?`, term)
 		return err
 	}
 
+	if status == string(StatusDownloaded) {
+		if _, err := tx.Exec("UPDATE search_items SET downloaded_at = ? WHERE title = ?", time.Now().UTC().Format(ISO8601), term); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
+// PauseDownload persists whether the download was suspended, so it can be
+// handled correctly after a restart
+func (r *MediaRepository) PauseDownload(url string, paused bool) error {
+	_, err := r.db.Exec("UPDATE downloads SET paused = ? WHERE url = ?", paused, url)
+	return err
+}
+
+// TryMagnet records that the magnet is being used for the item
+func (r *MediaRepository) TryMagnet(title, url string) error {
+	_, err := r.db.Exec("UPDATE torrents SET tried_at = ? WHERE title = ? AND url = ?", time.Now().UTC().Format(ISO8601), title, url)
+	return err
+}
+
+// MarkMagnetBad excludes the magnet from being picked again for the item, and stores why it failed
+func (r *MediaRepository) MarkMagnetBad(title, url, reason string) error {
+	_, err := r.db.Exec("UPDATE torrents SET failed_reason = ? WHERE title = ? AND url = ?", reason, title, url)
+	return err
+}
+
+// PinMagnet makes the magnet the one which is extracted for the item, instead of the best rated one
+func (r *MediaRepository) PinMagnet(title, url string) error {
+	_, err := r.db.Exec("UPDATE torrents SET pinned = (url = ?) WHERE title = ?", url, title)
+	return err
+}
+
+// RemoveDownloads deletes the files of the item which were extracted from the magnet
+func (r *MediaRepository) RemoveDownloads(title, magnet string) error {
+	_, err := r.db.Exec("DELETE FROM downloads WHERE title = ? AND magnet = ?", title, magnet)
+	return err
+}
+
+// GetAvailableMagnet returns the best rated magnet of the item which was neither rejected nor failed, or the
+// pinned one if it wasn't failed
 func (r *MediaRepository) GetAvailableMagnet(title string) (m string, err error) {
-	row := r.db.QueryRow(`SELECT t.url FROM torrents t WHERE t.title = ? ORDER BY t.rating ASC LIMIT 1;`, title)
+	row := r.db.QueryRow(`SELECT t.url FROM torrents t WHERE t.title = ? AND t.failed_reason = '' AND (t.rejected_reason = '' OR t.pinned) ORDER BY t.pinned DESC, t.rating ASC LIMIT 1;`, title)
+	err = row.Scan(&m)
+	return m, err
+}
+
+// Downloaded returns all items which finished downloading, including the ones being upgraded
+func (r *MediaRepository) Downloaded() (items []Media, err error) {
+	query := `SELECT s.title, s.type, s.imdb, s.runtime, s.episodes, s.episode_title, s.status, s.created_at, s.updated_at, s.downloaded_at
+FROM search_items s
+LEFT JOIN flows f on f.title = s.title
+WHERE s.status = 'Downloaded'
+OR COALESCE(f.state, '') = 'Downloaded';
+`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Media
+		var runtime int
+		var episodes string
+		var downloadedAt *time.Time
+		err = rows.Scan(&m.Item.Term, &m.Item.Type, &m.Item.IMDb, &runtime, &episodes, &m.Item.EpisodeTitle, &m.Status, &m.CreatedAt, &m.UpdatedAt, &downloadedAt)
+		if err != nil {
+			return
+		}
+		m.Item.Runtime = time.Duration(runtime) * time.Minute
+		m.Item.Episodes = splitEpisodes(episodes)
+		if downloadedAt != nil {
+			m.DownloadedAt = *downloadedAt
+		}
+		items = append(items, m)
+	}
+	return items, rows.Err()
+}
+
+// GrabbedMagnet returns the magnet of the downloaded files of the item
+func (r *MediaRepository) GrabbedMagnet(title string) (t Magnet, err error) {
+	row := r.db.QueryRow(`SELECT m.title, m.type, m.imdb, m.runtime, t.url, t.name, t.size, t.quality, COALESCE(t.encoding, ''), t.source, t.release_group, t.proper, t.rating, t.seeders, t.leechers
+FROM search_items m
+JOIN downloads d on d.title = m.title
+JOIN torrents t on t.title = d.title AND t.url = d.magnet
+WHERE m.title = ?
+AND d.status = 'Downloaded'
+LIMIT 1;`, title)
+
+	var runtime int
+	err = row.Scan(&t.Item.Term, &t.Item.Type, &t.Item.IMDb, &runtime, &t.Location, &t.Name, &t.Size, &t.Quality, &t.Encoding, &t.Source, &t.Group, &t.Proper, &t.Rating, &t.Seeders, &t.Leechers)
+	t.Item.Runtime = time.Duration(runtime) * time.Minute
+	return t, err
+}
+
+// Files returns the downloaded files of the item which were extracted from the magnet
+func (r *MediaRepository) Files(title, magnet string) (downloads []Download, err error) {
+	query := `SELECT m.title, m.type, m.imdb, l.url, l.destination, l.paused, l.magnet, l.episodes FROM search_items m
+JOIN downloads l on l.title = m.title
+WHERE m.title = ?
+AND l.magnet = ?
+AND l.status = 'Downloaded';
+`
+
+	rows, err := r.db.Query(query, title, magnet)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Download
+		var episodes string
+		err = rows.Scan(&d.Item.Term, &d.Item.Type, &d.Item.IMDb, &d.Remote, &d.Local, &d.Paused, &d.Magnet, &episodes)
+		if err != nil {
+			return
+		}
+		d.Episodes = splitEpisodes(episodes)
+		downloads = append(downloads, d)
+	}
+	return downloads, rows.Err()
+}
+
+// ReplaceMagnet forgets the files of the previous magnet, and records the upgrade
+func (r *MediaRepository) ReplaceMagnet(u Upgrade) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM downloads WHERE title = ? AND magnet = ?", u.Title, u.From); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO upgrades (title, from_magnet, to_magnet, from_quality, to_quality, upgraded_at) VALUES (?, ?, ?, ?, ?, ?)",
+		u.Title, u.From, u.To, u.FromQuality, u.ToQuality, u.UpgradedAt.UTC().Format(ISO8601),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE search_items SET status = ?, downloaded_at = ? WHERE title = ?", StatusDownloaded, u.UpgradedAt.UTC().Format(ISO8601), u.Title); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Upgrades returns the upgrade history of the item, the oldest first
+func (r *MediaRepository) Upgrades(title string) (upgrades []Upgrade, err error) {
+	rows, err := r.db.Query(`SELECT title, from_magnet, to_magnet, from_quality, to_quality, upgraded_at
+FROM upgrades WHERE title = ? ORDER BY upgraded_at ASC`, title)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u Upgrade
+		err = rows.Scan(&u.Title, &u.From, &u.To, &u.FromQuality, &u.ToQuality, &u.UpgradedAt)
+		if err != nil {
+			return
+		}
+		upgrades = append(upgrades, u)
+	}
+	return upgrades, rows.Err()
+}
+
+// DownloadedEpisodes returns the episodes of the season which were downloaded, either individually
+// or as files of the season itself
+func (r *MediaRepository) DownloadedEpisodes(season media.SearchItem) (map[int]bool, error) {
+	episodes := make(map[int]bool)
+	if season.Type != media.TypeSeason {
+		return episodes, nil
+	}
+
+	prefix := season.Term + "E"
+	rows, err := r.db.Query(`SELECT title FROM search_items
+WHERE type = ? AND status = ? AND substr(title, 1, length(?)) = ?`, media.TypeEpisode, StatusDownloaded, prefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item media.SearchItem
+		if err := rows.Scan(&item.Term); err != nil {
+			return nil, err
+		}
+		item.Type = media.TypeEpisode
+		_, e := item.Episode()
+		episodes[e] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Files of the season itself which were already downloaded
+	files, err := r.db.Query(`SELECT episodes FROM downloads WHERE title = ? AND status = 'Downloaded'`, season.Term)
+	if err != nil {
+		return nil, err
+	}
+	defer files.Close()
+
+	for files.Next() {
+		var value string
+		if err := files.Scan(&value); err != nil {
+			return nil, err
+		}
+		for _, e := range splitEpisodes(value) {
+			episodes[e] = true
+		}
+	}
+	return episodes, files.Err()
+}
+
+// MoveDownload records that the file was moved to the destination
+func (r *MediaRepository) MoveDownload(url, destination string) error {
+	_, err := r.db.Exec("UPDATE downloads SET destination = ? WHERE url = ?", destination, url)
+	return err
+}
+
+// DownloadMagnet returns the magnet from which the file was extracted, empty if it is unknown
+func (r *MediaRepository) DownloadMagnet(url string) (m string, err error) {
+	row := r.db.QueryRow("SELECT magnet FROM downloads WHERE url = ?", url)
 	err = row.Scan(&m)
 	return m, err
 }
@@ -244,3 +781,114 @@ WHERE r.url = ?`, path)
 	err = row.Scan(&m.Term, &m.Type, &m.IMDb)
 	return m, err
 }
+
+// joinEpisodes stores the wanted episodes of a season as a comma separated list
+func joinEpisodes(episodes []int) string {
+	values := make([]string, len(episodes))
+	for i, e := range episodes {
+		values[i] = strconv.Itoa(e)
+	}
+	return strings.Join(values, ",")
+}
+
+func splitEpisodes(value string) (episodes []int) {
+	for _, v := range strings.Split(value, ",") {
+		if e, err := strconv.Atoi(v); err == nil {
+			episodes = append(episodes, e)
+		}
+	}
+	return episodes
+}
+
+// AddSeed records that the file is seeded
+func (r *MediaRepository) AddSeed(s Seed) error {
+	_, err := r.db.Exec("INSERT OR REPLACE INTO seeds (file, magnet, size, uploaded, started_at) VALUES (?, ?, ?, ?, ?)",
+		s.File, s.Magnet, s.Size, s.Uploaded, s.StartedAt.UTC().Format(ISO8601))
+	return err
+}
+
+// Seeds returns the files which are seeded
+func (r *MediaRepository) Seeds() (seeds []Seed, err error) {
+	rows, err := r.db.Query("SELECT file, magnet, size, uploaded, started_at FROM seeds")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Seed
+		if err := rows.Scan(&s.File, &s.Magnet, &s.Size, &s.Uploaded, &s.StartedAt); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, s)
+	}
+	return seeds, rows.Err()
+}
+
+// UpdateSeed stores how much of the file was uploaded
+func (r *MediaRepository) UpdateSeed(file string, uploaded int64) error {
+	_, err := r.db.Exec("UPDATE seeds SET uploaded = ? WHERE file = ?", uploaded, file)
+	return err
+}
+
+// RemoveSeed forgets the file once it isn't seeded anymore
+func (r *MediaRepository) RemoveSeed(file string) error {
+	_, err := r.db.Exec("DELETE FROM seeds WHERE file = ?", file)
+	return err
+}
+
+// AddHookRun records the result of a hook
+func (r *MediaRepository) AddHookRun(h HookRun) error {
+	_, err := r.db.Exec(`INSERT INTO hook_runs (title, hook, event, file, exit_code, output, error, started_at, duration_ms)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		h.Title, h.Hook, h.Event, h.File, h.ExitCode, h.Output, h.Error, h.StartedAt.UTC().Format(ISO8601), h.Duration.Nanoseconds()/int64(time.Millisecond))
+	return err
+}
+
+// HookRuns returns the results of the hooks of the item, the oldest first
+func (r *MediaRepository) HookRuns(title string) (runs []HookRun, err error) {
+	rows, err := r.db.Query(`SELECT title, hook, event, file, exit_code, output, error, started_at, duration_ms
+FROM hook_runs WHERE title = ? ORDER BY started_at ASC`, title)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h HookRun
+		var duration int64
+		if err := rows.Scan(&h.Title, &h.Hook, &h.Event, &h.File, &h.ExitCode, &h.Output, &h.Error, &h.StartedAt, &duration); err != nil {
+			return nil, err
+		}
+		h.Duration = time.Duration(duration) * time.Millisecond
+		runs = append(runs, h)
+	}
+	return runs, rows.Err()
+}
+
+// AddDelivery records an attempt to deliver an event to a webhook
+func (r *MediaRepository) AddDelivery(d Delivery) error {
+	_, err := r.db.Exec(`INSERT INTO webhook_deliveries (id, url, event, title, payload, attempt, status_code, error, delivered_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, d.URL, d.Event, d.Title, d.Payload, d.Attempt, d.StatusCode, d.Error, d.DeliveredAt.UTC().Format(ISO8601))
+	return err
+}
+
+// Deliveries returns the latest attempts to deliver events to webhooks, the newest first
+func (r *MediaRepository) Deliveries(limit int) (deliveries []Delivery, err error) {
+	rows, err := r.db.Query(`SELECT id, url, event, title, payload, attempt, status_code, error, delivered_at
+FROM webhook_deliveries ORDER BY delivered_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Delivery
+		if err := rows.Scan(&d.ID, &d.URL, &d.Event, &d.Title, &d.Payload, &d.Attempt, &d.StatusCode, &d.Error, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const ISO8601 string = "2006-01-02 03:04:05.000"
+const ISO8601 string = "2006-01-02 15:04:05.000"
 
 func NewCouchDatabase(filename string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", filename+"?cache=shared&_fk=true&_journal=WAL")
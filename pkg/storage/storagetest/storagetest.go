@@ -0,0 +1,31 @@
+// Package storagetest creates the databases used by the tests of other packages
+package storagetest
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nenad/couch/pkg/storage"
+)
+
+// NewDatabase returns a migrated database in a new folder, which is removed by the returned func
+func NewDatabase(t testing.TB) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "couch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := storage.NewCouchDatabase(path.Join(dir, "couch.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
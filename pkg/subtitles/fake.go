@@ -0,0 +1,47 @@
+package subtitles
+
+import "sync"
+
+// Fake is a provider which keeps the subtitles in memory, and records the queries it gets
+type Fake struct {
+	mu        sync.Mutex
+	subtitles []fakeSubtitle
+	queries   []Query
+}
+
+type fakeSubtitle struct {
+	query   Query
+	content []byte
+}
+
+// Add stores the subtitles for the query, where an empty hash matches any video
+func (f *Fake) Add(q Query, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subtitles = append(f.subtitles, fakeSubtitle{query: q, content: content})
+}
+
+// Queries returns all queries which were searched for
+func (f *Fake) Queries() []Query {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Query(nil), f.queries...)
+}
+
+func (f *Fake) Search(q Query) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, q)
+
+	for _, s := range f.subtitles {
+		stored := s.query
+		if stored.Hash != "" && stored.Hash != q.Hash {
+			continue
+		}
+		stored.Hash, stored.Size = q.Hash, q.Size
+		if stored == q {
+			return s.content, nil
+		}
+	}
+	return nil, ErrNotFound
+}
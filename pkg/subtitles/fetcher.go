@@ -0,0 +1,67 @@
+package subtitles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/sirupsen/logrus"
+)
+
+// Fetcher writes the subtitles of a downloaded video next to it, in every language
+// which wasn't already found in the torrent
+type Fetcher struct {
+	provider  Provider
+	languages []string
+}
+
+func NewFetcher(provider Provider, languages []string) (*Fetcher, error) {
+	for _, l := range languages {
+		if !IsLanguage(l) {
+			return nil, fmt.Errorf("unknown language %q, expected an ISO 639-1 code", l)
+		}
+	}
+
+	return &Fetcher{provider: provider, languages: languages}, nil
+}
+
+// Fetch queries the provider for the missing subtitles of the video, which is the episode
+// of a season or the item itself
+func (f *Fetcher) Fetch(item media.SearchItem, episode int, video string) error {
+	var missing []string
+	for _, l := range f.languages {
+		if _, err := os.Stat(Path(video, l)); os.IsNotExist(err) {
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	hash, size, err := Hash(video)
+	if err != nil {
+		logrus.Debugf("searching subtitles of %s without its hash: %s", video, err)
+	}
+
+	for _, l := range missing {
+		q := NewQuery(item, episode, l)
+		q.Hash, q.Size = hash, size
+
+		content, err := f.provider.Search(q)
+		if err == ErrNotFound {
+			logrus.Infof("no %s subtitles found for %s", l, video)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not search %s subtitles: %s", l, err)
+		}
+
+		if err := ioutil.WriteFile(Path(video, l), content, 0644); err != nil {
+			return fmt.Errorf("could not write subtitles: %s", err)
+		}
+		logrus.Infof("saved %s subtitles of %s", l, video)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package subtitles_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nenad/couch/pkg/media"
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetcher_Fetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subtitles")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	video := filepath.Join(dir, "Show S01E02.mkv")
+	assert.NoError(t, ioutil.WriteFile(video, make([]byte, 128*1024), 0644))
+	// The English subtitles were in the torrent
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Show S01E02.en.srt"), []byte("torrent"), 0644))
+
+	provider := &subtitles.Fake{}
+	provider.Add(subtitles.Query{IMDb: "tt1", Season: 1, Episode: 2, Language: "de"}, []byte("german"))
+	provider.Add(subtitles.Query{IMDb: "tt1", Season: 1, Episode: 2, Language: "en"}, []byte("english"))
+
+	fetcher, err := subtitles.NewFetcher(provider, []string{"en", "de", "fr"})
+	assert.NoError(t, err)
+	assert.NoError(t, fetcher.Fetch(media.NewSeason("Show", 1, "tt1"), 2, video))
+
+	german, err := ioutil.ReadFile(filepath.Join(dir, "Show S01E02.de.srt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "german", string(german))
+
+	english, err := ioutil.ReadFile(filepath.Join(dir, "Show S01E02.en.srt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "torrent", string(english))
+
+	_, err = os.Stat(filepath.Join(dir, "Show S01E02.fr.srt"))
+	assert.True(t, os.IsNotExist(err))
+
+	queries := provider.Queries()
+	assert.Len(t, queries, 2)
+	assert.Equal(t, "de", queries[0].Language)
+	assert.Equal(t, "0000000000020000", queries[0].Hash)
+	assert.Equal(t, "fr", queries[1].Language)
+}
+
+func TestNewFetcher_UnknownLanguage(t *testing.T) {
+	_, err := subtitles.NewFetcher(&subtitles.Fake{}, []string{"english"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package subtitles
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// OpenSubtitlesURL is the address of the REST API of opensubtitles.com
+const OpenSubtitlesURL = "https://api.opensubtitles.com/api/v1"
+
+type (
+	// OpenSubtitles searches opensubtitles.com, preferring subtitles which match the hash of the video
+	OpenSubtitles struct {
+		client  *http.Client
+		baseURL string
+		apiKey  string
+	}
+
+	openSubtitlesResults struct {
+		Data []struct {
+			Attributes struct {
+				Language       string `json:"language"`
+				MovieHashMatch bool   `json:"moviehash_match"`
+				Files          []struct {
+					FileID int `json:"file_id"`
+				} `json:"files"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+)
+
+func NewOpenSubtitles(client *http.Client, baseURL, apiKey string) *OpenSubtitles {
+	if baseURL == "" {
+		baseURL = OpenSubtitlesURL
+	}
+
+	return &OpenSubtitles{
+		client:  client,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+	}
+}
+
+func (o *OpenSubtitles) Search(q Query) ([]byte, error) {
+	params := url.Values{}
+	params.Set("languages", q.Language)
+	if q.Hash != "" {
+		params.Set("moviehash", q.Hash)
+	}
+	imdb := strings.TrimLeft(strings.TrimPrefix(q.IMDb, "tt"), "0")
+	if q.Season > 0 {
+		params.Set("parent_imdb_id", imdb)
+		params.Set("season_number", strconv.Itoa(q.Season))
+		params.Set("episode_number", strconv.Itoa(q.Episode))
+	} else {
+		params.Set("imdb_id", imdb)
+	}
+
+	req, err := o.request(http.MethodGet, "/subtitles?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var results openSubtitlesResults
+	if err := o.do(req, &results); err != nil {
+		return nil, fmt.Errorf("could not search subtitles: %s", err)
+	}
+
+	fileID := 0
+	for _, d := range results.Data {
+		if len(d.Attributes.Files) == 0 || d.Attributes.Language != q.Language {
+			continue
+		}
+		if fileID == 0 || d.Attributes.MovieHashMatch {
+			fileID = d.Attributes.Files[0].FileID
+		}
+		if d.Attributes.MovieHashMatch {
+			break
+		}
+	}
+	if fileID == 0 {
+		return nil, ErrNotFound
+	}
+
+	body, err := json.Marshal(map[string]int{"file_id": fileID})
+	if err != nil {
+		return nil, err
+	}
+	req, err = o.request(http.MethodPost, "/download", body)
+	if err != nil {
+		return nil, err
+	}
+	var download struct {
+		Link string `json:"link"`
+	}
+	if err := o.do(req, &download); err != nil {
+		return nil, fmt.Errorf("could not get the link of file %d: %s", fileID, err)
+	}
+
+	resp, err := o.client.Get(download.Link)
+	if err != nil {
+		return nil, fmt.Errorf("could not download file %d: %s", fileID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download file %d: status %d", fileID, resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (o *OpenSubtitles) request(method, endpoint string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, o.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Api-Key", o.apiKey)
+	req.Header.Set("User-Agent", "couch v1")
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (o *OpenSubtitles) do(req *http.Request, v interface{}) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
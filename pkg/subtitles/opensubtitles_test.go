@@ -0,0 +1,61 @@
+package subtitles_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/stretchr/testify/assert"
+)
+
+const openSubtitlesResponse = `{"data": [
+	{"attributes": {"language": "en", "moviehash_match": false, "files": [{"file_id": 1}]}},
+	{"attributes": {"language": "en", "moviehash_match": true, "files": [{"file_id": 2}]}}
+]}`
+
+func TestOpenSubtitles_Search(t *testing.T) {
+	var query url.Values
+	var fileID int
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subtitles":
+			assert.Equal(t, "key", r.Header.Get("Api-Key"))
+			query = r.URL.Query()
+			_, _ = w.Write([]byte(openSubtitlesResponse))
+		case "/download":
+			var body map[string]int
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			fileID = body["file_id"]
+			_, _ = w.Write([]byte(`{"link": "` + server.URL + `/file.srt"}`))
+		case "/file.srt":
+			_, _ = w.Write([]byte("subtitles"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := subtitles.NewOpenSubtitles(server.Client(), server.URL, "key")
+	content, err := provider.Search(subtitles.Query{IMDb: "tt0123", Season: 1, Episode: 2, Hash: "abc", Language: "en"})
+	assert.NoError(t, err)
+	assert.Equal(t, "subtitles", string(content))
+	assert.Equal(t, 2, fileID)
+	assert.Equal(t, "123", query.Get("parent_imdb_id"))
+	assert.Equal(t, "2", query.Get("episode_number"))
+	assert.Equal(t, "abc", query.Get("moviehash"))
+}
+
+func TestOpenSubtitles_SearchNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	provider := subtitles.NewOpenSubtitles(server.Client(), server.URL, "key")
+	_, err := provider.Search(subtitles.Query{IMDb: "tt0123", Language: "en"})
+	assert.Equal(t, subtitles.ErrNotFound, err)
+}
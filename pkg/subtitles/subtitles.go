@@ -0,0 +1,154 @@
+package subtitles
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/nenad/couch/pkg/media"
+)
+
+// hashChunk is the size of the beginning and the end of a video which are hashed
+const hashChunk = 64 * 1024
+
+// ErrNotFound is returned by a provider which has no subtitles for the video
+var ErrNotFound = errors.New("no subtitles found")
+
+// languages maps ISO 639-1 codes to the other names of the language found in file names
+var languages = map[string][]string{
+	"ar": {"ara", "arabic"},
+	"bg": {"bul", "bulgarian"},
+	"cs": {"cze", "ces", "czech"},
+	"da": {"dan", "danish"},
+	"de": {"ger", "deu", "german"},
+	"el": {"gre", "ell", "greek"},
+	"en": {"eng", "english"},
+	"es": {"spa", "spanish"},
+	"fi": {"fin", "finnish"},
+	"fr": {"fre", "fra", "french"},
+	"he": {"heb", "hebrew"},
+	"hr": {"hrv", "croatian"},
+	"hu": {"hun", "hungarian"},
+	"it": {"ita", "italian"},
+	"ja": {"jpn", "japanese"},
+	"ko": {"kor", "korean"},
+	"mk": {"mac", "mkd", "macedonian"},
+	"nl": {"dut", "nld", "dutch"},
+	"no": {"nor", "norwegian"},
+	"pl": {"pol", "polish"},
+	"pt": {"por", "portuguese"},
+	"ro": {"rum", "ron", "romanian"},
+	"ru": {"rus", "russian"},
+	"sl": {"slv", "slovenian"},
+	"sr": {"srp", "serbian"},
+	"sv": {"swe", "swedish"},
+	"tr": {"tur", "turkish"},
+	"zh": {"chi", "zho", "chinese"},
+}
+
+var wordRegex = regexp.MustCompile(`[a-zA-Z0-9]+`)
+
+type (
+	// Query describes the video whose subtitles are searched for
+	Query struct {
+		// IMDb is the id of the movie or the TV show
+		IMDb string
+		// Season and Episode are zero for movies
+		Season  int
+		Episode int
+		// Hash is the OpenSubtitles hash of the video, empty if it couldn't be computed
+		Hash string
+		Size int64
+		// Language is an ISO 639-1 code, ex. "en"
+		Language string
+	}
+
+	// Provider finds the subtitles of a video, and returns ErrNotFound if it has none
+	Provider interface {
+		Search(q Query) ([]byte, error)
+	}
+)
+
+// NewQuery returns the query for the subtitles of the episode of the item, or of the movie
+func NewQuery(item media.SearchItem, episode int, language string) Query {
+	season, e := item.Episode()
+	if e != 0 {
+		episode = e
+	}
+	return Query{IMDb: item.IMDb, Season: season, Episode: episode, Language: language}
+}
+
+// IsSubtitle returns true for the subtitle files which can be stored next to a video
+func IsSubtitle(file string) bool {
+	return strings.ToLower(path.Ext(file)) == ".srt"
+}
+
+// IsLanguage returns true if the code is a known ISO 639-1 code
+func IsLanguage(code string) bool {
+	_, ok := languages[code]
+	return ok
+}
+
+// Language returns the ISO 639-1 code of the language in the name of a subtitle file, ex.
+// "Show.S01E02.eng.srt", "Subs/2_English.srt" or "Movie.en.srt", and empty if it is unknown
+func Language(file string) string {
+	name := path.Base(file)
+	words := wordRegex.FindAllString(strings.TrimSuffix(name, path.Ext(name)), -1)
+	for i := len(words) - 1; i >= 0; i-- {
+		word := strings.ToLower(words[i])
+		for code, names := range languages {
+			// Two letter codes are too common in names, so only the last word is checked
+			if word == code && i == len(words)-1 {
+				return code
+			}
+			for _, n := range names {
+				if word == n {
+					return code
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Path returns where the subtitles of the video are stored, ex. "Show S01E02.en.srt"
+func Path(video, language string) string {
+	return strings.TrimSuffix(video, path.Ext(video)) + "." + language + ".srt"
+}
+
+// Hash returns the OpenSubtitles hash of the video, which is its size added to the sum of the
+// 64-bit words in its first and last 64 KiB, along with the size
+func Hash(video string) (string, int64, error) {
+	f, err := os.Open(video)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	size := info.Size()
+	if size < hashChunk*2 {
+		return "", 0, fmt.Errorf("%s is too small to be hashed", video)
+	}
+
+	hash := uint64(size)
+	buf := make([]byte, hashChunk)
+	for _, offset := range []int64{0, size - hashChunk} {
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return "", 0, err
+		}
+		for i := 0; i < hashChunk; i += 8 {
+			hash += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+
+	return fmt.Sprintf("%016x", hash), size, nil
+}
@@ -0,0 +1,57 @@
+package subtitles_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nenad/couch/pkg/subtitles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguage(t *testing.T) {
+	testCases := []struct {
+		file     string
+		language string
+	}{
+		{"Show.S01E02.1080p.WEB.x264-GRP.eng.srt", "en"},
+		{"Subs/Show.S01E02.1080p.WEB.x264-GRP/2_English.srt", "en"},
+		{"Subs/3_German.srt", "de"},
+		{"Movie.2019.de.srt", "de"},
+		{"The.French.Dispatch.2021.English.srt", "en"},
+		{"It.2017.srt", ""},
+		{"Movie.2019.srt", ""},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.file, func(t *testing.T) {
+			assert.Equal(t, test.language, subtitles.Language(test.file))
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/tv/Show/Season 1/Show S01E02.en.srt", subtitles.Path("/tv/Show/Season 1/Show S01E02.mkv", "en"))
+}
+
+func TestHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subtitles")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	video := filepath.Join(dir, "video.mkv")
+	content := make([]byte, 128*1024)
+	content[0], content[len(content)-8] = 1, 2
+	assert.NoError(t, ioutil.WriteFile(video, content, 0644))
+
+	hash, size, err := subtitles.Hash(video)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(128*1024), size)
+	assert.Equal(t, "0000000000020003", hash)
+
+	small := filepath.Join(dir, "small.mkv")
+	assert.NoError(t, ioutil.WriteFile(small, content[:1024], 0644))
+	_, _, err = subtitles.Hash(small)
+	assert.Error(t, err)
+}
@@ -5,17 +5,41 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/nenad/couch/pkg/config"
+	"github.com/nenad/couch/pkg/download"
+	"github.com/nenad/couch/pkg/magnet"
+	"github.com/nenad/couch/pkg/storage"
 	"github.com/sirupsen/logrus"
 )
 
 const templateDir = "web/templates/"
 
-func NewWebServer(config config.Config, store config.Saver) *http.Server {
+type settings struct {
+	mu   sync.Mutex
+	conf config.Config
+}
+
+// Appliers put the changed parts of the config into effect while couch is running
+type Appliers struct {
+	RateLimit func(config.RateLimitConfig) error
+	Blocklist func(config.BlocklistConfig) error
+}
+
+// recentItems is the number of items shown on the downloads page
+const recentItems = 50
+
+func NewWebServer(config config.Config, store config.Saver, apply Appliers, repo *storage.MediaRepository) *http.Server {
+	s := &settings{conf: config}
+
 	mux := &http.ServeMux{}
-	mux.HandleFunc("/updateSettings", updateConfig(config, store))
-	mux.HandleFunc("/", showIndex(config))
+	mux.HandleFunc("/updateSettings", updateConfig(s, store))
+	mux.HandleFunc("/updateRateLimit", updateRateLimit(s, store, apply.RateLimit))
+	mux.HandleFunc("/updateBlocklist", updateBlocklist(s, store, apply.Blocklist))
+	mux.HandleFunc("/downloads", showDownloads(repo))
+	mux.HandleFunc("/", showIndex(s))
 
 	return &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.Port),
@@ -23,9 +47,73 @@ func NewWebServer(config config.Config, store config.Saver) *http.Server {
 	}
 }
 
-func updateConfig(conf config.Config, store config.Saver) http.HandlerFunc {
+func updateConfig(s *settings, store config.Saver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		conf := s.conf
+		if err := json.NewDecoder(r.Body).Decode(&conf); err != nil {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+
+		if err := store.Save(conf); err != nil {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+		s.conf = conf
+
+		w.WriteHeader(200)
+	}
+}
+
+// updateRateLimit applies the new limits to running downloads and stores them
+func updateRateLimit(s *settings, store config.Saver, apply func(config.RateLimitConfig) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		conf := s.conf
+		if err := json.NewDecoder(r.Body).Decode(&conf.RateLimit); err != nil {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+
+		if err := apply(conf.RateLimit); err != nil {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+
+		if err := store.Save(conf); err != nil {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+		s.conf = conf
+
+		w.WriteHeader(200)
+	}
+}
+
+// updateBlocklist applies the new blocklist to the following searches and stores it
+func updateBlocklist(s *settings, store config.Saver, apply func(config.BlocklistConfig) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := json.NewDecoder(r.Body).Decode(conf); err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		conf := s.conf
+		if err := json.NewDecoder(r.Body).Decode(&conf.Blocklist); err != nil {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+
+		if err := apply(conf.Blocklist); err != nil {
 			w.WriteHeader(400)
 			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
 			return
@@ -36,29 +124,67 @@ func updateConfig(conf config.Config, store config.Saver) http.HandlerFunc {
 			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
 			return
 		}
+		s.conf = conf
 
 		w.WriteHeader(200)
 	}
 }
 
-func showIndex(conf config.Config) http.HandlerFunc {
+// blockedSource is a checkbox of the blocklist form
+type blockedSource struct {
+	Source  storage.Source
+	Blocked bool
+}
+
+func showIndex(s *settings) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		conf := s.conf
+		s.mu.Unlock()
+
 		t := template.New("main")
 		t, err := template.ParseGlob(templateDir + "*")
 		if err != nil {
 			_, _ = w.Write([]byte(err.Error()))
 			return
 		}
+		blockedNames := conf.Blocklist.Sources
+		if blockedNames == nil {
+			blockedNames = magnet.DefaultBlockedSources
+		}
+		keywords := conf.Blocklist.Keywords
+		if keywords == nil {
+			keywords = magnet.DefaultBlockedKeywords
+		}
+		var sources []blockedSource
+		for _, source := range storage.Sources {
+			b := blockedSource{Source: source}
+			for _, name := range blockedNames {
+				b.Blocked = b.Blocked || strings.EqualFold(name, string(source))
+			}
+			sources = append(sources, b)
+		}
+
 		err = t.ExecuteTemplate(w, "settings", struct {
-			Port            int
-			MovieDirectory  string
-			TVShowDirectory string
-			DownloaderType  string
+			Port             int
+			MovieDirectory   string
+			TVShowDirectory  string
+			DownloaderType   string
+			GlobalRateLimit  int64
+			HTTPRateLimit    int64
+			TorrentRateLimit int64
+			BlockedSources   []blockedSource
+			BlockedKeywords  string
 		}{
-			Port:            conf.Port,
-			TVShowDirectory: conf.TVShowsPath,
-			MovieDirectory:  conf.MoviesPath,
-			DownloaderType:  conf.Downloader,
+			Port:             conf.Port,
+			TVShowDirectory:  conf.TVShowsPath,
+			MovieDirectory:   conf.MoviesPath,
+			DownloaderType:   conf.Downloader,
+			GlobalRateLimit:  conf.RateLimit.Global / 1000,
+			HTTPRateLimit:    conf.RateLimit.Getters[download.TypeHTTP] / 1000,
+			TorrentRateLimit: conf.RateLimit.Getters[download.TypeTorrent] / 1000,
+			BlockedSources:   sources,
+			BlockedKeywords:  strings.Join(keywords, ", "),
 		})
 
 		if err != nil {
@@ -68,3 +194,64 @@ func showIndex(conf config.Config) http.HandlerFunc {
 		logrus.Debugf("rendered page")
 	}
 }
+
+// candidate is a magnet as shown on the downloads page
+type candidate struct {
+	storage.Magnet
+	SizeMB uint64
+	Rank   int
+}
+
+// showDownloads lists the recent items along with their magnets, including the rejected ones,
+// the upgrades of their files and the results of their hooks
+func showDownloads(repo *storage.MediaRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		items, err := repo.Recent(recentItems)
+		if err != nil {
+			w.WriteHeader(500)
+			_, _ = w.Write([]byte(fmt.Sprintf("error occurred: %s", err)))
+			return
+		}
+
+		type download struct {
+			storage.Media
+			Candidates []candidate
+			Upgrades   []storage.Upgrade
+			HookRuns   []storage.HookRun
+		}
+
+		var downloads []download
+		for _, item := range items {
+			magnets, err := repo.Torrents(item.Item.Term)
+			if err != nil {
+				logrus.Errorf("could not get magnets of %q: %s", item.Item.Term, err)
+			}
+
+			upgrades, err := repo.Upgrades(item.Item.Term)
+			if err != nil {
+				logrus.Errorf("could not get upgrades of %q: %s", item.Item.Term, err)
+			}
+
+			runs, err := repo.HookRuns(item.Item.Term)
+			if err != nil {
+				logrus.Errorf("could not get hook runs of %q: %s", item.Item.Term, err)
+			}
+
+			d := download{Media: item, Upgrades: upgrades, HookRuns: runs}
+			for _, m := range magnets {
+				d.Candidates = append(d.Candidates, candidate{Magnet: m, SizeMB: m.Size >> 20, Rank: m.Rating + 1})
+			}
+			downloads = append(downloads, d)
+		}
+
+		t, err := template.ParseGlob(templateDir + "*")
+		if err != nil {
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := t.ExecuteTemplate(w, "downloads", downloads); err != nil {
+			logrus.Error(err)
+		}
+	}
+}
@@ -36,5 +36,118 @@ status TEXT NOT NULL CHECK(status in ('Error', 'Downloading', 'Downloaded')))`,
 		// Telegram
 		`CREATE TABLE telegram (
 id TEXT NOT NULL PRIMARY KEY)`,
+
+		// Downloads paused outside of the download windows
+		`ALTER TABLE downloads ADD COLUMN paused INTEGER NOT NULL DEFAULT 0`,
+
+		// State of the flow for every item, used to resume after a restart
+		`CREATE TABLE flows (
+title TEXT NOT NULL PRIMARY KEY REFERENCES search_items(title) ON DELETE CASCADE,
+state TEXT NOT NULL,
+updated_at datetime NOT NULL)`,
+
+		// Retries of failed stages
+		`ALTER TABLE flows ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE flows ADD COLUMN last_error TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE flows ADD COLUMN retry_at datetime`,
+
+		// Magnets which were tried, and the magnet each download comes from
+		`ALTER TABLE torrents ADD COLUMN tried_at datetime`,
+		`ALTER TABLE torrents ADD COLUMN failed_reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE downloads ADD COLUMN magnet TEXT NOT NULL DEFAULT ''`,
+
+		// Health of the torrents
+		`ALTER TABLE torrents ADD COLUMN seeders INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE torrents ADD COLUMN leechers INTEGER NOT NULL DEFAULT 0`,
+
+		// Runtime in minutes, and magnets which were rejected before rating
+		`ALTER TABLE search_items ADD COLUMN runtime INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE torrents ADD COLUMN rejected_reason TEXT NOT NULL DEFAULT ''`,
+
+		// Name of the release
+		`ALTER TABLE torrents ADD COLUMN name TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE torrents ADD COLUMN source TEXT NOT NULL DEFAULT ''`,
+
+		// Downloaded items which were replaced by a better release
+		`CREATE TABLE upgrades (
+title TEXT REFERENCES search_items(title) ON DELETE CASCADE,
+from_magnet TEXT NOT NULL,
+to_magnet TEXT NOT NULL,
+from_quality TEXT NOT NULL,
+to_quality TEXT NOT NULL,
+upgraded_at datetime NOT NULL)`,
+
+		// PROPER and REPACK releases, and when the files of an item were downloaded
+		`ALTER TABLE torrents ADD COLUMN release_group TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE torrents ADD COLUMN proper INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE search_items ADD COLUMN downloaded_at datetime`,
+
+		// Wanted episodes of a season
+		`ALTER TABLE search_items ADD COLUMN episodes TEXT NOT NULL DEFAULT ''`,
+
+		// Episodes of a season contained in each downloaded file
+		`ALTER TABLE downloads ADD COLUMN episodes TEXT NOT NULL DEFAULT ''`,
+
+		// Title of an episode
+		`ALTER TABLE search_items ADD COLUMN episode_title TEXT NOT NULL DEFAULT ''`,
+
+		// Files seeded from the staging folder
+		`CREATE TABLE seeds (
+file TEXT PRIMARY KEY,
+magnet TEXT NOT NULL,
+size INTEGER NOT NULL,
+uploaded INTEGER NOT NULL DEFAULT 0,
+started_at datetime NOT NULL)`,
+
+		// Results of the scripts run on the events of an item
+		`CREATE TABLE hook_runs (
+title TEXT REFERENCES search_items(title) ON DELETE CASCADE,
+hook TEXT NOT NULL,
+event TEXT NOT NULL,
+file TEXT NOT NULL DEFAULT '',
+exit_code INTEGER NOT NULL,
+output TEXT NOT NULL DEFAULT '',
+error TEXT NOT NULL DEFAULT '',
+started_at datetime NOT NULL,
+duration_ms INTEGER NOT NULL)`,
+
+		// Attempts to deliver the events of items to webhooks
+		`CREATE TABLE webhook_deliveries (
+id TEXT NOT NULL,
+url TEXT NOT NULL,
+event TEXT NOT NULL,
+title TEXT NOT NULL,
+payload TEXT NOT NULL,
+attempt INTEGER NOT NULL,
+status_code INTEGER NOT NULL DEFAULT 0,
+error TEXT NOT NULL DEFAULT '',
+delivered_at datetime NOT NULL)`,
+
+		// Magnet picked by hand, which is extracted instead of the best rated one
+		`ALTER TABLE torrents ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0`,
+
+		// The same magnet may be stored for several items, ex. a season pack for its episodes
+		`CREATE TABLE torrents_unique (
+title TEXT REFERENCES search_items(title) ON DELETE CASCADE,
+url TEXT NOT NULL,
+quality TEXT NOT NULL CHECK(quality in ('4K', 'FHD', 'HD', 'SD')),
+encoding TEXT CHECK (encoding in ('x264', 'x265', 'VC-1', 'XviD')),
+size INTEGER NOT NULL,
+rating INTEGER DEFAULT 0,
+tried_at datetime,
+failed_reason TEXT NOT NULL DEFAULT '',
+seeders INTEGER NOT NULL DEFAULT 0,
+leechers INTEGER NOT NULL DEFAULT 0,
+rejected_reason TEXT NOT NULL DEFAULT '',
+name TEXT NOT NULL DEFAULT '',
+source TEXT NOT NULL DEFAULT '',
+release_group TEXT NOT NULL DEFAULT '',
+proper INTEGER NOT NULL DEFAULT 0,
+pinned BOOLEAN NOT NULL DEFAULT 0,
+UNIQUE(title, url));
+INSERT INTO torrents_unique (title, url, quality, encoding, size, rating, tried_at, failed_reason, seeders, leechers, rejected_reason, name, source, release_group, proper, pinned)
+SELECT title, url, quality, encoding, size, rating, tried_at, failed_reason, seeders, leechers, rejected_reason, name, source, release_group, proper, pinned FROM torrents;
+DROP TABLE torrents;
+ALTER TABLE torrents_unique RENAME TO torrents`,
 	}
 }